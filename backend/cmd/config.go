@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+)
+
+const configUsage = `usage: main config <command>
+
+commands:
+  print       print the effective configuration with secrets redacted and report invalid settings`
+
+// runConfig implements the config subcommand
+func runConfig(cfg *config.Config, args []string) {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, configUsage)
+		os.Exit(2)
+	}
+
+	out, err := cfg.Redacted().YAML()
+	if err != nil {
+		exitOnConfigError(err)
+	}
+	fmt.Print(string(out))
+
+	exitOnConfigError(cfg.Validate())
+}
+
+// exitOnConfigError prints configuration problems one per line instead of a single log entry,
+// so operators can fix all of them in one go
+func exitOnConfigError(err error) {
+	if err == nil {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/audit"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db"
+	"github.com/omnistrate-community/ai-chatbot/pkg/encryption"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"github.com/rs/zerolog/log"
+)
+
+const keysUsage = `usage: main keys <command>
+
+commands:
+  encrypt-existing       encrypt thread names, messages and shares stored before encryption was enabled
+  rotate <org_id>        create a new data key for the org, new content is encrypted with it
+  rewrap                 rewrap all data keys with the primary master key after replacing it
+  shred <org_id> --yes   destroy all data keys of the org, its encrypted content becomes unreadable for good`
+
+// runKeys implements the keys subcommand for managing encryption keys
+func runKeys(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, keysUsage)
+		os.Exit(2)
+	}
+
+	gormDB, err := db.Connect()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to database")
+	}
+
+	masterKeys, err := encryption.LoadMasterKeys(config.Current.Encryption)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load master keys")
+	}
+
+	dataStore := store.NewGormStore(gormDB, db.Reader)
+	keyring := encryption.NewKeyring(masterKeys, dataStore.DataKeys, config.Current.Encryption.KeyCacheTTL)
+
+	ctx := context.Background()
+	switch args[0] {
+	case "encrypt-existing":
+		result, err := store.EncryptExisting(ctx, gormDB, keyring)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to encrypt existing data")
+		}
+		fmt.Printf("encrypted %d thread name(s), %d message(s) and %d share(s)\n", result.Threads, result.Messages, result.Shares)
+		recordKeysEvent(ctx, dataStore, audit.ActionDataEncryptExisting, "", map[string]any{"encrypted": result})
+
+	case "rotate":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, keysUsage)
+			os.Exit(2)
+		}
+
+		version, err := keyring.Rotate(ctx, args[1])
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to rotate data key")
+		}
+		fmt.Printf("org %s now encrypts with data key version %d\n", args[1], version)
+		recordKeysEvent(ctx, dataStore, audit.ActionDataKeyRotate, args[1], map[string]any{"version": version})
+
+	case "rewrap":
+		rewrapped, err := keyring.Rewrap(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to rewrap data keys")
+		}
+		fmt.Printf("rewrapped %d data key(s) with master key %s\n", rewrapped, masterKeys.PrimaryID())
+		recordKeysEvent(ctx, dataStore, audit.ActionDataKeyRewrap, "", map[string]any{"rewrapped": rewrapped, "master_key_id": masterKeys.PrimaryID()})
+
+	case "shred":
+		// Irreversible, make sure it was not typed by accident
+		if len(args) != 3 || args[2] != "--yes" {
+			fmt.Fprintln(os.Stderr, keysUsage)
+			os.Exit(2)
+		}
+
+		if err := keyring.Shred(ctx, args[1]); err != nil {
+			log.Fatal().Err(err).Msg("failed to shred data keys")
+		}
+		fmt.Printf("shredded all data keys of org %s\n", args[1])
+		recordKeysEvent(ctx, dataStore, audit.ActionDataKeyShred, args[1], nil)
+
+	default:
+		fmt.Fprintln(os.Stderr, keysUsage)
+		os.Exit(2)
+	}
+}
+
+// recordKeysEvent audits a key management command, orgID is empty for commands affecting all orgs
+func recordKeysEvent(ctx context.Context, dataStore *store.Store, action string, orgID string, details map[string]any) {
+	event := tenant.AuditEvent{
+		Action:  action,
+		Outcome: tenant.AuditOutcomeSuccess,
+		OrgID:   orgID,
+		ActorID: audit.ActorCLI,
+		Details: details,
+	}
+	if orgID != "" {
+		event.TargetType = "org"
+		event.TargetID = orgID
+	}
+	audit.Append(ctx, dataStore.Audit, event)
+}
@@ -1,47 +1,225 @@
 package main
 
 import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/ai"
 	"github.com/omnistrate-community/ai-chatbot/pkg/billing"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
 	"github.com/omnistrate-community/ai-chatbot/pkg/core"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/migrate"
+	"github.com/omnistrate-community/ai-chatbot/pkg/encryption"
+	"github.com/omnistrate-community/ai-chatbot/pkg/health"
+	"github.com/omnistrate-community/ai-chatbot/pkg/jobs"
+	"github.com/omnistrate-community/ai-chatbot/pkg/logger"
 	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
-	modelcore "github.com/omnistrate-community/ai-chatbot/pkg/model/core"
-	modeltenant "github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/moderation"
+	"github.com/omnistrate-community/ai-chatbot/pkg/retention"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"github.com/omnistrate-community/ai-chatbot/pkg/tracing"
 	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 	// Import other necessary packages like those for interacting with the databases and your AI module
 )
 
 func main() {
-	// Initialize database + models
-	if err := modeltenant.Initialize(); err != nil {
-		log.Fatal().Err(err).Msg("failed to initialize database")
+	cfg, err := config.Load()
+	exitOnConfigError(err)
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			exitOnConfigError(cfg.ValidateDatabase())
+			runMigrate(os.Args[2:])
+			return
+		case "keys":
+			exitOnConfigError(cfg.ValidateEncryption())
+			runKeys(os.Args[2:])
+			return
+		case "config":
+			runConfig(cfg, os.Args[2:])
+			return
+		}
+	}
+
+	// Fail on startup instead of on the first request that needs a misconfigured setting
+	exitOnConfigError(cfg.Validate())
+
+	if err = run(cfg); err != nil {
+		log.Fatal().Err(err).Msg("failed to run server")
+	}
+}
+
+// run serves the API until the server is told to stop. Failures are returned rather than exiting
+// right away, so the deferred cleanup like flushing traces runs on every path.
+func run(cfg *config.Config) (err error) {
+	// Tracing is a no-op unless an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize tracing")
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("failed to flush traces")
+		}
+	}()
+
+	// Make sure the database schema is current before serving anything
+	gormDB, err := db.Connect()
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to database")
+	}
+	defer func() {
+		// Queries and emails abandoned at shutdown may still be saving, closing the pools under them would only make them fail
+		if abandoned := utils.InflightQueries.Running() + utils.InflightEmails.Running(); abandoned > 0 {
+			log.Warn().Int("abandoned", abandoned).Msg("leaving database open for abandoned work")
+			return
+		}
+		if err := db.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close database")
+		}
+	}()
+
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return errors.Wrap(err, "failed to get database handle")
+	}
+
+	if cfg.Database.MigrateOnStart {
+		if _, err = migrate.Up(context.Background(), sqlDB, db.Driver()); err != nil {
+			return errors.Wrap(err, "failed to apply migrations")
+		}
 	}
-	if err := modelcore.Initialize(); err != nil {
-		log.Fatal().Err(err).Msg("failed to initialize database")
+
+	if err = migrate.EnsureCurrent(context.Background(), sqlDB, db.Driver()); err != nil {
+		return errors.Wrap(err, "refusing to start against an unmigrated database")
+	}
+
+	// Message content and thread names are encrypted at rest once a master key is configured
+	masterKeys, err := encryption.LoadMasterKeys(cfg.Encryption)
+	if err != nil {
+		return errors.Wrap(err, "failed to load master keys")
 	}
 
+	dataStore := store.NewGormStore(gormDB, db.Reader)
+	dataStore = dataStore.WithEncryption(encryption.NewKeyring(masterKeys, dataStore.DataKeys, cfg.Encryption.KeyCacheTTL))
+
 	// Mount metrics APIs
 	metricsServer := metrics.NewMetrics()
+	metricsServer.RegisterDBStats(db.Pools())
+	for _, handle := range db.Handles() {
+		if err = metricsServer.InstrumentGORM(handle); err != nil {
+			return errors.Wrap(err, "failed to instrument database")
+		}
+		if err = handle.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics())); err != nil {
+			return errors.Wrap(err, "failed to trace database")
+		}
+	}
+	utils.Use(utils.CORS(), utils.SecurityHeaders())
+	utils.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithGinFilter(func(ctx *gin.Context) bool {
+		// Orchestrator probes would drown out real traffic
+		return !strings.HasSuffix(ctx.FullPath(), "/healthz") && !strings.HasSuffix(ctx.FullPath(), "/readyz")
+	})), logger.Middleware(), metricsServer.HTTPMiddleware(), utils.Recovery())
 	utils.NativeAPI(metricsServer.Handler().ServeHTTP).Mount("/metrics", "GET")
 
+	// Mount health APIs
+	healthChecker := health.NewChecker(cfg.Health.CacheTTL, cfg.Health.ProbeTimeout)
+	healthChecker.Register("database", func(ctx context.Context) error {
+		for role, pool := range db.Pools() {
+			if err := pool.PingContext(ctx); err != nil {
+				return errors.Wrapf(err, "failed to ping %s database", role)
+			}
+		}
+		return nil
+	})
+	healthChecker.Register("migrations", func(ctx context.Context) error {
+		return migrate.EnsureCurrent(ctx, sqlDB, db.Driver())
+	})
+	healthChecker.Register("model_provider", ai.NewLLMEngine(metricsServer).Ping)
+	if cfg.Auth.Provider == config.AuthProviderOmnistrate {
+		healthChecker.Register("omnistrate", utils.OmnistrateServiceAdminInstance().Authenticate)
+	}
+	utils.GinAPI(healthChecker.LivenessHandler).Mount("/healthz", "GET")
+	utils.GinAPI(healthChecker.ReadinessHandler).Mount("/readyz", "GET")
+
 	// Mount user APIs
-	userAPIs := core.NewUserAPI(metricsServer)
+	userAPIs := core.NewUserAPI(metricsServer, dataStore)
 	utils.GinAPI(userAPIs.SignupHandler).Mount("/user", "POST")
+	utils.GinAPI(userAPIs.DeleteUserHandler).Mount("/user", "DELETE")
 	utils.GinAPI(userAPIs.SigninHandler).Mount("/user/signin", "POST")
+	utils.GinAPI(userAPIs.RefreshHandler).Mount("/user/token/refresh", "POST")
+	utils.GinAPI(userAPIs.VerifyEmailHandler).Mount("/user/verify", "POST")
+	utils.GinAPI(userAPIs.ResendVerificationHandler).Mount("/user/verify/resend", "POST")
+	utils.GinAPI(userAPIs.ForgotPasswordHandler).Mount("/user/password/forgot", "POST")
+	utils.GinAPI(userAPIs.ResetPasswordHandler).Mount("/user/password/reset", "POST")
 	utils.GinAPI(userAPIs.UserProfileHandler).Mount("/user/profile", "GET")
+	utils.GinAPI(userAPIs.UpdateProfileHandler).Mount("/user/profile", "PUT")
+	utils.GinAPI(userAPIs.DataExportHandler).Mount("/user/data-export", "GET")
+
+	// Queries and responses are checked by the configured moderation classifier, if any
+	classifier, err := moderation.NewClassifier(cfg.Moderation, ai.NewLLMEngine(metricsServer))
+	if err != nil {
+		return errors.Wrap(err, "failed to set up moderation")
+	}
 
 	// Mount chat APIs
-	chatAPIs := core.NewChat(metricsServer)
+	chatAPIs := core.NewChat(metricsServer, dataStore, classifier)
 	utils.GinAPI(chatAPIs.NewThreadHandler).Mount("/chat/thread", "POST")
 	utils.GinAPI(chatAPIs.ListThreadsHandler).Mount("/chat/thread", "GET")
 	utils.GinAPI(chatAPIs.GetThreadHandler).Mount("/chat/thread/:thread_id", "GET")
 	utils.GinAPI(chatAPIs.QueryThreadHandler).Mount("/chat/thread/:thread_id/query", "POST")
+	utils.GinAPI(chatAPIs.ExportThreadHandler).Mount("/chat/thread/:thread_id/export", "GET")
+	utils.GinAPI(chatAPIs.ExportAllThreadsHandler).Mount("/chat/export", "GET")
+	utils.GinAPI(chatAPIs.ImportThreadsHandler).Mount("/chat/import", "POST", utils.WithMaxBodyBytes(cfg.Import.MaxBytes))
+	utils.GinAPI(chatAPIs.CreateShareHandler).Mount("/chat/thread/:thread_id/share", "POST")
+	utils.GinAPI(chatAPIs.ListSharesHandler).Mount("/chat/thread/:thread_id/share", "GET")
+	utils.GinAPI(chatAPIs.RevokeShareHandler).Mount("/chat/thread/:thread_id/share/:share_id", "DELETE")
+
+	// Mount public share APIs (unauthenticated, the share token is the credential)
+	utils.GinAPI(chatAPIs.GetSharedThreadHandler).Mount("/share/:token", "GET")
+
+	// Mount org APIs
+	orgAPIs := core.NewOrgAPI(metricsServer, dataStore)
+	utils.GinAPI(orgAPIs.GetProfileHandler).Mount("/org/profile", "GET")
+	utils.GinAPI(orgAPIs.UpdateProfileHandler).Mount("/org/profile", "PUT")
+	utils.GinAPI(orgAPIs.GetSettingsHandler).Mount("/org/settings", "GET")
+	utils.GinAPI(orgAPIs.UpdateSettingsHandler).Mount("/org/settings", "PUT")
+	utils.GinAPI(orgAPIs.SetLegalHoldHandler).Mount("/org/thread/:thread_id/legal-hold", "PUT")
+	utils.GinAPI(orgAPIs.DeleteOrgUserHandler).Mount("/org/user/:user_id", "DELETE")
+	utils.GinAPI(orgAPIs.ListAuditEventsHandler).Mount("/org/audit", "GET")
+	utils.GinAPI(orgAPIs.ExportAuditEventsHandler).Mount("/org/audit/export", "GET")
+
+	// Mount billing and usage APIs. Consumption is metered by Omnistrate, there is none to show for
+	// local accounts.
+	billingAPIs := billing.NewBilling(metricsServer, dataStore)
+	if cfg.Auth.Provider == config.AuthProviderOmnistrate {
+		utils.GinAPI(billingAPIs.GetUsageHandler).Mount("/billing/usage", "GET")
+		utils.GinAPI(billingAPIs.GetPerDayUsageHandler).Mount("/billing/usage/range/:startDate/:endDate", "GET")
+	} else {
+		utils.GinAPI(billingAPIs.NoUsageHandler).Mount("/billing/usage", "GET")
+		utils.GinAPI(billingAPIs.NoUsageHandler).Mount("/billing/usage/range/:startDate/:endDate", "GET")
+	}
+
+	// Mount the operator usage export (authenticated with USAGE_EXPORT_TOKEN)
+	utils.GinAPI(billingAPIs.UsageExportHandler).Mount("/usage/export", "GET")
 
-	// Mount billing and usage APIs
-	billingAPIs := billing.NewBilling(metricsServer)
-	utils.GinAPI(billingAPIs.GetUsageHandler).Mount("/billing/usage", "GET")
-	utils.GinAPI(billingAPIs.GetPerDayUsageHandler).Mount("/billing/usage/range/:startDate/:endDate", "GET")
+	// Background jobs keep the per-org user gauge up to date and enforce retention policies
+	jobRunner := jobs.NewRunner(metricsServer, jobs.NewGormLeaseRepository(gormDB))
+	jobRunner.Register("users_per_organization", cfg.Metrics.RefreshInterval, func(ctx context.Context) error {
+		return metricsServer.RefreshUsersPerOrganization(ctx, dataStore.Users.CountByOrg)
+	})
+	jobRunner.RegisterExclusive("retention", cfg.Retention.Interval, retention.NewPurger(dataStore, metricsServer, cfg.Retention.BatchSize).Run)
+	jobRunner.Start(context.Background())
+	defer jobRunner.Stop()
 
-	// Run the server
-	utils.StartServer()
+	// Run the server until it is told to stop and in-flight queries are drained. Readiness fails as
+	// soon as the signal arrives.
+	return utils.StartServer(healthChecker.ShutDown)
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/db"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/migrate"
+	"github.com/rs/zerolog/log"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n migrations (default 1)
+  status      list migrations and when they were applied`
+
+// runMigrate implements the migrate subcommand
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	gormDB, err := db.Connect()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to database")
+	}
+
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to get database handle")
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrate.Up(ctx, sqlDB, db.Driver())
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to apply migrations")
+		}
+		fmt.Printf("applied %d migration(s)\n", len(applied))
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				os.Exit(2)
+			}
+		}
+
+		reverted, err := migrate.Down(ctx, sqlDB, db.Driver(), steps)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to revert migrations")
+		}
+		fmt.Printf("reverted %d migration(s)\n", len(reverted))
+
+	case "status":
+		statuses, err := migrate.Statuses(ctx, sqlDB, db.Driver())
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to get migration status")
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s  %s\n", status.Version, status.Name, appliedAt)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
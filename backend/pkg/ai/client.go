@@ -3,13 +3,18 @@ package ai
 import (
 	"context"
 	"io"
+	"net/http"
+	"time"
 
 	"github.com/omnistrate-community/ai-chatbot/pkg/config"
 	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
 	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/omnistrate-community/ai-chatbot/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type LLMEngine struct {
@@ -22,15 +27,83 @@ func NewLLMEngine(metricsServer *metrics.Metrics) (engine *LLMEngine) {
 		metrics: metricsServer,
 	}
 
-	clientConfig := openai.DefaultConfig(config.ModelProviderAPIKey)
-	clientConfig.BaseURL = config.ModelProviderEndpoint
+	clientConfig := openai.DefaultConfig(config.Current.Model.APIKey)
+	if config.Current.Model.Endpoint != "" {
+		clientConfig.BaseURL = config.Current.Model.Endpoint
+	}
+	clientConfig.HTTPClient = &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
 	engine.client = openai.NewClientWithConfig(clientConfig)
 	return
 }
 
+// Ping checks that the model provider is reachable and accepts our credentials
+func (e *LLMEngine) Ping(ctx context.Context) (err error) {
+	if _, err = e.client.ListModels(ctx); err != nil {
+		err = errors.Wrap(err, "failed to list models")
+	}
+	return
+}
+
+// Moderate classifies text with the provider's moderation endpoint
+func (e *LLMEngine) Moderate(ctx context.Context, model string, text string) (result openai.ModerationResponse, err error) {
+	ctx, span := tracing.Start(ctx, "llm.Moderate", attribute.String("gen_ai.request.model", model))
+	defer func() { tracing.End(span, err) }()
+
+	if result, err = e.client.Moderations(ctx, openai.ModerationRequest{Model: model, Input: text}); err != nil {
+		e.metrics.IncrementUpstreamErrors(metrics.UpstreamModelProvider, "moderations")
+		err = errors.Wrap(err, "failed to moderate text")
+	}
+	return
+}
+
+// Complete runs a short, deterministic, non-streaming completion, used for classification tasks
+func (e *LLMEngine) Complete(ctx context.Context, system string, text string, maxTokens int) (content string, err error) {
+	ctx, span := tracing.Start(ctx, "llm.Complete",
+		attribute.String("gen_ai.system", config.Current.Model.Provider),
+		attribute.String("gen_ai.request.model", config.Current.Model.Name),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	request := openai.ChatCompletionRequest{
+		Model:               config.Current.Model.Name,
+		MaxCompletionTokens: maxTokens,
+		Temperature:         0,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: system},
+			{Role: openai.ChatMessageRoleUser, Content: text},
+		},
+	}
+
+	if config.Current.Model.Provider == config.ModelProviderVLLM {
+		// vLLM does not support MaxCompletionTokens yet
+		request.MaxCompletionTokens = 0
+		request.MaxTokens = maxTokens
+	}
+
+	response, err := e.client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		e.metrics.IncrementUpstreamErrors(metrics.UpstreamModelProvider, "create_chat_completion")
+		err = errors.Wrap(err, "failed to create chat completion")
+		return
+	}
+
+	if len(response.Choices) == 0 {
+		return "", errors.New("chat completion returned no choices")
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
 func (e *LLMEngine) Query(ctx context.Context, prompt core.Message) (responseContent string, usage *openai.Usage, err error) {
+	ctx, span := tracing.Start(ctx, "llm.Query",
+		attribute.String("gen_ai.system", config.Current.Model.Provider),
+		attribute.String("gen_ai.request.model", config.Current.Model.Name),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	request := openai.ChatCompletionRequest{
-		Model:               config.Model,
+		Model:               config.Current.Model.Name,
 		MaxCompletionTokens: 8192,
 		Messages: []openai.ChatCompletionMessage{
 			{
@@ -44,33 +117,38 @@ func (e *LLMEngine) Query(ctx context.Context, prompt core.Message) (responseCon
 		},
 	}
 
-	if config.ModelProvider == config.ModelProviderVLLM {
+	if config.Current.Model.Provider == config.ModelProviderVLLM {
 		// vLLM does not support MaxCompletionTokens yet
 		request.MaxCompletionTokens = 0
 		request.MaxTokens = 8192
 	}
 
+	start := time.Now()
+	var firstTokenAt time.Time
+
 	stream, err := e.client.CreateChatCompletionStream(ctx, request)
 	if err != nil {
+		e.metrics.IncrementUpstreamErrors(metrics.UpstreamModelProvider, "create_chat_completion_stream")
 		err = errors.Wrap(err, "thread.Query: failed to create chat completion stream")
 		return
 	}
 	defer stream.Close()
 
-	log.Info().Msg("thread.Query: created chat completion stream")
+	log.Ctx(ctx).Info().Msg("thread.Query: created chat completion stream")
 
 	for {
 		var streamResponse openai.ChatCompletionStreamResponse
 		streamResponse, err = stream.Recv()
 		if errors.Is(err, io.EOF) {
-			log.Info().Msg("thread.Query: chat completion stream closed")
+			log.Ctx(ctx).Info().Msg("thread.Query: chat completion stream closed")
 			err = nil
 			break
 		}
 
 		if err != nil {
+			e.metrics.IncrementUpstreamErrors(metrics.UpstreamModelProvider, "receive_chat_completion")
 			err = errors.Wrap(err, "thread.Query: failed to receive chat completion response")
-			log.Error().Err(err).Msg("thread.Query: failed to receive chat completion response")
+			log.Ctx(ctx).Error().Err(err).Msg("thread.Query: failed to receive chat completion response")
 			return
 		}
 
@@ -82,9 +160,32 @@ func (e *LLMEngine) Query(ctx context.Context, prompt core.Message) (responseCon
 			continue
 		}
 
+		if firstTokenAt.IsZero() && streamResponse.Choices[0].Delta.Content != "" {
+			firstTokenAt = time.Now()
+		}
+
 		responseContent = responseContent + streamResponse.Choices[0].Delta.Content
 	}
 
+	total := time.Since(start)
+	if firstTokenAt.IsZero() {
+		firstTokenAt = start.Add(total)
+	}
+
+	completionTokens := 0
+	if usage != nil {
+		completionTokens = usage.CompletionTokens
+	}
+	e.metrics.ObserveLLMGeneration(config.Current.Model.Name, total, firstTokenAt.Sub(start), completionTokens)
+	span.SetAttributes(attribute.Int64("gen_ai.time_to_first_token_ms", firstTokenAt.Sub(start).Milliseconds()))
+
+	if usage != nil {
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", usage.PromptTokens),
+			attribute.Int("gen_ai.usage.output_tokens", usage.CompletionTokens),
+		)
+	}
+
 	if usage != nil {
 		e.metrics.IncrementTotalRequestTokens(prompt.Thread.UserID, prompt.Thread.User.OrgID, prompt.Thread.User.Email, float64(usage.PromptTokens))
 		e.metrics.IncrementTotalResponseTokens(prompt.Thread.UserID, prompt.Thread.User.OrgID, prompt.Thread.User.Email, float64(usage.CompletionTokens))
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/logger"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/rs/zerolog/log"
+)
+
+// Audited actions
+const (
+	ActionSignup               = "user.signup"
+	ActionSignin               = "user.signin"
+	ActionEmailVerify          = "user.email.verify"
+	ActionPasswordResetRequest = "user.password.reset_request"
+	ActionPasswordReset        = "user.password.reset"
+	ActionUserProfileUpdate    = "user.profile.update"
+	ActionOrgProfileUpdate     = "org.profile.update"
+	ActionUserDelete           = "user.delete"
+	ActionShareCreate          = "share.create"
+	ActionShareRevoke          = "share.revoke"
+	ActionOrgSettingsUpdate    = "org.settings.update"
+	ActionAuditExport          = "audit.export"
+	ActionThreadLegalHold      = "thread.legal_hold"
+	ActionDataKeyRotate        = "data_key.rotate"
+	ActionDataKeyRewrap        = "data_key.rewrap"
+	ActionDataKeyShred         = "data_key.shred"
+	ActionDataEncryptExisting  = "data.encrypt_existing"
+)
+
+// ActorCLI is the actor of actions taken through the command line
+const ActorCLI = "cli"
+
+// Event starts an event for an action taken by user
+func Event(action string, user tenant.User) tenant.AuditEvent {
+	return tenant.AuditEvent{
+		Action:     action,
+		Outcome:    tenant.AuditOutcomeSuccess,
+		OrgID:      user.OrgID,
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+	}
+}
+
+// Record appends the event with the client IP, user agent and request ID of the request. Failing to
+// write the audit log is logged but does not fail the request, the action has already happened.
+func Record(ctx *gin.Context, repo tenant.AuditRepository, event tenant.AuditEvent) {
+	event.IP = ctx.ClientIP()
+	event.UserAgent = ctx.Request.UserAgent()
+	event.RequestID = ctx.Writer.Header().Get(logger.RequestIDHeader)
+
+	Append(ctx.Request.Context(), repo, event)
+}
+
+// Append appends the event as is, for actions that are not taken through the API
+func Append(ctx context.Context, repo tenant.AuditRepository, event tenant.AuditEvent) {
+	// Record even if the client went away, the action was taken regardless
+	if err := repo.Append(context.WithoutCancel(ctx), &event); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("action", event.Action).Str("actor_id", event.ActorID).Msg("failed to write audit event")
+	}
+}
@@ -2,98 +2,103 @@ package auth
 
 import (
 	"context"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/mail"
 	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
 	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
-	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
-	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"github.com/omnistrate-community/ai-chatbot/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
-	"net/http"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var ForbiddenError = errors.New("forbidden")
 
+// TenantUpdate holds the profile fields to change, nil fields are left as they are
+type TenantUpdate struct {
+	Name           *string
+	OrgName        *string
+	OrgDescription *string
+	OrgLogoURL     *string
+	OrgWebsiteURL  *string
+}
+
 type Auth struct {
-	omnistrateAdminService *utils.OmnistrateServiceAdmin
-	metrics                *metrics.Metrics
+	provider Provider
+	metrics  *metrics.Metrics
+	mailer   mail.Mailer
 }
 
-func NewAuth(metricsServer *metrics.Metrics) (a *Auth) {
+func NewAuth(metricsServer *metrics.Metrics, dataStore *store.Store) (a *Auth) {
 	return &Auth{
-		omnistrateAdminService: utils.OmnistrateServiceAdminInstance(),
-		metrics:                metricsServer,
+		provider: NewProvider(config.Current.Auth, metricsServer, dataStore),
+		metrics:  metricsServer,
+		mailer:   mail.NewMailer(config.Current.Mail),
 	}
 }
 
+// CreateTenant validates the request and signs up a new customer with the provider. With
+// AUTH_AUTO_VERIFY_SIGNUPS the account is verified and signed in right away and createdUser is
+// set. Otherwise createdUser is empty and a verification link is emailed, the user has to follow it
+// before signing in.
 func (a *Auth) CreateTenant(
 	ctx context.Context,
-	user tenant.User,
-	password string,
+	request SignupRequest,
 ) (
 	createdUser tenant.User,
 	org tenant.Org,
 	err error,
 ) {
-	// Use the admin context to signup as the customer
-	var tenantSignupHandle openapiclientv1.ApiUsersApiCustomerSignupRequest
-	if tenantSignupHandle, err = utils.OmnistrateServiceAdminInstance().TenantSignUpAPIHandle(context.Background()); err != nil {
-		err = errors.Wrap(err, "failed to get tenant signup handle")
-		return
-	}
+	ctx, span := tracing.Start(ctx, "auth.CreateTenant")
+	defer func() { tracing.End(span, err) }()
 
-	customerSignupRequestBody := &openapiclientv1.CustomerSignupRequest2{
-		CompanyDescription: utils.ToPtr(user.Org.Description),
-		CompanyUrl:         utils.ToPtr(user.Org.WebsiteURL),
-		Email:              user.Email,
-		LegalCompanyName:   utils.ToPtr(user.Org.LegalCompanyName),
-		Name:               user.Name,
-		Password:           password,
+	request.Normalize()
+	if err = request.Validate(); err != nil {
+		return
 	}
 
-	var httpResult *http.Response
-	if httpResult, err = tenantSignupHandle.CustomerSignupRequest2(*customerSignupRequestBody).Execute(); err != nil {
-		err = errors.Wrap(err, "failed to execute tenant signup request")
+	if err = a.provider.SignUp(ctx, request); err != nil {
 		return
 	}
 
-	if httpResult.StatusCode == http.StatusForbidden {
-		err = ForbiddenError
-		return
+	org = tenant.Org{
+		Name:             request.LegalCompanyName,
+		LegalCompanyName: request.LegalCompanyName,
+		Description:      request.CompanyDescription,
+		WebsiteURL:       request.CompanyURL,
 	}
 
-	if httpResult.StatusCode != http.StatusOK {
-		err = errors.Errorf("failed to signup tenant: %s", httpResult.Status)
+	if !config.Current.Auth.AutoVerifySignups {
+		// The account exists, a failure is repaired by asking for the email again
+		if sendErr := a.SendVerification(ctx, request.Email); sendErr != nil {
+			log.Ctx(ctx).Error().Err(sendErr).Msg("failed to send verification email")
+		}
 		return
 	}
 
-	// Validate user's email here. For now, we will assume that the email is valid
-	if err = utils.OmnistrateServiceAdminInstance().ValidateTenant(ctx, user.Email); err != nil {
-		log.Warn().Err(err).Msg("failed to validate tenant, already validated?")
+	// Mark the email as verified without asking the user
+	if verifyErr := a.verifyWithoutAsking(ctx, request.Email); verifyErr != nil {
+		log.Ctx(ctx).Warn().Err(verifyErr).Msg("failed to validate tenant, already validated?")
 	}
 
 	// Authenticate as the user
-	var tenantJWTToken string
-	if tenantJWTToken, err = a.AuthenticateTenant(ctx, user.Email, password); err != nil {
+	if _, createdUser, err = a.AuthenticateTenant(ctx, request.Email, request.Password); err != nil {
 		err = errors.Wrap(err, "failed to authenticate tenant")
 		return
 	}
+	org.ID = createdUser.OrgID
 
-	// Describe the user
-	if createdUser, _, err = a.DescribeTenant(ctx, tenantJWTToken); err != nil {
-		err = errors.Wrap(err, "failed to describe tenant")
-		return
-	}
+	return
+}
 
-	org = tenant.Org{
-		ID:               createdUser.OrgID,
-		Name:             user.Org.Name,
-		LegalCompanyName: user.Org.LegalCompanyName,
-		Description:      user.Org.Description,
-		LogoURL:          user.Org.LogoURL,
-		WebsiteURL:       user.Org.WebsiteURL,
+// verifyWithoutAsking verifies the email with the token that would have been sent to it
+func (a *Auth) verifyWithoutAsking(ctx context.Context, email string) error {
+	token, err := a.provider.VerificationToken(ctx, email)
+	if err != nil {
+		return errors.Wrap(err, "failed to get verification token")
 	}
-
-	return
+	return a.provider.VerifyEmail(ctx, email, token)
 }
 
 func (a *Auth) AuthenticateTenant(
@@ -101,42 +106,48 @@ func (a *Auth) AuthenticateTenant(
 	tenantEmail string,
 	tenantPassword string,
 ) (
-	tenantJWTToken string,
+	session Session,
+	user tenant.User,
 	err error,
 ) {
-	var tenantSignInHandle openapiclientv1.ApiUsersApiCustomerSigninRequest
-	if tenantSignInHandle, err = utils.OmnistrateServiceAdminInstance().TenantSignInAPIHandle(ctx); err != nil {
-		err = errors.Wrap(err, "failed to get tenant signin handle")
-		return
-	}
+	ctx, span := tracing.Start(ctx, "auth.AuthenticateTenant")
+	defer func() { tracing.End(span, err) }()
 
-	customerSigninRequestBody := &openapiclientv1.CustomerSigninRequest2{
-		Email:    tenantEmail,
-		Password: utils.ToPtr(tenantPassword),
+	if session, err = a.provider.SignIn(ctx, tenantEmail, tenantPassword); err != nil {
+		return
 	}
 
-	var signinResult *openapiclientv1.CustomerSigninResult
-	var httpResult *http.Response
-	if signinResult, httpResult, err = tenantSignInHandle.CustomerSigninRequest2(*customerSigninRequestBody).Execute(); err != nil {
-		err = errors.Wrap(err, "failed to execute tenant signin request")
+	// Describe the user
+	if user, err = a.DescribeTenant(ctx, session.Token); err != nil {
+		err = errors.Wrap(err, "failed to describe tenant")
 		return
 	}
 
-	if httpResult.StatusCode == http.StatusForbidden {
-		err = ForbiddenError
+	a.metrics.IncrementTotalSuccessfulSigninAttempts(user.ID, user.OrgID, user.Email)
+	return
+}
+
+// RefreshSession exchanges a refresh token for a new session and returns the user it belongs to.
+// Invalid, used and expired refresh tokens are reported as ForbiddenError.
+func (a *Auth) RefreshSession(
+	ctx context.Context,
+	refreshToken string,
+) (
+	session Session,
+	user tenant.User,
+	err error,
+) {
+	ctx, span := tracing.Start(ctx, "auth.RefreshSession")
+	defer func() { tracing.End(span, err) }()
+
+	if session, err = a.provider.Refresh(ctx, refreshToken); err != nil {
 		return
 	}
 
-	// Describe the user
-	var user tenant.User
-	if user, _, err = a.DescribeTenant(ctx, signinResult.JwtToken); err != nil {
+	if user, err = a.DescribeTenant(ctx, session.Token); err != nil {
 		err = errors.Wrap(err, "failed to describe tenant")
 		return
 	}
-
-	a.metrics.IncrementTotalSuccessfulSigninAttempts(user.ID, user.OrgID, user.Email)
-
-	tenantJWTToken = signinResult.JwtToken
 	return
 }
 
@@ -145,36 +156,49 @@ func (a *Auth) DescribeTenant(
 	tenantJWTToken string,
 ) (
 	user tenant.User,
-	rawDescribeResult *openapiclientv1.DescribeUserResult,
 	err error,
 ) {
-	ctx = context.WithValue(ctx, openapiclientv1.ContextAccessToken, tenantJWTToken)
-	userHandle := utils.GetOmnistrateAPIClient().UsersApiAPI.UsersApiDescribeUser(ctx)
+	ctx, span := tracing.Start(ctx, "auth.DescribeTenant")
+	defer func() { tracing.End(span, err) }()
 
-	var httpResult *http.Response
-	if rawDescribeResult, httpResult, err = userHandle.Execute(); err != nil {
-		err = errors.Wrap(err, "failed to execute describe user request")
+	if user, err = a.provider.Describe(ctx, tenantJWTToken); err != nil {
 		return
 	}
 
-	if httpResult.StatusCode == http.StatusForbidden {
-		err = ForbiddenError
+	span.SetAttributes(attribute.String("enduser.id", user.ID), attribute.String("org.id", user.OrgID))
+	return
+}
+
+// UpdateTenant changes the profile of the user and their org with the provider, acting as the user,
+// and returns the user as described afterwards.
+func (a *Auth) UpdateTenant(
+	ctx context.Context,
+	tenantJWTToken string,
+	userID string,
+	update TenantUpdate,
+) (
+	user tenant.User,
+	err error,
+) {
+	ctx, span := tracing.Start(ctx, "auth.UpdateTenant")
+	defer func() { tracing.End(span, err) }()
+
+	if err = a.provider.Update(ctx, tenantJWTToken, userID, update); err != nil {
 		return
 	}
 
-	user = tenant.User{
-		ID:    rawDescribeResult.Id,
-		Email: utils.FromPtr(rawDescribeResult.Email),
-		Name:  utils.FromPtr(rawDescribeResult.Name),
-		OrgID: utils.FromPtr(rawDescribeResult.OrgId),
-		Org: tenant.Org{
-			ID:          utils.FromPtr(rawDescribeResult.OrgId),
-			Name:        utils.FromPtr(rawDescribeResult.OrgName),
-			Description: utils.FromPtr(rawDescribeResult.OrgDescription),
-			LogoURL:     utils.FromPtr(rawDescribeResult.OrgLogoURL),
-			WebsiteURL:  utils.FromPtr(rawDescribeResult.OrgURL),
-		},
+	if user, err = a.DescribeTenant(ctx, tenantJWTToken); err != nil {
+		err = errors.Wrap(err, "failed to describe tenant")
+		return
 	}
-
 	return
 }
+
+// DeleteUser removes the user's account from the provider, after everything stored about them
+// locally is gone
+func (a *Auth) DeleteUser(ctx context.Context, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.DeleteUser")
+	defer func() { tracing.End(span, err) }()
+
+	return a.provider.DeleteUser(ctx, userID)
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Outcomes of failed account operations the API reports to the caller, check with errors.Is
+var (
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrInvalidPassword     = errors.New("password does not meet the requirements")
+	ErrAlreadyExists       = errors.New("an account with this email already exists")
+	ErrRateLimited         = errors.New("too many requests, try again later")
+	ErrUpstreamUnavailable = errors.New("the account service is unavailable, try again later")
+	ErrUpstreamTimeout     = errors.New("the account service did not answer in time, try again later")
+	// ErrInvalidToken is returned for verification and reset links that are wrong, used or expired
+	ErrInvalidToken = errors.New("the link is invalid or has expired")
+	// ErrNotSupported is returned for operations the configured provider does not offer
+	ErrNotSupported = errors.New("not supported by the authentication provider")
+)
+
+// Error is a failed call with one of the outcomes above and an explanation that can be shown to the
+// caller. The original error, if any, stays in the chain for logging.
+type Error struct {
+	Kind    error
+	Message string
+	cause   error
+}
+
+func newError(kind error, message string, cause error) *Error {
+	return &Error{Kind: kind, Message: message, cause: cause}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.cause == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.cause}
+}
+
+// classifyError maps a failed Omnistrate call to one of the outcomes above, or to ForbiddenError for
+// rejected credentials. Errors that fit none of them are wrapped with message and returned as is, so
+// is a call given up because the caller went away, Omnistrate is not to blame for it.
+func classifyError(httpResult *http.Response, err error, message string) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return errors.Wrap(err, message)
+	case errors.Is(err, context.DeadlineExceeded):
+		return newError(ErrUpstreamTimeout, "", err)
+	case httpResult == nil:
+		return newError(ErrUpstreamUnavailable, "", err)
+	}
+
+	explanation := serviceErrorMessage(err)
+	lowered := strings.ToLower(explanation)
+
+	switch {
+	case httpResult.StatusCode == http.StatusTooManyRequests:
+		return newError(ErrRateLimited, "", err)
+	case httpResult.StatusCode >= http.StatusInternalServerError:
+		return newError(ErrUpstreamUnavailable, "", err)
+	case httpResult.StatusCode == http.StatusConflict, strings.Contains(lowered, "already exists"), strings.Contains(lowered, "already registered"):
+		return newError(ErrAlreadyExists, "", err)
+	case httpResult.StatusCode == http.StatusUnauthorized, httpResult.StatusCode == http.StatusForbidden:
+		return newError(ForbiddenError, "", err)
+	case httpResult.StatusCode == http.StatusBadRequest && strings.Contains(lowered, "password"):
+		return newError(ErrInvalidPassword, explanation, err)
+	case httpResult.StatusCode == http.StatusBadRequest:
+		return newError(ErrInvalidInput, explanation, err)
+	}
+
+	return errors.Wrap(err, message)
+}
+
+// serviceErrorMessage returns the explanation Omnistrate gave in the error body, or the error itself
+func serviceErrorMessage(err error) string {
+	var serviceErr *openapiclientv1.GenericOpenAPIError
+	if !errors.As(err, &serviceErr) {
+		return err.Error()
+	}
+
+	if model, ok := serviceErr.Model().(openapiclientv1.Error); ok && model.Message != "" {
+		return model.Message
+	}
+
+	var body openapiclientv1.Error
+	if json.Unmarshal(serviceErr.Body(), &body) == nil && body.Message != "" {
+		return body.Message
+	}
+	return err.Error()
+}
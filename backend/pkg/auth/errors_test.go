@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		err        error
+		want       error
+	}{
+		{name: "caller went away", err: context.Canceled, want: context.Canceled},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: ErrUpstreamTimeout},
+		{name: "wrapped deadline", err: errors.Wrap(context.DeadlineExceeded, "Post \"https://api.omnistrate.cloud\""), want: ErrUpstreamTimeout},
+		{name: "no response", err: errors.New("connection refused"), want: ErrUpstreamUnavailable},
+		{name: "server error", statusCode: http.StatusBadGateway, err: errors.New("bad gateway"), want: ErrUpstreamUnavailable},
+		{name: "rate limited", statusCode: http.StatusTooManyRequests, err: errors.New("slow down"), want: ErrRateLimited},
+		{name: "conflict", statusCode: http.StatusConflict, err: errors.New("conflict"), want: ErrAlreadyExists},
+		{name: "unauthorized", statusCode: http.StatusUnauthorized, err: errors.New("unauthorized"), want: ForbiddenError},
+		{name: "weak password", statusCode: http.StatusBadRequest, err: errors.New("password is too short"), want: ErrInvalidPassword},
+		{name: "bad request", statusCode: http.StatusBadRequest, err: errors.New("invalid email"), want: ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var httpResult *http.Response
+			if tt.statusCode != 0 {
+				httpResult = &http.Response{StatusCode: tt.statusCode}
+			}
+
+			err := classifyError(httpResult, tt.err, "failed to execute request")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("classifyError(%d, %q) = %v, want %v", tt.statusCode, tt.err, err, tt.want)
+			}
+			if tt.want == context.Canceled && errors.Is(err, ErrUpstreamUnavailable) {
+				t.Errorf("classifyError(%q) = %v, a canceled call is not an unavailable service", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	verificationTokenTTL = 24 * time.Hour
+	resetTokenTTL        = time.Hour
+)
+
+// localProvider keeps the accounts in the database and signs its own access tokens, for deployments
+// that cannot reach Omnistrate. Users and orgs live in the same tables the Omnistrate provider syncs
+// into, passwords and tokens in local_credentials and auth_tokens.
+type localProvider struct {
+	store           *store.Store
+	key             []byte
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+}
+
+func newLocalProvider(cfg config.AuthConfig, dataStore *store.Store) *localProvider {
+	return &localProvider{
+		store:           dataStore,
+		key:             []byte(cfg.JWTSecret),
+		accessTokenTTL:  cfg.AccessTokenTTL,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// rejectSignin spends the time of a password check before rejecting a sign-in, so unknown emails
+// cannot be told apart from wrong passwords by the response time
+func rejectSignin(password string) error {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = hashPassword("not a password")
+	})
+	_, _ = checkPassword(dummyHash, password)
+	return ForbiddenError
+}
+
+func (p *localProvider) SignUp(ctx context.Context, request SignupRequest) error {
+	if _, err := p.store.Users.GetByEmail(ctx, request.Email); err == nil {
+		return newError(ErrAlreadyExists, "", nil)
+	} else if !errors.Is(err, model.ErrNotFound) {
+		return errors.Wrap(err, "failed to get user")
+	}
+
+	passwordHash, err := hashPassword(request.Password)
+	if err != nil {
+		return err
+	}
+
+	org := tenant.Org{
+		ID:               uuid.New().String(),
+		Name:             request.LegalCompanyName,
+		LegalCompanyName: request.LegalCompanyName,
+		Description:      request.CompanyDescription,
+		WebsiteURL:       request.CompanyURL,
+	}
+	user := tenant.User{
+		ID:    uuid.New().String(),
+		Email: request.Email,
+		Name:  request.Name,
+		OrgID: org.ID,
+		Role:  tenant.RoleRoot,
+	}
+	credential := tenant.LocalCredential{UserID: user.ID, PasswordHash: passwordHash}
+
+	if err = p.store.Credentials.CreateAccount(ctx, &org, &user, &credential); err != nil {
+		// Lost a race against a signup with the same email
+		if _, getErr := p.store.Users.GetByEmail(ctx, request.Email); getErr == nil {
+			return newError(ErrAlreadyExists, "", err)
+		}
+		return errors.Wrap(err, "failed to create account")
+	}
+	return nil
+}
+
+func (p *localProvider) SignIn(ctx context.Context, email string, password string) (Session, error) {
+	user, err := p.store.Users.GetByEmail(ctx, email)
+	if errors.Is(err, model.ErrNotFound) {
+		return Session{}, rejectSignin(password)
+	} else if err != nil {
+		return Session{}, errors.Wrap(err, "failed to get user")
+	}
+
+	// Users synced from Omnistrate have no local password
+	credential, err := p.store.Credentials.Get(ctx, user.ID)
+	if errors.Is(err, model.ErrNotFound) {
+		return Session{}, rejectSignin(password)
+	} else if err != nil {
+		return Session{}, errors.Wrap(err, "failed to get credential")
+	}
+
+	ok, err := checkPassword(credential.PasswordHash, password)
+	if err != nil {
+		return Session{}, err
+	}
+	if !ok {
+		return Session{}, ForbiddenError
+	}
+	if !credential.IsEmailVerified() {
+		return Session{}, newError(ForbiddenError, "email address is not verified", nil)
+	}
+
+	return p.newSession(ctx, credential)
+}
+
+func (p *localProvider) Refresh(ctx context.Context, refreshToken string) (Session, error) {
+	token, err := p.store.Credentials.ConsumeToken(ctx, tenant.AuthTokenRefresh, hashOpaqueToken(refreshToken), time.Now())
+	if errors.Is(err, model.ErrNotFound) {
+		return Session{}, ForbiddenError
+	} else if err != nil {
+		return Session{}, errors.Wrap(err, "failed to consume refresh token")
+	}
+
+	// The account may have been deleted since
+	credential, err := p.store.Credentials.Get(ctx, token.UserID)
+	if errors.Is(err, model.ErrNotFound) {
+		return Session{}, ForbiddenError
+	} else if err != nil {
+		return Session{}, errors.Wrap(err, "failed to get credential")
+	}
+
+	return p.newSession(ctx, credential)
+}
+
+// newSession issues an access token and a refresh token for the owner of the credential
+func (p *localProvider) newSession(ctx context.Context, credential tenant.LocalCredential) (session Session, err error) {
+	now := time.Now()
+	if session.Token, session.ExpiresAt, err = signAccessToken(p.key, credential.UserID, credential.SessionVersion, now, p.accessTokenTTL); err != nil {
+		err = errors.Wrap(err, "failed to sign access token")
+		return
+	}
+
+	session.RefreshToken, err = p.createToken(ctx, credential.UserID, tenant.AuthTokenRefresh, now.Add(p.refreshTokenTTL))
+	return
+}
+
+// createToken stores a new single-use token and returns it
+func (p *localProvider) createToken(ctx context.Context, userID string, kind string, expiresAt time.Time) (string, error) {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err = p.store.Credentials.CreateToken(ctx, &tenant.AuthToken{Hash: hash, Kind: kind, UserID: userID, ExpiresAt: expiresAt}); err != nil {
+		return "", errors.Wrap(err, "failed to store token")
+	}
+	return token, nil
+}
+
+// authenticate returns the user an access token was issued to, as long as the account still exists
+// and the password was not reset since
+func (p *localProvider) authenticate(ctx context.Context, token string) (tenant.User, error) {
+	claims, err := parseAccessToken(p.key, token, time.Now())
+	if err != nil {
+		return tenant.User{}, newError(ForbiddenError, "", err)
+	}
+
+	credential, err := p.store.Credentials.Get(ctx, claims.Subject)
+	if errors.Is(err, model.ErrNotFound) {
+		return tenant.User{}, ForbiddenError
+	} else if err != nil {
+		return tenant.User{}, errors.Wrap(err, "failed to get credential")
+	}
+	if claims.Version != credential.SessionVersion {
+		return tenant.User{}, ForbiddenError
+	}
+
+	user, err := p.store.Users.Get(ctx, claims.Subject)
+	if errors.Is(err, model.ErrNotFound) {
+		return tenant.User{}, ForbiddenError
+	} else if err != nil {
+		return tenant.User{}, errors.Wrap(err, "failed to get user")
+	}
+	return user, nil
+}
+
+func (p *localProvider) Describe(ctx context.Context, token string) (tenant.User, error) {
+	user, err := p.authenticate(ctx, token)
+	if err != nil {
+		return tenant.User{}, err
+	}
+
+	if user.Org, err = p.store.Orgs.Get(ctx, user.OrgID); err != nil {
+		return tenant.User{}, errors.Wrap(err, "failed to get org")
+	}
+	return user, nil
+}
+
+// Update changes the profile like Omnistrate does: users change their own name, only the org's
+// owner changes the org
+func (p *localProvider) Update(ctx context.Context, token string, userID string, update TenantUpdate) error {
+	user, err := p.authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+	if user.ID != userID {
+		return ForbiddenError
+	}
+
+	orgUpdate := update.OrgName != nil || update.OrgDescription != nil || update.OrgLogoURL != nil || update.OrgWebsiteURL != nil
+	if orgUpdate && user.Role != tenant.RoleRoot {
+		return ForbiddenError
+	}
+
+	org, err := p.store.Orgs.Get(ctx, user.OrgID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get org")
+	}
+
+	if orgUpdate {
+		org.Name = valueOr(update.OrgName, org.Name)
+		org.Description = valueOr(update.OrgDescription, org.Description)
+		org.LogoURL = valueOr(update.OrgLogoURL, org.LogoURL)
+		org.WebsiteURL = valueOr(update.OrgWebsiteURL, org.WebsiteURL)
+		if err = p.store.Orgs.Save(ctx, &org); err != nil {
+			return errors.Wrap(err, "failed to save org")
+		}
+	}
+
+	if update.Name != nil {
+		user.Name = *update.Name
+		user.Org = org
+		if err = p.store.Users.Save(ctx, &user); err != nil {
+			return errors.Wrap(err, "failed to save user")
+		}
+	}
+	return nil
+}
+
+// valueOr returns the new value if one was given, or the current one
+func valueOr(value *string, current string) string {
+	if value == nil {
+		return current
+	}
+	return *value
+}
+
+// userByEmail returns the user with the email and their credential
+func (p *localProvider) userByEmail(ctx context.Context, email string) (tenant.User, tenant.LocalCredential, error) {
+	user, err := p.store.Users.GetByEmail(ctx, email)
+	if err != nil {
+		return tenant.User{}, tenant.LocalCredential{}, errors.Wrap(err, "failed to get user")
+	}
+
+	credential, err := p.store.Credentials.Get(ctx, user.ID)
+	if err != nil {
+		return tenant.User{}, tenant.LocalCredential{}, errors.Wrap(err, "failed to get credential")
+	}
+	return user, credential, nil
+}
+
+// VerificationToken creates a new verification token, replacing earlier ones
+func (p *localProvider) VerificationToken(ctx context.Context, email string) (string, error) {
+	user, credential, err := p.userByEmail(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if credential.IsEmailVerified() {
+		return "", errors.New("email address is already verified")
+	}
+
+	if err = p.store.Credentials.DeleteTokens(ctx, user.ID, tenant.AuthTokenVerifyEmail); err != nil {
+		return "", errors.Wrap(err, "failed to delete verification tokens")
+	}
+	return p.createToken(ctx, user.ID, tenant.AuthTokenVerifyEmail, time.Now().Add(verificationTokenTTL))
+}
+
+func (p *localProvider) VerifyEmail(ctx context.Context, email string, token string) error {
+	user, err := p.consumeEmailToken(ctx, email, tenant.AuthTokenVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+
+	credential, err := p.store.Credentials.Get(ctx, user.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get credential")
+	}
+
+	if !credential.IsEmailVerified() {
+		credential.EmailVerifiedAt = utils.ToPtr(time.Now())
+	}
+	return errors.Wrap(p.store.Credentials.Save(ctx, &credential), "failed to save credential")
+}
+
+// PasswordResetToken creates a new reset token, replacing earlier ones. Users synced from Omnistrate
+// get one as well, resetting the password is how they get a local one.
+func (p *localProvider) PasswordResetToken(ctx context.Context, email string) (string, error) {
+	user, err := p.store.Users.GetByEmail(ctx, email)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get user")
+	}
+
+	if err = p.store.Credentials.DeleteTokens(ctx, user.ID, tenant.AuthTokenResetPassword); err != nil {
+		return "", errors.Wrap(err, "failed to delete reset tokens")
+	}
+	return p.createToken(ctx, user.ID, tenant.AuthTokenResetPassword, time.Now().Add(resetTokenTTL))
+}
+
+// ResetPassword sets the new password and ends every session of the user, access tokens are
+// rejected from now on and refresh tokens are deleted. Users synced from Omnistrate get their
+// credential created.
+func (p *localProvider) ResetPassword(ctx context.Context, email string, token string, password string) error {
+	user, err := p.consumeEmailToken(ctx, email, tenant.AuthTokenResetPassword, token)
+	if err != nil {
+		return err
+	}
+
+	credential, err := p.store.Credentials.Get(ctx, user.ID)
+	if errors.Is(err, model.ErrNotFound) {
+		credential = tenant.LocalCredential{UserID: user.ID}
+	} else if err != nil {
+		return errors.Wrap(err, "failed to get credential")
+	}
+
+	if credential.PasswordHash, err = hashPassword(password); err != nil {
+		return err
+	}
+	credential.SessionVersion++
+	// The link was sent to the address, which proves the user owns it
+	if !credential.IsEmailVerified() {
+		credential.EmailVerifiedAt = utils.ToPtr(time.Now())
+	}
+	if err = p.store.Credentials.Save(ctx, &credential); err != nil {
+		return errors.Wrap(err, "failed to save credential")
+	}
+
+	return errors.Wrap(p.store.Credentials.DeleteTokens(ctx, user.ID, tenant.AuthTokenRefresh), "failed to delete refresh tokens")
+}
+
+// consumeEmailToken uses up a token sent to the user's email. Unknown emails and wrong, used or
+// expired tokens are reported as ErrInvalidToken.
+func (p *localProvider) consumeEmailToken(ctx context.Context, email string, kind string, token string) (tenant.User, error) {
+	user, err := p.store.Users.GetByEmail(ctx, email)
+	if errors.Is(err, model.ErrNotFound) {
+		return user, newError(ErrInvalidToken, "", nil)
+	} else if err != nil {
+		return user, errors.Wrap(err, "failed to get user")
+	}
+
+	consumed, err := p.store.Credentials.ConsumeToken(ctx, kind, hashOpaqueToken(token), time.Now())
+	if errors.Is(err, model.ErrNotFound) || (err == nil && consumed.UserID != user.ID) {
+		return user, newError(ErrInvalidToken, "", nil)
+	} else if err != nil {
+		return user, errors.Wrap(err, "failed to consume token")
+	}
+	return user, nil
+}
+
+func (p *localProvider) DeleteUser(ctx context.Context, userID string) error {
+	return errors.Wrap(p.store.Credentials.Delete(ctx, userID), "failed to delete credential")
+}
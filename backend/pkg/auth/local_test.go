@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store/storetest"
+)
+
+func testLocalProvider(t *testing.T) *localProvider {
+	t.Helper()
+
+	return newLocalProvider(config.AuthConfig{
+		JWTSecret:       "0123456789abcdef0123456789abcdef",
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: time.Hour,
+	}, storetest.New(dbtest.Open(t)))
+}
+
+// signUpVerified creates a local account with a verified email and signs it in
+func signUpVerified(t *testing.T, p *localProvider, email string, password string) Session {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := p.SignUp(ctx, SignupRequest{Email: email, Password: password, Name: "Jane", LegalCompanyName: "Acme"}); err != nil {
+		t.Fatalf("failed to sign up: %v", err)
+	}
+	token, err := p.VerificationToken(ctx, email)
+	if err != nil {
+		t.Fatalf("failed to create verification token: %v", err)
+	}
+	if err = p.VerifyEmail(ctx, email, token); err != nil {
+		t.Fatalf("failed to verify email: %v", err)
+	}
+
+	session, err := p.SignIn(ctx, email, password)
+	if err != nil {
+		t.Fatalf("failed to sign in: %v", err)
+	}
+	return session
+}
+
+func TestResetPasswordEndsSessions(t *testing.T) {
+	ctx := context.Background()
+	p := testLocalProvider(t)
+	session := signUpVerified(t, p, "jane@acme.example", "old password 123")
+
+	if _, err := p.Describe(ctx, session.Token); err != nil {
+		t.Fatalf("access token rejected before the reset: %v", err)
+	}
+
+	token, err := p.PasswordResetToken(ctx, "jane@acme.example")
+	if err != nil {
+		t.Fatalf("failed to create reset token: %v", err)
+	}
+	if err = p.ResetPassword(ctx, "jane@acme.example", token, "new password 123"); err != nil {
+		t.Fatalf("failed to reset password: %v", err)
+	}
+
+	if _, err = p.Describe(ctx, session.Token); !errors.Is(err, ForbiddenError) {
+		t.Errorf("Describe with an access token from before the reset = %v, want %v", err, ForbiddenError)
+	}
+	if _, err = p.Refresh(ctx, session.RefreshToken); !errors.Is(err, ForbiddenError) {
+		t.Errorf("Refresh with a refresh token from before the reset = %v, want %v", err, ForbiddenError)
+	}
+
+	renewed, err := p.SignIn(ctx, "jane@acme.example", "new password 123")
+	if err != nil {
+		t.Fatalf("failed to sign in with the new password: %v", err)
+	}
+	if _, err = p.Describe(ctx, renewed.Token); err != nil {
+		t.Errorf("access token from after the reset rejected: %v", err)
+	}
+}
+
+func TestResetPasswordOfSyncedUser(t *testing.T) {
+	ctx := context.Background()
+	p := testLocalProvider(t)
+
+	// Known from Omnistrate, without a local password
+	user := tenant.User{ID: "user-1", Email: "sam@acme.example", OrgID: "org-1", Role: tenant.RoleRoot}
+	if err := p.store.SyncUser(ctx, user); err != nil {
+		t.Fatalf("failed to store user: %v", err)
+	}
+	if _, err := p.SignIn(ctx, "sam@acme.example", "any password 123"); !errors.Is(err, ForbiddenError) {
+		t.Fatalf("SignIn without a local password = %v, want %v", err, ForbiddenError)
+	}
+
+	token, err := p.PasswordResetToken(ctx, "sam@acme.example")
+	if err != nil {
+		t.Fatalf("failed to create reset token: %v", err)
+	}
+	if err = p.ResetPassword(ctx, "sam@acme.example", token, "new password 123"); err != nil {
+		t.Fatalf("failed to reset password: %v", err)
+	}
+
+	session, err := p.SignIn(ctx, "sam@acme.example", "new password 123")
+	if err != nil {
+		t.Fatalf("failed to sign in after the reset: %v", err)
+	}
+	if _, err = p.Describe(ctx, session.Token); err != nil {
+		t.Errorf("access token rejected: %v", err)
+	}
+}
+
+func TestEmailsIgnoreCase(t *testing.T) {
+	ctx := context.Background()
+	p := testLocalProvider(t)
+	signUpVerified(t, p, "Jane@Acme.example", "a password 123")
+
+	err := p.SignUp(ctx, SignupRequest{Email: "jane@acme.example", Password: "a password 123", Name: "Jane", LegalCompanyName: "Acme"})
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("SignUp with the email in other case = %v, want %v", err, ErrAlreadyExists)
+	}
+	if _, err = p.SignIn(ctx, "JANE@acme.example", "a password 123"); err != nil {
+		t.Errorf("SignIn with the email in other case failed: %v", err)
+	}
+	token, err := p.PasswordResetToken(ctx, "jane@ACME.example")
+	if err != nil {
+		t.Fatalf("failed to create reset token: %v", err)
+	}
+	if err = p.ResetPassword(ctx, "jane@acme.EXAMPLE", token, "new password 123"); err != nil {
+		t.Errorf("ResetPassword with the email in other case failed: %v", err)
+	}
+}
+
+func TestTokensAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	p := testLocalProvider(t)
+	session := signUpVerified(t, p, "jane@acme.example", "a password 123")
+
+	resetToken, err := p.PasswordResetToken(ctx, "jane@acme.example")
+	if err != nil {
+		t.Fatalf("failed to create reset token: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		use  func() error
+		want error
+	}{
+		{
+			name: "refresh token",
+			use: func() error {
+				_, err := p.Refresh(ctx, session.RefreshToken)
+				return err
+			},
+			want: ForbiddenError,
+		},
+		{
+			name: "reset token",
+			use: func() error {
+				return p.ResetPassword(ctx, "jane@acme.example", resetToken, "a new password 123")
+			},
+			want: ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.use(); err != nil {
+				t.Fatalf("first use failed: %v", err)
+			}
+			if err := tt.use(); !errors.Is(err, tt.want) {
+				t.Errorf("second use error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsumeToken(t *testing.T) {
+	ctx := context.Background()
+	credentials := tenant.NewGormCredentialRepository(dbtest.Open(t))
+	now := time.Now()
+
+	for _, token := range []tenant.AuthToken{
+		{Hash: "valid", Kind: tenant.AuthTokenResetPassword, UserID: "user-1", ExpiresAt: now.Add(time.Hour)},
+		{Hash: "expired", Kind: tenant.AuthTokenResetPassword, UserID: "user-1", ExpiresAt: now.Add(-time.Second)},
+	} {
+		if err := credentials.CreateToken(ctx, &token); err != nil {
+			t.Fatalf("failed to create token: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		kind    string
+		hash    string
+		wantErr bool
+	}{
+		{name: "other kind", kind: tenant.AuthTokenVerifyEmail, hash: "valid", wantErr: true},
+		{name: "unknown", kind: tenant.AuthTokenResetPassword, hash: "unknown", wantErr: true},
+		{name: "expired", kind: tenant.AuthTokenResetPassword, hash: "expired", wantErr: true},
+		{name: "valid", kind: tenant.AuthTokenResetPassword, hash: "valid"},
+		{name: "used", kind: tenant.AuthTokenResetPassword, hash: "valid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := credentials.ConsumeToken(ctx, tt.kind, tt.hash, now)
+			if tt.wantErr {
+				if !errors.Is(err, model.ErrNotFound) {
+					t.Errorf("ConsumeToken(%q) error = %v, want %v", tt.hash, err, model.ErrNotFound)
+				}
+				return
+			}
+			if err != nil || token.UserID != "user-1" {
+				t.Errorf("ConsumeToken(%q) = %+v, %v, want the token of user-1", tt.hash, token, err)
+			}
+		})
+	}
+}
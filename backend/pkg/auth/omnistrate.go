@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/pkg/errors"
+)
+
+// omnistrateProvider manages the accounts as customers of the service in Omnistrate. Omnistrate issues
+// the access tokens and creates the verification and reset tokens.
+type omnistrateProvider struct {
+	omnistrateAdminService *utils.OmnistrateServiceAdmin
+	metrics                *metrics.Metrics
+}
+
+func newOmnistrateProvider(metricsServer *metrics.Metrics) *omnistrateProvider {
+	return &omnistrateProvider{
+		omnistrateAdminService: utils.OmnistrateServiceAdminInstance(),
+		metrics:                metricsServer,
+	}
+}
+
+// countUpstreamFailure counts calls that failed because Omnistrate did, not because of the request
+func (p *omnistrateProvider) countUpstreamFailure(httpResult *http.Response, err error, operation string) {
+	if utils.IsUpstreamFailure(httpResult, err) {
+		p.metrics.IncrementUpstreamErrors(metrics.UpstreamOmnistrate, operation)
+	}
+}
+
+func (p *omnistrateProvider) SignUp(ctx context.Context, request SignupRequest) (err error) {
+	customerSignupRequestBody := &openapiclientv1.CustomerSignupRequest2{
+		CompanyDescription: optional(request.CompanyDescription),
+		CompanyUrl:         optional(request.CompanyURL),
+		Email:              request.Email,
+		LegalCompanyName:   utils.ToPtr(request.LegalCompanyName),
+		Name:               request.Name,
+		Password:           request.Password,
+	}
+
+	var httpResult *http.Response
+	if httpResult, err = p.omnistrateAdminService.TenantSignUp(ctx, *customerSignupRequestBody); err != nil {
+		p.countUpstreamFailure(httpResult, err, "customer_signup")
+		return classifyError(httpResult, err, "failed to execute tenant signup request")
+	}
+
+	if httpResult.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to signup tenant: %s", httpResult.Status)
+	}
+	return nil
+}
+
+// optional returns nil for empty values, so Omnistrate does not validate fields that were not given
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func (p *omnistrateProvider) SignIn(ctx context.Context, email string, password string) (session Session, err error) {
+	customerSigninRequestBody := &openapiclientv1.CustomerSigninRequest2{
+		Email:    email,
+		Password: utils.ToPtr(password),
+	}
+
+	var signinResult *openapiclientv1.CustomerSigninResult
+	var httpResult *http.Response
+	if signinResult, httpResult, err = p.omnistrateAdminService.TenantSignIn(ctx, *customerSigninRequestBody); err != nil {
+		p.countUpstreamFailure(httpResult, err, "customer_signin")
+		err = classifyError(httpResult, err, "failed to execute tenant signin request")
+		return
+	}
+
+	session.Token = signinResult.JwtToken
+	return
+}
+
+// Refresh is not offered, Omnistrate does not issue refresh tokens. Users sign in again instead.
+func (p *omnistrateProvider) Refresh(ctx context.Context, refreshToken string) (Session, error) {
+	return Session{}, ErrNotSupported
+}
+
+func (p *omnistrateProvider) Describe(ctx context.Context, token string) (user tenant.User, err error) {
+	ctx = context.WithValue(ctx, openapiclientv1.ContextAccessToken, token)
+	userHandle := utils.GetOmnistrateAPIClient().UsersApiAPI.UsersApiDescribeUser(ctx)
+
+	var result *openapiclientv1.DescribeUserResult
+	var httpResult *http.Response
+	if result, httpResult, err = userHandle.Execute(); err != nil {
+		p.countUpstreamFailure(httpResult, err, "describe_user")
+		err = classifyError(httpResult, err, "failed to execute describe user request")
+		return
+	}
+
+	user = tenant.User{
+		ID:    result.Id,
+		Email: utils.FromPtr(result.Email),
+		Name:  utils.FromPtr(result.Name),
+		OrgID: utils.FromPtr(result.OrgId),
+		Role:  utils.FromPtr(result.RoleType),
+		Org: tenant.Org{
+			ID:          utils.FromPtr(result.OrgId),
+			Name:        utils.FromPtr(result.OrgName),
+			Description: utils.FromPtr(result.OrgDescription),
+			LogoURL:     utils.FromPtr(result.OrgLogoURL),
+			WebsiteURL:  utils.FromPtr(result.OrgURL),
+		},
+	}
+	return
+}
+
+func (p *omnistrateProvider) Update(ctx context.Context, token string, userID string, update TenantUpdate) (err error) {
+	request := openapiclientv1.UpdateUserRequest2{
+		Name:           update.Name,
+		OrgName:        update.OrgName,
+		OrgDescription: update.OrgDescription,
+		OrgLogoURL:     update.OrgLogoURL,
+		OrgURL:         update.OrgWebsiteURL,
+	}
+
+	userCtx := context.WithValue(ctx, openapiclientv1.ContextAccessToken, token)
+
+	var httpResult *http.Response
+	if httpResult, err = utils.GetOmnistrateAPIClient().UsersApiAPI.UsersApiUpdateUser(userCtx, userID).UpdateUserRequest2(request).Execute(); err != nil {
+		p.countUpstreamFailure(httpResult, err, "update_user")
+		if httpResult != nil && httpResult.StatusCode == http.StatusForbidden {
+			return ForbiddenError
+		}
+		return errors.Wrap(err, "failed to execute update user request")
+	}
+	return nil
+}
+
+// VerificationToken returns the verification token Omnistrate created at signup. It is created once,
+// a resent email carries the token of the latest signup.
+func (p *omnistrateProvider) VerificationToken(ctx context.Context, email string) (string, error) {
+	return p.omnistrateAdminService.LatestTenantToken(ctx, email, utils.TenantSignUpEvent, time.Time{})
+}
+
+func (p *omnistrateProvider) VerifyEmail(ctx context.Context, email string, token string) (err error) {
+	var httpResult *http.Response
+	if httpResult, err = p.omnistrateAdminService.ValidateTenantToken(ctx, email, token); err != nil {
+		p.countUpstreamFailure(httpResult, err, "validate_token")
+		err = tokenError(classifyError(httpResult, err, "failed to execute validate token request"), httpResult)
+	}
+	return
+}
+
+func (p *omnistrateProvider) PasswordResetToken(ctx context.Context, email string) (string, error) {
+	return p.omnistrateAdminService.ResetTenantPassword(ctx, email)
+}
+
+func (p *omnistrateProvider) ResetPassword(ctx context.Context, email string, token string, password string) (err error) {
+	var httpResult *http.Response
+	if httpResult, err = p.omnistrateAdminService.ChangeTenantPassword(ctx, email, token, password); err != nil {
+		p.countUpstreamFailure(httpResult, err, "change_password")
+		err = tokenError(classifyError(httpResult, err, "failed to execute change password request"), httpResult)
+	}
+	return
+}
+
+func (p *omnistrateProvider) DeleteUser(ctx context.Context, userID string) (err error) {
+	if err = p.omnistrateAdminService.DeleteTenantUser(ctx, userID); err != nil {
+		p.metrics.IncrementUpstreamErrors(metrics.UpstreamOmnistrate, "delete_user")
+		err = errors.Wrap(err, "failed to delete user from Omnistrate")
+	}
+	return
+}
+
+// tokenError reports rejected tokens as ErrInvalidToken. Password policy violations and upstream
+// failures are passed on.
+func tokenError(err error, httpResult *http.Response) error {
+	if errors.Is(err, ErrInvalidPassword) || errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUpstreamUnavailable) || errors.Is(err, ErrUpstreamTimeout) {
+		return err
+	}
+	if errors.Is(err, ForbiddenError) || errors.Is(err, ErrInvalidInput) || (httpResult != nil && httpResult.StatusCode == http.StatusNotFound) {
+		return newError(ErrInvalidToken, "", err)
+	}
+	return err
+}
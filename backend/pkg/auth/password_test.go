@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("hashPassword() = %q, want an argon2id hash with the configured parameters", hash)
+	}
+
+	again, err := hashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	if again == hash {
+		t.Errorf("hashPassword() returned the same hash twice, want a new salt each time")
+	}
+
+	// Hashes keep their parameters, stronger ones can be introduced without breaking older hashes
+	salt := []byte("saltsalt")
+	weaker := fmt.Sprintf("$argon2id$v=%d$m=8,t=1,p=1$%s$%s", argon2.Version, base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("password"), salt, 1, 8, 1, 32)))
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "matching", hash: hash, password: "correct horse battery staple", want: true},
+		{name: "matching other salt", hash: again, password: "correct horse battery staple", want: true},
+		{name: "wrong password", hash: hash, password: "correct horse battery stapl", want: false},
+		{name: "empty password", hash: hash, password: "", want: false},
+		{name: "other parameters", hash: weaker, password: "password", want: true},
+		{name: "other parameters wrong password", hash: weaker, password: "Password", want: false},
+		{name: "bcrypt", hash: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", password: "password", wantErr: true},
+		{name: "other argon2 version", hash: strings.Replace(hash, "v=19", "v=16", 1), password: "correct horse battery staple", wantErr: true},
+		{name: "malformed salt", hash: "$argon2id$v=19$m=8,t=1,p=1$!!!$AAAA", password: "password", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkPassword(tt.hash, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkPassword() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("checkPassword() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
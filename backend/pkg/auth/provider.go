@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+)
+
+// Provider manages the accounts and issues the access tokens Auth works with. Both implementations
+// report failures with the errors of this package, so handlers behave the same on either.
+type Provider interface {
+	// SignUp creates the user and their org. The user cannot sign in before the email is verified.
+	SignUp(ctx context.Context, request SignupRequest) error
+
+	// SignIn checks the credentials and starts a session
+	SignIn(ctx context.Context, email string, password string) (Session, error)
+
+	// Refresh exchanges a refresh token for a new session. The refresh token cannot be used again.
+	Refresh(ctx context.Context, refreshToken string) (Session, error)
+
+	// Describe returns the user an access token belongs to
+	Describe(ctx context.Context, token string) (tenant.User, error)
+
+	// Update changes the profile of the user and their org, acting as the user
+	Update(ctx context.Context, token string, userID string, update TenantUpdate) error
+
+	// VerificationToken returns the token sent in verification links
+	VerificationToken(ctx context.Context, email string) (string, error)
+	VerifyEmail(ctx context.Context, email string, token string) error
+
+	// PasswordResetToken starts a password reset and returns the token sent in reset links
+	PasswordResetToken(ctx context.Context, email string) (string, error)
+	ResetPassword(ctx context.Context, email string, token string, password string) error
+
+	// DeleteUser removes the account. Users that are already gone are not an error.
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+// Session is the result of signing in
+type Session struct {
+	Token string
+	// RefreshToken and ExpiresAt are empty for providers that do not issue refresh tokens
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// NewProvider returns the provider selected by AUTH_PROVIDER
+func NewProvider(cfg config.AuthConfig, metricsServer *metrics.Metrics, dataStore *store.Store) Provider {
+	if cfg.Provider == config.AuthProviderLocal {
+		return newLocalProvider(cfg, dataStore)
+	}
+	return newOmnistrateProvider(metricsServer)
+}
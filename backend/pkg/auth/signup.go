@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 128
+	maxFieldLength    = 255
+)
+
+// SignupRequest is the account to create for a new customer
+type SignupRequest struct {
+	Email              string `json:"email"`
+	Password           string `json:"password"`
+	Name               string `json:"name"`
+	LegalCompanyName   string `json:"legal_company_name"`
+	CompanyDescription string `json:"company_description"`
+	CompanyURL         string `json:"company_url"`
+}
+
+// Normalize trims surrounding whitespace from everything but the password and lowercases the email
+func (r *SignupRequest) Normalize() {
+	r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+	r.Name = strings.TrimSpace(r.Name)
+	r.LegalCompanyName = strings.TrimSpace(r.LegalCompanyName)
+	r.CompanyDescription = strings.TrimSpace(r.CompanyDescription)
+	r.CompanyURL = strings.TrimSpace(r.CompanyURL)
+}
+
+// Validate checks the request before it is passed to the provider. The error is an *Error of kind
+// ErrInvalidInput or ErrInvalidPassword and names every problem found.
+func (r SignupRequest) Validate() error {
+	var problems []string
+
+	if address, err := mail.ParseAddress(r.Email); err != nil || address.Address != r.Email {
+		problems = append(problems, "email must be a valid email address")
+	}
+
+	if r.Name == "" {
+		problems = append(problems, "name is required")
+	} else if utf8.RuneCountInString(r.Name) > maxFieldLength {
+		problems = append(problems, "name is too long")
+	}
+
+	if r.LegalCompanyName == "" {
+		problems = append(problems, "legal_company_name is required")
+	} else if utf8.RuneCountInString(r.LegalCompanyName) > maxFieldLength {
+		problems = append(problems, "legal_company_name is too long")
+	}
+
+	if r.CompanyURL != "" && !utils.IsHTTPURL(r.CompanyURL) {
+		problems = append(problems, "company_url must be an http or https URL")
+	}
+
+	if len(problems) > 0 {
+		return newError(ErrInvalidInput, strings.Join(problems, ", "), nil)
+	}
+
+	return validatePassword(r.Password)
+}
+
+// validatePassword checks the length only, the Omnistrate provider enforces its own rules on top
+func validatePassword(password string) error {
+	if length := utf8.RuneCountInString(password); length < minPasswordLength || length > maxPasswordLength {
+		return newError(ErrInvalidPassword, fmt.Sprintf("password must be between %d and %d characters", minPasswordLength, maxPasswordLength), nil)
+	}
+	return nil
+}
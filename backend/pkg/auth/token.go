@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tokenIssuer identifies access tokens signed by the local provider
+const tokenIssuer = "ai-chatbot"
+
+// tokenHeader is the encoded JWT header of every access token, only HS256 is issued and accepted
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+var errInvalidAccessToken = errors.New("invalid access token")
+
+// accessClaims are the claims of an access token issued by the local provider
+type accessClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// Version is the session version of the user's credential when the token was issued
+	Version int `json:"ver,omitempty"`
+}
+
+// signAccessToken returns an HS256 JWT for the user, valid for ttl
+func signAccessToken(key []byte, userID string, version int, now time.Time, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := now.Add(ttl)
+	payload, err := json.Marshal(accessClaims{
+		Issuer:    tokenIssuer,
+		Subject:   userID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		Version:   version,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + tokenSignature(key, unsigned), expiresAt, nil
+}
+
+// parseAccessToken checks the signature and expiry of an access token and returns its claims
+func parseAccessToken(key []byte, token string, now time.Time) (accessClaims, error) {
+	var claims accessClaims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return claims, errInvalidAccessToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(tokenSignature(key, parts[0]+"."+parts[1]))) {
+		return claims, errInvalidAccessToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return claims, errInvalidAccessToken
+	}
+	if claims.Issuer != tokenIssuer || claims.Subject == "" || now.Unix() >= claims.ExpiresAt {
+		return claims, errInvalidAccessToken
+	}
+	return claims, nil
+}
+
+func tokenSignature(key []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newOpaqueToken returns a random token for refresh, verification and reset links, and the hash
+// under which it is stored
+func newOpaqueToken() (token string, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return "", "", errors.Wrap(err, "failed to generate token")
+	}
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashOpaqueToken(token), nil
+}
+
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessToken(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Unix(1700000000, 0)
+
+	token, expiresAt, err := signAccessToken(key, "user-1", 3, now, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to sign access token: %v", err)
+	}
+	if !expiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("expiresAt = %v, want %v", expiresAt, now.Add(time.Hour))
+	}
+
+	parts := strings.Split(token, ".")
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	otherPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"ai-chatbot","sub":"user-2","iat":1700000000,"exp":1700003600}`))
+
+	tests := []struct {
+		name    string
+		key     []byte
+		token   string
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "valid", key: key, token: token, now: now},
+		{name: "just before expiry", key: key, token: token, now: now.Add(time.Hour - time.Second)},
+		{name: "expired", key: key, token: token, now: now.Add(time.Hour), wantErr: true},
+		{name: "other key", key: []byte("fedcba9876543210fedcba9876543210"), token: token, now: now, wantErr: true},
+		{name: "changed payload", key: key, token: parts[0] + "." + otherPayload + "." + parts[2], now: now, wantErr: true},
+		{name: "unsigned", key: key, token: noneHeader + "." + parts[1] + ".", now: now, wantErr: true},
+		{name: "missing signature", key: key, token: parts[0] + "." + parts[1], now: now, wantErr: true},
+		{name: "garbage", key: key, token: "not a token", now: now, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := parseAccessToken(tt.key, tt.token, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAccessToken() error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if claims.Subject != "user-1" || claims.Version != 3 || claims.Issuer != tokenIssuer {
+				t.Errorf("parseAccessToken() = %+v, want subject user-1 and version 3", claims)
+			}
+		})
+	}
+}
+
+func TestOpaqueToken(t *testing.T) {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	if hash != hashOpaqueToken(token) || hash == token {
+		t.Errorf("newOpaqueToken() hash = %q, want the hash of %q", hash, token)
+	}
+
+	other, _, err := newOpaqueToken()
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	if other == token {
+		t.Errorf("newOpaqueToken() returned %q twice", token)
+	}
+}
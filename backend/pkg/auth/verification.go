@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/mail"
+	"github.com/omnistrate-community/ai-chatbot/pkg/tracing"
+	"github.com/pkg/errors"
+)
+
+// SendVerification emails the customer a link proving they own the address. The link carries the
+// verification token the provider created at signup.
+func (a *Auth) SendVerification(ctx context.Context, email string) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.SendVerification")
+	defer func() { tracing.End(span, err) }()
+
+	var token string
+	if token, err = a.provider.VerificationToken(ctx, email); err != nil {
+		return errors.Wrap(err, "failed to get verification token")
+	}
+
+	return a.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Open this link to verify your email address and finish signing up:\n\n%s\n\n"+
+			"If you did not sign up, ignore this email.", accountLink("verify-email", email, token)),
+	})
+}
+
+// VerifyEmail marks the customer's email as verified with the token from the verification link
+func (a *Auth) VerifyEmail(ctx context.Context, email string, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.VerifyEmail")
+	defer func() { tracing.End(span, err) }()
+
+	return a.provider.VerifyEmail(ctx, strings.TrimSpace(email), token)
+}
+
+// RequestPasswordReset emails the customer a link to choose a new password. The provider creates the
+// reset token, it is only ever sent to the customer's address.
+func (a *Auth) RequestPasswordReset(ctx context.Context, email string) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.RequestPasswordReset")
+	defer func() { tracing.End(span, err) }()
+
+	var token string
+	if token, err = a.provider.PasswordResetToken(ctx, email); err != nil {
+		return errors.Wrap(err, "failed to reset password")
+	}
+
+	return a.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Open this link to choose a new password:\n\n%s\n\n"+
+			"If you did not ask for a new password, ignore this email. Your password stays unchanged.", accountLink("reset-password", email, token)),
+	})
+}
+
+// ResetPassword sets a new password with the token from the reset link
+func (a *Auth) ResetPassword(ctx context.Context, email string, token string, password string) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.ResetPassword")
+	defer func() { tracing.End(span, err) }()
+
+	if err = validatePassword(password); err != nil {
+		return
+	}
+
+	return a.provider.ResetPassword(ctx, strings.TrimSpace(email), token, password)
+}
+
+// accountLink returns the frontend page handling a verification or reset link
+func accountLink(page string, email string, token string) string {
+	query := url.Values{"email": {email}, "token": {token}}
+	return strings.TrimSuffix(config.Current.Mail.PublicURL, "/") + "/" + page + "?" + query.Encode()
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
 	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
 	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
 	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
 	"github.com/pkg/errors"
@@ -16,11 +17,15 @@ import (
 
 type Billing struct {
 	authHandler *auth.Auth
+	metrics     *metrics.Metrics
+	store       *store.Store
 }
 
-func NewBilling(metricsService *metrics.Metrics) *Billing {
+func NewBilling(metricsService *metrics.Metrics, dataStore *store.Store) *Billing {
 	return &Billing{
-		authHandler: auth.NewAuth(metricsService),
+		authHandler: auth.NewAuth(metricsService, dataStore),
+		metrics:     metricsService,
+		store:       dataStore,
 	}
 }
 
@@ -31,7 +36,7 @@ func (b *Billing) GetUsageHandler(ctx *gin.Context) {
 		if err != nil {
 			var serviceErr *openapiclientv1.GenericOpenAPIError
 			if errors.As(err, &serviceErr) {
-				log.Error().Err(err).Msgf("failed to get usage info: %s", string(serviceErr.Body()))
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to get usage info: %s", string(serviceErr.Body()))
 				return
 			}
 		}
@@ -45,6 +50,9 @@ func (b *Billing) GetUsageHandler(ctx *gin.Context) {
 	var httpResult *http.Response
 	var usage *openapiclientv1.GetConsumptionUsageResult
 	if usage, httpResult, err = usageHandle.Execute(); err != nil {
+		if utils.IsUpstreamFailure(httpResult, err) {
+			b.metrics.IncrementUpstreamErrors(metrics.UpstreamOmnistrate, "get_consumption_usage")
+		}
 		ctx.JSON(500, gin.H{"error": errors.Wrap(err, "failed to execute usage request")})
 		return
 	}
@@ -70,7 +78,7 @@ func (b *Billing) GetPerDayUsageHandler(ctx *gin.Context) {
 		if err != nil {
 			var serviceErr *openapiclientv1.GenericOpenAPIError
 			if errors.As(err, &serviceErr) {
-				log.Error().Err(err).Msgf("failed to get usage info: %s", string(serviceErr.Body()))
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to get usage info: %s", string(serviceErr.Body()))
 				return
 			}
 		}
@@ -104,6 +112,9 @@ func (b *Billing) GetPerDayUsageHandler(ctx *gin.Context) {
 	var httpResult *http.Response
 	var usage *openapiclientv1.GetConsumptionUsageResult
 	if usage, httpResult, err = usageHandle.Execute(); err != nil {
+		if utils.IsUpstreamFailure(httpResult, err) {
+			b.metrics.IncrementUpstreamErrors(metrics.UpstreamOmnistrate, "get_consumption_usage")
+		}
 		ctx.JSON(500, gin.H{"error": errors.Wrap(err, "failed to execute usage request")})
 		return
 	}
@@ -121,3 +132,23 @@ func (b *Billing) GetPerDayUsageHandler(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, gin.H{"usage": usage})
 }
+
+// NoUsageHandler answers both usage routes when the local provider manages the accounts. Omnistrate
+// meters no consumption for them, so the usage is empty, in the shape the Omnistrate routes answer.
+func (b *Billing) NoUsageHandler(ctx *gin.Context) {
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	if _, err := b.authHandler.DescribeTenant(ctx.Request.Context(), jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to describe tenant")
+		ctx.JSON(500, gin.H{"error": "internal error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"usage": openapiclientv1.GetConsumptionUsageResult{Usage: []openapiclientv1.UsagePerDimension{}}})
+}
@@ -0,0 +1,83 @@
+package billing
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultUsageExportDays = 30
+
+// UsageExportHandler exports the per-tenant usage ledger for billing. It is meant for the service
+// operator and authenticated with USAGE_EXPORT_TOKEN, not with a tenant token.
+func (b *Billing) UsageExportHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to export usage")
+		}
+	}()
+
+	// The export is disabled unless a token is configured
+	if config.Current.Metrics.UsageExportToken == "" {
+		ctx.JSON(404, gin.H{"error": "not found"})
+		return
+	}
+
+	token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(config.Current.Metrics.UsageExportToken)) != 1 {
+		ctx.JSON(403, gin.H{"error": "forbidden"})
+		return
+	}
+
+	now := time.Now()
+	fromDay := ctx.DefaultQuery("start", tenant.UsageDay(now.AddDate(0, 0, -defaultUsageExportDays)))
+	toDay := ctx.DefaultQuery("end", tenant.UsageDay(now))
+	for _, day := range []string{fromDay, toDay} {
+		if _, parseErr := time.Parse(tenant.UsageDayFormat, day); parseErr != nil {
+			ctx.JSON(400, gin.H{"error": errors.Wrap(parseErr, "dates must be formatted as YYYY-MM-DD").Error()})
+			return
+		}
+	}
+
+	var records []tenant.UsageRecord
+	if records, err = b.store.Usage.List(ctx.Request.Context(), fromDay, toDay); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ctx.Query("format") != "csv" {
+		ctx.JSON(http.StatusOK, gin.H{"start": fromDay, "end": toDay, "usage": records})
+		return
+	}
+
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", `attachment; filename="usage-`+fromDay+`-`+toDay+`.csv"`)
+	ctx.Status(http.StatusOK)
+
+	writer := csv.NewWriter(ctx.Writer)
+	_ = writer.Write([]string{"day", "organization_id", "user_id", "requests", "request_tokens", "response_tokens", "threads_created"})
+	for _, record := range records {
+		_ = writer.Write([]string{
+			record.Day,
+			record.OrgID,
+			record.UserID,
+			strconv.FormatInt(record.Requests, 10),
+			strconv.FormatInt(record.RequestTokens, 10),
+			strconv.FormatInt(record.ResponseTokens, 10),
+			strconv.FormatInt(record.ThreadsCreated, 10),
+		})
+	}
+	writer.Flush()
+	err = writer.Error()
+}
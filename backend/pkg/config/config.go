@@ -1,7 +1,12 @@
 package config
 
 import (
-	"os"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 )
 
 const (
@@ -9,24 +14,586 @@ const (
 	ModelProviderVLLM   = "vllm"
 )
 
-var OmnistrateUsername string
-var OmnistratePassword string
-var ModelProvider string
-var ModelProviderEndpoint string
-var ModelProviderAPIKey string
-var Model string
-var APIPrefix string
-
-func init() {
-	// Load Omnistrate service account credentials
-	OmnistrateUsername = os.Getenv("OMNISTRATE_USERNAME")
-	OmnistratePassword = os.Getenv("OMNISTRATE_PASSWORD")
-	ModelProvider = os.Getenv("MODEL_PROVIDER")
-	Model = os.Getenv("MODEL")
-	ModelProviderEndpoint = os.Getenv("MODEL_PROVIDER_ENDPOINT")
-	ModelProviderAPIKey = os.Getenv("MODEL_PROVIDER_API_KEY")
-	APIPrefix = os.Getenv("API_PREFIX")
-	if APIPrefix == "" {
-		APIPrefix = "/api"
+// Label policies for per-tenant Prometheus metrics
+const (
+	MetricsLabelPolicyOrg    = "org"    // organization_id only
+	MetricsLabelPolicyHashed = "hashed" // organization_id and a hashed user_id
+	MetricsLabelPolicyFull   = "full"   // organization_id, user_id and email, high cardinality and contains PII
+)
+
+const (
+	DatabaseDriverPostgres = "postgres"
+	DatabaseDriverSQLite   = "sqlite"
+)
+
+// Current is the effective configuration. It holds the defaults until Load replaces it at startup.
+var Current = Defaults()
+
+// Config is the complete backend configuration. Every setting can be given in the YAML file named
+// by CONFIG_FILE and overridden by the environment variable in its env tag. Settings tagged secret
+// can also be read from the file named by the same variable with a _FILE suffix, and are redacted
+// when the configuration is printed.
+type Config struct {
+	APIPrefix  string           `yaml:"api_prefix" env:"API_PREFIX"`
+	Server     ServerConfig     `yaml:"server"`
+	CORS       CORSConfig       `yaml:"cors"`
+	Security   SecurityConfig   `yaml:"security"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Auth       AuthConfig       `yaml:"auth"`
+	Omnistrate OmnistrateConfig `yaml:"omnistrate"`
+	Model      ModelConfig      `yaml:"model"`
+	Import     ImportConfig     `yaml:"import"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Health     HealthConfig     `yaml:"health"`
+	Encryption EncryptionConfig `yaml:"encryption"`
+	Redaction  RedactionConfig  `yaml:"redaction"`
+	Moderation ModerationConfig `yaml:"moderation"`
+	Retention  RetentionConfig  `yaml:"retention"`
+	Mail       MailConfig       `yaml:"mail"`
+}
+
+type ServerConfig struct {
+	ListenAddr        string        `yaml:"listen_addr" env:"LISTEN_ADDR"`
+	TLSCertFile       string        `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	// Queries answer only once generation finished, so this has to cover the slowest generation
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	// How long to wait for in-flight queries on SIGTERM, keep it below the orchestrator's grace period
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// Request body limit for routes that do not set their own
+	MaxBodyBytes int64 `yaml:"max_body_bytes" env:"SERVER_MAX_BODY_BYTES"`
+}
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// SecurityConfig controls the security headers sent with every response
+type SecurityConfig struct {
+	// HSTS is only sent on HTTPS requests, including those terminated by a proxy. Zero disables it.
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" env:"SECURITY_HSTS_MAX_AGE"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" env:"SECURITY_HSTS_INCLUDE_SUBDOMAINS"`
+	// X-Frame-Options value, empty disables the header
+	FrameOptions string `yaml:"frame_options" env:"SECURITY_FRAME_OPTIONS"`
+	// Policy for API responses, which never need to load anything
+	ContentSecurityPolicy string `yaml:"content_security_policy" env:"SECURITY_CONTENT_SECURITY_POLICY"`
+	// Policy for publicly shared threads rendered as HTML pages
+	ShareContentSecurityPolicy string `yaml:"share_content_security_policy" env:"SECURITY_SHARE_CONTENT_SECURITY_POLICY"`
+}
+
+type DatabaseConfig struct {
+	Driver     string `yaml:"driver" env:"DB_DRIVER"`
+	SQLitePath string `yaml:"sqlite_path" env:"DB_SQLITE_PATH"`
+	// URL takes precedence over the individual connection settings
+	URL      string `yaml:"url" env:"DATABASE_URL" secret:"true"`
+	Host     string `yaml:"host" env:"DB_HOST"`
+	Port     int    `yaml:"port" env:"DB_PORT"`
+	Name     string `yaml:"name" env:"DB_NAME"`
+	User     string `yaml:"user" env:"DB_USER"`
+	Password string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	// Read replica URLs or DSNs, used for list and search queries
+	ReadReplicaURLs []string `yaml:"read_replica_urls" env:"DB_READ_REPLICA_URLS" secret:"true"`
+	// TLS settings, see https://www.postgresql.org/docs/current/libpq-ssl.html
+	SSLMode     string `yaml:"sslmode" env:"DB_SSLMODE"`
+	SSLRootCert string `yaml:"sslrootcert" env:"DB_SSLROOTCERT"`
+	SSLCert     string `yaml:"sslcert" env:"DB_SSLCERT"`
+	SSLKey      string `yaml:"sslkey" env:"DB_SSLKEY"`
+	// Pool settings
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	// How long to keep retrying the initial connection, e.g. while Postgres is still starting
+	ConnectTimeout time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+	// Apply pending schema migrations when the server starts
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"DB_MIGRATE_ON_START"`
+}
+
+// Authentication providers
+const (
+	AuthProviderOmnistrate = "omnistrate"
+	AuthProviderLocal      = "local"
+)
+
+// AuthConfig selects who manages the accounts and issues access tokens
+type AuthConfig struct {
+	// Provider is omnistrate (customer accounts in Omnistrate) or local (accounts in the database, for
+	// deployments that cannot reach Omnistrate)
+	Provider string `yaml:"provider" env:"AUTH_PROVIDER"`
+	// JWTSecret signs the access tokens of the local provider, at least 32 bytes
+	JWTSecret string `yaml:"jwt_secret" env:"AUTH_JWT_SECRET" secret:"true"`
+	// Lifetimes of the local provider's access and refresh tokens
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"AUTH_ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"AUTH_REFRESH_TOKEN_TTL"`
+	// AutoVerifySignups marks new accounts as verified without proving that the user owns the email
+	// address
+	AutoVerifySignups bool `yaml:"auto_verify_signups" env:"AUTH_AUTO_VERIFY_SIGNUPS"`
+}
+
+// OmnistrateConfig holds the service account used for managing your service on https://omnistrate.cloud
+type OmnistrateConfig struct {
+	Username string `yaml:"username" env:"OMNISTRATE_USERNAME"`
+	Password string `yaml:"password" env:"OMNISTRATE_PASSWORD" secret:"true"`
+	// Timeout bounds a call to Omnistrate including its retries
+	Timeout time.Duration `yaml:"timeout" env:"OMNISTRATE_TIMEOUT"`
+	// MaxRetries is how often transient failures like rate limits and unavailability are retried
+	MaxRetries int `yaml:"max_retries" env:"OMNISTRATE_MAX_RETRIES"`
+}
+
+type ModelConfig struct {
+	Provider string `yaml:"provider" env:"MODEL_PROVIDER"`
+	Name     string `yaml:"name" env:"MODEL"`
+	// OpenAI compatible API base URL, the OpenAI API when empty
+	Endpoint string `yaml:"endpoint" env:"MODEL_PROVIDER_ENDPOINT"`
+	APIKey   string `yaml:"api_key" env:"MODEL_PROVIDER_API_KEY" secret:"true"`
+}
+
+// ImportConfig limits conversation imports
+type ImportConfig struct {
+	MaxBytes         int64 `yaml:"max_bytes" env:"IMPORT_MAX_BYTES"`
+	MaxConversations int   `yaml:"max_conversations" env:"IMPORT_MAX_CONVERSATIONS"`
+	MaxMessages      int   `yaml:"max_messages" env:"IMPORT_MAX_MESSAGES"`
+	MaxMessageBytes  int   `yaml:"max_message_bytes" env:"IMPORT_MAX_MESSAGE_BYTES"`
+}
+
+// MetricsConfig controls metrics labelling and the tenant usage export
+type MetricsConfig struct {
+	LabelPolicy      string        `yaml:"label_policy" env:"METRICS_LABEL_POLICY"`
+	LabelHashSalt    string        `yaml:"label_hash_salt" env:"METRICS_LABEL_HASH_SALT" secret:"true"`
+	RefreshInterval  time.Duration `yaml:"refresh_interval" env:"METRICS_REFRESH_INTERVAL"`
+	UsageExportToken string        `yaml:"usage_export_token" env:"USAGE_EXPORT_TOKEN" secret:"true"`
+}
+
+// HealthConfig controls readiness probes. Results are cached so orchestrator probes do not hammer the model provider.
+type HealthConfig struct {
+	CacheTTL     time.Duration `yaml:"cache_ttl" env:"HEALTH_CACHE_TTL"`
+	ProbeTimeout time.Duration `yaml:"probe_timeout" env:"HEALTH_PROBE_TIMEOUT"`
+}
+
+// EncryptionConfig holds the master keys wrapping the per-org data keys. Message content and thread
+// names are encrypted at rest once a master key or keyfile is configured.
+type EncryptionConfig struct {
+	// Base64 encoded 32 byte key
+	MasterKey string `yaml:"master_key" env:"ENCRYPTION_MASTER_KEY" secret:"true"`
+	// Master keys replaced by MasterKey, only used to unwrap data keys until they are rewrapped
+	PreviousMasterKeys []string `yaml:"previous_master_keys" env:"ENCRYPTION_PREVIOUS_MASTER_KEYS" secret:"true"`
+	// JSON keyfile with named master keys, an alternative to MasterKey
+	KeyFile string `yaml:"key_file" env:"ENCRYPTION_KEY_FILE"`
+	// How long unwrapped data keys are cached, bounds how long other replicas can decrypt after shredding
+	KeyCacheTTL time.Duration `yaml:"key_cache_ttl" env:"ENCRYPTION_KEY_CACHE_TTL"`
+}
+
+// RedactionConfig controls how personal data in prompts is handled before they are sent to the model
+type RedactionConfig struct {
+	// Action for categories an org has no policy for: redact, block or allow
+	DefaultAction string `yaml:"default_action" env:"PII_DEFAULT_ACTION"`
+}
+
+// Moderation classifiers
+const (
+	ModerationClassifierNone     = "none"
+	ModerationClassifierKeywords = "keywords"
+	ModerationClassifierOpenAI   = "openai"
+	ModerationClassifierLLM      = "llm"
+)
+
+// ModerationConfig selects the classifier checking queries and responses
+type ModerationConfig struct {
+	// Classifier is none, keywords, openai (moderation endpoint of the model provider) or llm (the configured model)
+	Classifier string `yaml:"classifier" env:"MODERATION_CLASSIFIER"`
+	// YAML file mapping categories to case-insensitive regular expressions, for the keywords classifier
+	KeywordsFile string `yaml:"keywords_file" env:"MODERATION_KEYWORDS_FILE"`
+	// Moderation model for the openai classifier
+	Model string `yaml:"model" env:"MODERATION_MODEL"`
+	// Action for flagged categories an org has no policy for: refuse, annotate or allow
+	DefaultAction string `yaml:"default_action" env:"MODERATION_DEFAULT_ACTION"`
+}
+
+// Mail transports
+const (
+	MailTransportLog  = "log"
+	MailTransportSMTP = "smtp"
+)
+
+// MailConfig selects how account emails like verification and password reset links are sent
+type MailConfig struct {
+	// Transport is log (write emails to the log, for development) or smtp
+	Transport    string `yaml:"transport" env:"MAIL_TRANSPORT"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	// SMTPTimeout bounds sending one email, from connecting to the server until it accepted the message
+	SMTPTimeout time.Duration `yaml:"smtp_timeout" env:"SMTP_TIMEOUT"`
+	// PublicURL is the address of the frontend, links in emails point to its pages
+	PublicURL string `yaml:"public_url" env:"PUBLIC_URL"`
+	// Cooldown is how long a verification or reset link cannot be requested again for the same address
+	Cooldown time.Duration `yaml:"cooldown" env:"MAIL_COOLDOWN"`
+	// MaxPerIP is how many verification and reset links one client IP can request per hour
+	MaxPerIP int `yaml:"max_per_ip" env:"MAIL_MAX_PER_IP"`
+	// MaxConcurrent bounds the emails being sent at once, further requests are refused
+	MaxConcurrent int `yaml:"max_concurrent" env:"MAIL_MAX_CONCURRENT"`
+}
+
+// RetentionConfig controls the background job enforcing the per-org retention policies
+type RetentionConfig struct {
+	Interval  time.Duration `yaml:"interval" env:"RETENTION_INTERVAL"`
+	BatchSize int           `yaml:"batch_size" env:"RETENTION_BATCH_SIZE"`
+}
+
+// Defaults returns the configuration used for every setting that is not configured explicitly
+func Defaults() *Config {
+	return &Config{
+		APIPrefix: "/api",
+		Server: ServerConfig{
+			ListenAddr:        ":8080",
+			ReadTimeout:       time.Minute,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      10 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   2 * time.Minute,
+			MaxBodyBytes:      1 << 20,
+		},
+		// No origin may call the API from the browser until it is listed, the frontend authenticates
+		// with bearer tokens, not cookies
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "Traceparent", "Tracestate", "X-Request-ID"},
+			ExposedHeaders: []string{"Content-Disposition", "X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		Security: SecurityConfig{
+			HSTSMaxAge:                 365 * 24 * time.Hour,
+			FrameOptions:               "DENY",
+			ContentSecurityPolicy:      "default-src 'none'; frame-ancestors 'none'",
+			ShareContentSecurityPolicy: "default-src 'none'; style-src 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+		},
+		Database: DatabaseConfig{
+			Driver:          DatabaseDriverPostgres,
+			SQLitePath:      "chatbot.db",
+			Port:            5432,
+			SSLMode:         "prefer",
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectTimeout:  time.Minute,
+		},
+		Auth: AuthConfig{
+			Provider:          AuthProviderOmnistrate,
+			AccessTokenTTL:    15 * time.Minute,
+			RefreshTokenTTL:   30 * 24 * time.Hour,
+			AutoVerifySignups: true,
+		},
+		Omnistrate: OmnistrateConfig{
+			Timeout:    30 * time.Second,
+			MaxRetries: 2,
+		},
+		Model: ModelConfig{
+			Provider: ModelProviderOpenAI,
+		},
+		Import: ImportConfig{
+			MaxBytes:         50 << 20,
+			MaxConversations: 1000,
+			MaxMessages:      5000,
+			MaxMessageBytes:  256 << 10,
+		},
+		Metrics: MetricsConfig{
+			LabelPolicy:     MetricsLabelPolicyOrg,
+			RefreshInterval: 5 * time.Minute,
+		},
+		Health: HealthConfig{
+			CacheTTL:     30 * time.Second,
+			ProbeTimeout: 5 * time.Second,
+		},
+		Encryption: EncryptionConfig{
+			KeyCacheTTL: 5 * time.Minute,
+		},
+		Redaction: RedactionConfig{
+			DefaultAction: "allow",
+		},
+		Moderation: ModerationConfig{
+			Classifier:    ModerationClassifierNone,
+			Model:         "omni-moderation-latest",
+			DefaultAction: "refuse",
+		},
+		Retention: RetentionConfig{
+			Interval:  time.Hour,
+			BatchSize: 1000,
+		},
+		Mail: MailConfig{
+			Transport:     MailTransportLog,
+			From:          "no-reply@localhost",
+			SMTPPort:      587,
+			SMTPTimeout:   30 * time.Second,
+			PublicURL:     "http://localhost:3000",
+			Cooldown:      time.Minute,
+			MaxPerIP:      20,
+			MaxConcurrent: 10,
+		},
+	}
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type problems []string
+
+func (p *problems) add(format string, args ...any) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+func (p problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: p}
+}
+
+// Validate checks everything the server needs to run
+func (c *Config) Validate() error {
+	var p problems
+
+	if !strings.HasPrefix(c.APIPrefix, "/") || (len(c.APIPrefix) > 1 && strings.HasSuffix(c.APIPrefix, "/")) {
+		p.add("API_PREFIX %q must start with a slash and must not end with one", c.APIPrefix)
+	}
+
+	c.Server.validate(&p)
+	c.CORS.validate(&p)
+	c.Database.validate(&p)
+
+	if c.Security.HSTSMaxAge < 0 {
+		p.add("SECURITY_HSTS_MAX_AGE must not be negative")
+	}
+	if c.Security.FrameOptions != "" {
+		oneOf(&p, "SECURITY_FRAME_OPTIONS", c.Security.FrameOptions, "DENY", "SAMEORIGIN")
+	}
+
+	c.Auth.validate(&p)
+
+	// The local provider never calls Omnistrate
+	if c.Auth.Provider == AuthProviderOmnistrate {
+		if c.Omnistrate.Username == "" {
+			p.add("OMNISTRATE_USERNAME is required")
+		}
+		if c.Omnistrate.Password == "" {
+			p.add("OMNISTRATE_PASSWORD is required")
+		}
+	}
+	positive(&p, "OMNISTRATE_TIMEOUT", int64(c.Omnistrate.Timeout))
+	if c.Omnistrate.MaxRetries < 0 {
+		p.add("OMNISTRATE_MAX_RETRIES must not be negative")
+	}
+
+	oneOf(&p, "MODEL_PROVIDER", c.Model.Provider, ModelProviderOpenAI, ModelProviderVLLM)
+	if c.Model.Name == "" {
+		p.add("MODEL is required")
+	}
+	if c.Model.Endpoint == "" && c.Model.Provider == ModelProviderVLLM {
+		p.add("MODEL_PROVIDER_ENDPOINT is required for the %s provider", ModelProviderVLLM)
+	}
+	if c.Model.Endpoint != "" {
+		if u, err := url.Parse(c.Model.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			p.add("MODEL_PROVIDER_ENDPOINT %q must be an absolute URL", c.Model.Endpoint)
+		}
+	}
+
+	positive(&p, "IMPORT_MAX_BYTES", c.Import.MaxBytes)
+	positive(&p, "IMPORT_MAX_CONVERSATIONS", int64(c.Import.MaxConversations))
+	positive(&p, "IMPORT_MAX_MESSAGES", int64(c.Import.MaxMessages))
+	positive(&p, "IMPORT_MAX_MESSAGE_BYTES", int64(c.Import.MaxMessageBytes))
+
+	oneOf(&p, "METRICS_LABEL_POLICY", c.Metrics.LabelPolicy, MetricsLabelPolicyOrg, MetricsLabelPolicyHashed, MetricsLabelPolicyFull)
+	if c.Metrics.LabelPolicy == MetricsLabelPolicyHashed && c.Metrics.LabelHashSalt == "" {
+		p.add("METRICS_LABEL_HASH_SALT is required for the %s label policy, unsalted user ID hashes are easy to reverse", MetricsLabelPolicyHashed)
+	}
+	positive(&p, "METRICS_REFRESH_INTERVAL", int64(c.Metrics.RefreshInterval))
+
+	positive(&p, "HEALTH_CACHE_TTL", int64(c.Health.CacheTTL))
+	positive(&p, "HEALTH_PROBE_TIMEOUT", int64(c.Health.ProbeTimeout))
+
+	c.Encryption.validate(&p)
+
+	oneOf(&p, "PII_DEFAULT_ACTION", c.Redaction.DefaultAction, "redact", "block", "allow")
+
+	oneOf(&p, "MODERATION_CLASSIFIER", c.Moderation.Classifier,
+		ModerationClassifierNone, ModerationClassifierKeywords, ModerationClassifierOpenAI, ModerationClassifierLLM)
+	if c.Moderation.Classifier == ModerationClassifierKeywords && c.Moderation.KeywordsFile == "" {
+		p.add("MODERATION_KEYWORDS_FILE is required for the %s classifier", ModerationClassifierKeywords)
+	}
+	if c.Moderation.Classifier == ModerationClassifierOpenAI && c.Model.Provider != ModelProviderOpenAI {
+		p.add("the %s moderation classifier requires the %s model provider", ModerationClassifierOpenAI, ModelProviderOpenAI)
+	}
+	oneOf(&p, "MODERATION_DEFAULT_ACTION", c.Moderation.DefaultAction, "refuse", "annotate", "allow")
+
+	positive(&p, "RETENTION_INTERVAL", int64(c.Retention.Interval))
+	positive(&p, "RETENTION_BATCH_SIZE", int64(c.Retention.BatchSize))
+
+	c.Mail.validate(&p)
+
+	return p.err()
+}
+
+// ValidateDatabase only checks the database settings, for commands that do not serve requests
+func (c *Config) ValidateDatabase() error {
+	var p problems
+	c.Database.validate(&p)
+	return p.err()
+}
+
+// ValidateEncryption checks the database and encryption settings, for the key management commands
+func (c *Config) ValidateEncryption() error {
+	var p problems
+	c.Database.validate(&p)
+	c.Encryption.validate(&p)
+	return p.err()
+}
+
+func (e *EncryptionConfig) validate(p *problems) {
+	if e.MasterKey != "" && e.KeyFile != "" {
+		p.add("only one of ENCRYPTION_MASTER_KEY and ENCRYPTION_KEY_FILE may be set")
+	}
+	if len(e.PreviousMasterKeys) > 0 && e.MasterKey == "" {
+		p.add("ENCRYPTION_PREVIOUS_MASTER_KEYS requires ENCRYPTION_MASTER_KEY")
+	}
+	positive(p, "ENCRYPTION_KEY_CACHE_TTL", int64(e.KeyCacheTTL))
+}
+
+func (s *ServerConfig) validate(p *problems) {
+	if s.ListenAddr == "" {
+		p.add("LISTEN_ADDR is required")
+	}
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		p.add("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	positive(p, "SERVER_READ_TIMEOUT", int64(s.ReadTimeout))
+	positive(p, "SERVER_READ_HEADER_TIMEOUT", int64(s.ReadHeaderTimeout))
+	positive(p, "SERVER_WRITE_TIMEOUT", int64(s.WriteTimeout))
+	positive(p, "SERVER_IDLE_TIMEOUT", int64(s.IdleTimeout))
+	positive(p, "SHUTDOWN_TIMEOUT", int64(s.ShutdownTimeout))
+	positive(p, "SERVER_MAX_BODY_BYTES", s.MaxBodyBytes)
+}
+
+func (c *CORSConfig) validate(p *problems) {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			if c.AllowCredentials {
+				p.add("CORS_ALLOW_CREDENTIALS cannot be combined with the wildcard origin, list the allowed origins instead")
+			}
+			continue
+		}
+
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			p.add("CORS_ALLOWED_ORIGINS entry %q must be * or an origin like https://chat.example.com", origin)
+		}
+	}
+	if c.MaxAge < 0 {
+		p.add("CORS_MAX_AGE must not be negative")
+	}
+}
+
+func (d *DatabaseConfig) validate(p *problems) {
+	oneOf(p, "DB_DRIVER", d.Driver, DatabaseDriverPostgres, DatabaseDriverSQLite)
+
+	switch d.Driver {
+	case DatabaseDriverPostgres:
+		if d.URL == "" && d.Host == "" {
+			p.add("DATABASE_URL or DB_HOST is required for the %s driver", DatabaseDriverPostgres)
+		}
+		oneOf(p, "DB_SSLMODE", d.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+		if (d.SSLMode == "verify-ca" || d.SSLMode == "verify-full") && d.SSLRootCert == "" && d.URL == "" {
+			p.add("DB_SSLROOTCERT is required for DB_SSLMODE %s", d.SSLMode)
+		}
+		if (d.SSLCert == "") != (d.SSLKey == "") {
+			p.add("DB_SSLCERT and DB_SSLKEY must be set together")
+		}
+	case DatabaseDriverSQLite:
+		if d.SQLitePath == "" {
+			p.add("DB_SQLITE_PATH is required for the %s driver", DatabaseDriverSQLite)
+		}
+		if len(d.ReadReplicaURLs) > 0 {
+			p.add("DB_READ_REPLICA_URLS is not supported with the %s driver", DatabaseDriverSQLite)
+		}
+	}
+
+	if d.Port <= 0 || d.Port > 65535 {
+		p.add("DB_PORT %d is not a valid port", d.Port)
+	}
+	if d.MaxOpenConns < 0 {
+		p.add("DB_MAX_OPEN_CONNS must not be negative")
+	}
+	if d.MaxIdleConns < 0 {
+		p.add("DB_MAX_IDLE_CONNS must not be negative")
+	}
+	if d.MaxOpenConns > 0 && d.MaxIdleConns > d.MaxOpenConns {
+		p.add("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", d.MaxIdleConns, d.MaxOpenConns)
+	}
+	positive(p, "DB_CONNECT_TIMEOUT", int64(d.ConnectTimeout))
+}
+
+func (a *AuthConfig) validate(p *problems) {
+	oneOf(p, "AUTH_PROVIDER", a.Provider, AuthProviderOmnistrate, AuthProviderLocal)
+	if a.Provider != AuthProviderLocal {
+		return
+	}
+
+	if len(a.JWTSecret) < 32 {
+		p.add("AUTH_JWT_SECRET of at least 32 bytes is required for the %s provider", AuthProviderLocal)
+	}
+	positive(p, "AUTH_ACCESS_TOKEN_TTL", int64(a.AccessTokenTTL))
+	positive(p, "AUTH_REFRESH_TOKEN_TTL", int64(a.RefreshTokenTTL))
+	if a.RefreshTokenTTL > 0 && a.RefreshTokenTTL < a.AccessTokenTTL {
+		p.add("AUTH_REFRESH_TOKEN_TTL must not be shorter than AUTH_ACCESS_TOKEN_TTL")
+	}
+}
+
+func (m *MailConfig) validate(p *problems) {
+	oneOf(p, "MAIL_TRANSPORT", m.Transport, MailTransportLog, MailTransportSMTP)
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		p.add("MAIL_FROM %q must be an email address", m.From)
+	}
+	if m.Transport == MailTransportSMTP {
+		if m.SMTPHost == "" {
+			p.add("SMTP_HOST is required for the %s mail transport", MailTransportSMTP)
+		}
+		if m.SMTPPort <= 0 || m.SMTPPort > 65535 {
+			p.add("SMTP_PORT %d must be a valid port", m.SMTPPort)
+		}
+		positive(p, "SMTP_TIMEOUT", int64(m.SMTPTimeout))
+	}
+	if u, err := url.Parse(m.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.add("PUBLIC_URL %q must be an absolute http or https URL", m.PublicURL)
+	}
+	positive(p, "MAIL_COOLDOWN", int64(m.Cooldown))
+	positive(p, "MAIL_MAX_PER_IP", int64(m.MaxPerIP))
+	positive(p, "MAIL_MAX_CONCURRENT", int64(m.MaxConcurrent))
+}
+
+func oneOf(p *problems, name string, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		p.add("%s %q must be one of %s", name, value, strings.Join(allowed, ", "))
+	}
+}
+
+func positive(p *problems, name string, value int64) {
+	if value <= 0 {
+		p.add("%s must be positive", name)
 	}
 }
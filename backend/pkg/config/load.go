@@ -0,0 +1,174 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable pointing to the optional YAML configuration file
+const FileEnv = "CONFIG_FILE"
+
+const redacted = "[REDACTED]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load builds the configuration from the defaults, the YAML file named by CONFIG_FILE, the
+// environment and secret files, in that order of precedence, and makes it Current. It does not
+// validate, callers validate what they need.
+func Load() (cfg *Config, err error) {
+	cfg = Defaults()
+
+	if path := os.Getenv(FileEnv); path != "" {
+		if err = loadFile(cfg, path); err != nil {
+			return
+		}
+	}
+
+	var p problems
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		loadEnv(&p, field, tag)
+	})
+	if err = p.err(); err != nil {
+		return
+	}
+
+	Current = cfg
+	return
+}
+
+func loadFile(cfg *Config, path string) (err error) {
+	var content []byte
+	if content, err = os.ReadFile(path); err != nil {
+		return errors.Wrap(err, "failed to read configuration file")
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	// Catch typos instead of silently ignoring misspelled settings
+	decoder.KnownFields(true)
+	if err = decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return errors.Wrapf(err, "failed to parse configuration file %s", path)
+	}
+	return nil
+}
+
+// walk calls fn for every leaf setting of a configuration struct
+func walk(v reflect.Value, fn func(field reflect.Value, tag reflect.StructTag)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walk(field, fn)
+			continue
+		}
+		fn(field, v.Type().Field(i).Tag)
+	}
+}
+
+func loadEnv(p *problems, field reflect.Value, tag reflect.StructTag) {
+	name := tag.Get("env")
+	if name == "" {
+		return
+	}
+
+	// Empty variables count as unset, compose files often pass them through that way
+	value := os.Getenv(name)
+
+	if tag.Get("secret") == "true" {
+		if path := os.Getenv(name + "_FILE"); path != "" {
+			if value != "" {
+				p.add("only one of %s and %s_FILE may be set", name, name)
+				return
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				p.add("failed to read %s_FILE: %v", name, err)
+				return
+			}
+			value = strings.TrimRight(string(content), "\r\n")
+		}
+	}
+
+	if value == "" {
+		return
+	}
+
+	if err := set(field, value); err != nil {
+		p.add("%s: %v", name, err)
+	}
+}
+
+func set(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, use a value like 30s or 5m", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with every configured secret replaced
+func (c *Config) Redacted() *Config {
+	clone := *c
+
+	walk(reflect.ValueOf(&clone).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		if tag.Get("secret") != "true" {
+			return
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			if field.String() != "" {
+				field.SetString(redacted)
+			}
+		case reflect.Slice:
+			// The clone shares the backing array with c, replace the slice instead of its items
+			items := make([]string, field.Len())
+			for i := range items {
+				items[i] = redacted
+			}
+			field.Set(reflect.ValueOf(items))
+		}
+	})
+	return &clone
+}
+
+// YAML renders the configuration in the format of the configuration file
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
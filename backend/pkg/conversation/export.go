@@ -0,0 +1,223 @@
+package conversation
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/pkg/errors"
+)
+
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatJSON     Format = "json"
+	FormatHTML     Format = "html"
+
+	// ExportVersion is bumped whenever the JSON export layout changes in an incompatible way
+	ExportVersion = 1
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// ParseFormat maps the user supplied format to a known export format, defaulting to markdown
+func ParseFormat(format string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "md", "markdown":
+		return FormatMarkdown, nil
+	case "json":
+		return FormatJSON, nil
+	case "html", "htm":
+		return FormatHTML, nil
+	}
+
+	return "", errors.Wrapf(ErrUnknownFormat, "%q", format)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSON:
+		return "application/json; charset=utf-8"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+func (f Format) Extension() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatHTML:
+		return "html"
+	default:
+		return "md"
+	}
+}
+
+// Document is the exported representation of a thread
+type Document struct {
+	Version   int        `json:"version"`
+	ThreadID  string     `json:"thread_id,omitempty"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Messages  []Message  `json:"messages"`
+	SharedAt  *time.Time `json:"shared_at,omitempty"`
+}
+
+type Message struct {
+	MessageID   string           `json:"message_id"`
+	CreatedAt   time.Time        `json:"created_at"`
+	MessageType core.MessageType `json:"message_type"`
+	Content     string           `json:"content"`
+}
+
+func FromThread(thread core.Thread, messages []core.Message) Document {
+	doc := Document{
+		Version:   ExportVersion,
+		ThreadID:  thread.ID,
+		Name:      thread.Name,
+		CreatedAt: thread.CreatedAt,
+		UpdatedAt: thread.UpdatedAt,
+		Messages:  make([]Message, 0, len(messages)),
+	}
+
+	for _, message := range messages {
+		doc.Messages = append(doc.Messages, Message{
+			MessageID:   message.MessageID,
+			CreatedAt:   message.CreatedAt,
+			MessageType: message.MessageType,
+			Content:     message.Content,
+		})
+	}
+
+	return doc
+}
+
+// FromShare builds a document from a share snapshot. The thread ID is left out on purpose.
+func FromShare(share core.ThreadShare) Document {
+	sharedAt := share.CreatedAt
+	doc := Document{
+		Version:   ExportVersion,
+		Name:      share.ThreadName,
+		CreatedAt: share.CreatedAt,
+		UpdatedAt: share.CreatedAt,
+		Messages:  make([]Message, 0, len(share.Messages)),
+		SharedAt:  &sharedAt,
+	}
+
+	for _, message := range share.Messages {
+		doc.Messages = append(doc.Messages, Message{
+			MessageID:   message.MessageID,
+			CreatedAt:   message.CreatedAt,
+			MessageType: message.MessageType,
+			Content:     message.Content,
+		})
+	}
+
+	return doc
+}
+
+// Write renders the document in the given format
+func Write(w io.Writer, format Format, doc Document) error {
+	switch format {
+	case FormatMarkdown:
+		return writeMarkdown(w, doc)
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(doc)
+	case FormatHTML:
+		return htmlTemplate.Execute(w, doc)
+	}
+
+	return errors.Wrapf(ErrUnknownFormat, "%q", format)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// FileName returns a filesystem-safe file name for the document
+func FileName(doc Document, format Format) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(doc.Name, "-"), "-.")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if name == "" {
+		name = "thread"
+	}
+
+	if doc.ThreadID != "" {
+		name = name + "-" + doc.ThreadID
+	}
+
+	return name + "." + format.Extension()
+}
+
+func roleName(messageType core.MessageType) string {
+	switch messageType {
+	case core.MessageTypeQuery:
+		return "User"
+	case core.MessageTypeResponse:
+		return "Assistant"
+	}
+
+	return string(messageType)
+}
+
+func writeMarkdown(w io.Writer, doc Document) (err error) {
+	if _, err = fmt.Fprintf(w, "# %s\n\n_Created %s_\n", doc.Name, doc.CreatedAt.UTC().Format(time.RFC1123)); err != nil {
+		return
+	}
+
+	for _, message := range doc.Messages {
+		if _, err = fmt.Fprintf(w, "\n### %s · %s\n\n%s\n",
+			roleName(message.MessageType),
+			message.CreatedAt.UTC().Format(time.RFC1123),
+			strings.TrimRight(message.Content, "\n"),
+		); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+var htmlTemplate = template.Must(template.New("thread").Funcs(template.FuncMap{
+	"role": roleName,
+	"timestamp": func(t time.Time) string {
+		return t.UTC().Format(time.RFC1123)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Name }}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #1f2937; }
+h1 { font-size: 1.5rem; }
+.meta { color: #6b7280; font-size: 0.875rem; }
+.message { border-radius: 0.5rem; padding: 0.75rem 1rem; margin: 1rem 0; }
+.query { background: #eff6ff; }
+.response { background: #f3f4f6; }
+.content { white-space: pre-wrap; word-wrap: break-word; }
+</style>
+</head>
+<body>
+<h1>{{ .Name }}</h1>
+<p class="meta">Created {{ timestamp .CreatedAt }}{{ with .SharedAt }} · Shared {{ timestamp . }}{{ end }}</p>
+{{ range .Messages }}<div class="message {{ .MessageType }}">
+<p class="meta"><strong>{{ role .MessageType }}</strong> · {{ timestamp .CreatedAt }}</p>
+<div class="content">{{ .Content }}</div>
+</div>
+{{ end }}</body>
+</html>
+`))
@@ -0,0 +1,302 @@
+package conversation
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/pkg/errors"
+)
+
+type Source string
+
+const (
+	SourceChatGPT Source = "chatgpt"
+	SourceNative  Source = "native"
+)
+
+var (
+	ErrUnrecognizedImport = errors.New("unrecognized import format")
+	ErrTooManyThreads     = errors.New("too many conversations in import")
+)
+
+// Limits bounds what a single import may contain
+type Limits struct {
+	MaxConversations int
+	MaxMessages      int
+	MaxMessageBytes  int
+}
+
+// Imported is a single conversation parsed out of an import file. Either Document is set or Err
+// explains why the conversation could not be read.
+type Imported struct {
+	Index    int
+	Document Document
+	Err      error
+}
+
+// ParseImport detects the format of an import file and parses every conversation in it. Errors
+// affecting a single conversation are reported on that conversation only.
+func ParseImport(data []byte, limits Limits) (source Source, imported []Imported, err error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		err = errors.Wrap(ErrUnrecognizedImport, "empty file")
+		return
+	}
+
+	// Our own export of a single thread is an object, everything else is a list
+	var raws []json.RawMessage
+	if data[0] == '{' {
+		raws = []json.RawMessage{data}
+	} else if err = json.Unmarshal(data, &raws); err != nil {
+		err = errors.Wrap(ErrUnrecognizedImport, err.Error())
+		return
+	}
+
+	if len(raws) > limits.MaxConversations {
+		err = errors.Wrapf(ErrTooManyThreads, "%d conversations, at most %d allowed", len(raws), limits.MaxConversations)
+		return
+	}
+
+	if len(raws) == 0 {
+		source = SourceNative
+		return
+	}
+
+	if source, err = detectSource(raws[0]); err != nil {
+		return
+	}
+
+	imported = make([]Imported, 0, len(raws))
+	for i, raw := range raws {
+		item := Imported{Index: i}
+		switch source {
+		case SourceChatGPT:
+			item.Document, item.Err = parseChatGPTConversation(raw)
+		default:
+			item.Document, item.Err = parseNativeDocument(raw)
+		}
+
+		if item.Err == nil {
+			item.Err = validateDocument(item.Document, limits)
+		}
+
+		imported = append(imported, item)
+	}
+
+	return
+}
+
+func detectSource(raw json.RawMessage) (Source, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return "", errors.Wrap(ErrUnrecognizedImport, err.Error())
+	}
+
+	if _, ok := probe["mapping"]; ok {
+		return SourceChatGPT, nil
+	}
+
+	if _, ok := probe["messages"]; ok {
+		return SourceNative, nil
+	}
+
+	return "", ErrUnrecognizedImport
+}
+
+func validateDocument(doc Document, limits Limits) error {
+	if len(doc.Messages) == 0 {
+		return errors.New("conversation has no messages")
+	}
+
+	if len(doc.Messages) > limits.MaxMessages {
+		return errors.Errorf("conversation has %d messages, at most %d allowed", len(doc.Messages), limits.MaxMessages)
+	}
+
+	for _, message := range doc.Messages {
+		if len(message.Content) > limits.MaxMessageBytes {
+			return errors.Errorf("message exceeds %d bytes", limits.MaxMessageBytes)
+		}
+	}
+
+	return nil
+}
+
+func parseNativeDocument(raw json.RawMessage) (doc Document, err error) {
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		err = errors.Wrap(err, "invalid conversation")
+		return
+	}
+
+	if doc.Version > ExportVersion {
+		err = errors.Errorf("unsupported export version %d", doc.Version)
+		return
+	}
+
+	for _, message := range doc.Messages {
+		if message.MessageType != core.MessageTypeQuery && message.MessageType != core.MessageTypeResponse {
+			err = errors.Errorf("unknown message type %q", message.MessageType)
+			return
+		}
+	}
+
+	sort.SliceStable(doc.Messages, func(i, j int) bool {
+		return doc.Messages[i].CreatedAt.Before(doc.Messages[j].CreatedAt)
+	})
+
+	normalizeTimestamps(&doc)
+	return
+}
+
+// chatGPTConversation is the subset of a conversations.json entry that we care about
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CreateTime  *float64               `json:"create_time"`
+	UpdateTime  *float64               `json:"update_time"`
+	CurrentNode string                 `json:"current_node"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	ID      string          `json:"id"`
+	Parent  *string         `json:"parent"`
+	Message *chatGPTMessage `json:"message"`
+}
+
+type chatGPTMessage struct {
+	ID     string `json:"id"`
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+	} `json:"content"`
+}
+
+func parseChatGPTConversation(raw json.RawMessage) (doc Document, err error) {
+	var conversation chatGPTConversation
+	if err = json.Unmarshal(raw, &conversation); err != nil {
+		err = errors.Wrap(err, "invalid conversation")
+		return
+	}
+
+	doc = Document{
+		Version:   ExportVersion,
+		Name:      conversation.Title,
+		CreatedAt: fromUnixSeconds(conversation.CreateTime),
+		UpdatedAt: fromUnixSeconds(conversation.UpdateTime),
+	}
+
+	// The mapping is a tree of edits and regenerations, the branch the user last saw is the one
+	// ending at current_node
+	var branch []chatGPTNode
+	seen := make(map[string]bool)
+	for nodeID := conversation.CurrentNode; nodeID != ""; {
+		if seen[nodeID] {
+			err = errors.New("conversation has a cycle")
+			return
+		}
+		seen[nodeID] = true
+
+		node, ok := conversation.Mapping[nodeID]
+		if !ok {
+			err = errors.Errorf("conversation references unknown node %q", nodeID)
+			return
+		}
+
+		branch = append(branch, node)
+		if node.Parent == nil {
+			break
+		}
+		nodeID = *node.Parent
+	}
+
+	for i := len(branch) - 1; i >= 0; i-- {
+		message := branch[i].Message
+		if message == nil || message.Content.ContentType != "text" {
+			continue
+		}
+
+		var messageType core.MessageType
+		switch message.Author.Role {
+		case "user":
+			messageType = core.MessageTypeQuery
+		case "assistant":
+			messageType = core.MessageTypeResponse
+		default:
+			// System prompts and tool calls have no equivalent here
+			continue
+		}
+
+		var parts []string
+		for _, rawPart := range message.Content.Parts {
+			var part string
+			if json.Unmarshal(rawPart, &part) == nil && part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+
+		createdAt := fromUnixSeconds(message.CreateTime)
+		if createdAt.IsZero() {
+			createdAt = doc.CreatedAt
+		}
+
+		doc.Messages = append(doc.Messages, Message{
+			MessageID:   message.ID,
+			CreatedAt:   createdAt,
+			MessageType: messageType,
+			Content:     strings.Join(parts, "\n\n"),
+		})
+	}
+
+	normalizeTimestamps(&doc)
+	return
+}
+
+// normalizeTimestamps fills in missing timestamps and makes message times strictly increasing,
+// messages are read back ordered by creation time
+func normalizeTimestamps(doc *Document) {
+	if doc.CreatedAt.IsZero() {
+		if len(doc.Messages) > 0 && !doc.Messages[0].CreatedAt.IsZero() {
+			doc.CreatedAt = doc.Messages[0].CreatedAt
+		} else {
+			doc.CreatedAt = time.Now()
+		}
+	}
+
+	previous := doc.CreatedAt.Add(-time.Microsecond)
+	for i := range doc.Messages {
+		doc.Messages[i].CreatedAt = doc.Messages[i].CreatedAt.Truncate(time.Microsecond)
+		if !doc.Messages[i].CreatedAt.After(previous) {
+			doc.Messages[i].CreatedAt = previous.Add(time.Microsecond)
+		}
+		previous = doc.Messages[i].CreatedAt
+	}
+
+	if doc.UpdatedAt.Before(previous) {
+		doc.UpdatedAt = previous
+	}
+
+	if strings.TrimSpace(doc.Name) == "" {
+		doc.Name = "Imported conversation"
+	}
+}
+
+func fromUnixSeconds(seconds *float64) time.Time {
+	if seconds == nil || *seconds <= 0 {
+		return time.Time{}
+	}
+
+	whole, fraction := math.Modf(*seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)).UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,196 @@
+package conversation
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+)
+
+var testLimits = Limits{MaxConversations: 10, MaxMessages: 10, MaxMessageBytes: 100}
+
+// exported returns the JSON export of a thread with the given messages
+func exported(t *testing.T, name string, contents ...string) []byte {
+	t.Helper()
+
+	createdAt := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	thread := core.Thread{ID: "thread-1", Name: name, CreatedAt: createdAt, UpdatedAt: createdAt}
+
+	var messages []core.Message
+	for i, content := range contents {
+		messageType := core.MessageTypeQuery
+		if i%2 == 1 {
+			messageType = core.MessageTypeResponse
+		}
+		messages = append(messages, core.Message{
+			MessageID:   fmt.Sprintf("message-%d", i),
+			CreatedAt:   createdAt.Add(time.Duration(i) * time.Second),
+			ThreadID:    thread.ID,
+			MessageType: messageType,
+			Content:     content,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatJSON, FromThread(thread, messages)); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseImport(t *testing.T) {
+	chatGPT := `[{"title": "Trip", "create_time": 1705312800, "current_node": "b", "mapping": {
+		"root": {"id": "root", "parent": null, "message": null},
+		"a": {"id": "a", "parent": "root", "message": {"id": "a", "author": {"role": "user"}, "create_time": 1705312801, "content": {"content_type": "text", "parts": ["Where to?"]}}},
+		"b": {"id": "b", "parent": "a", "message": {"id": "b", "author": {"role": "assistant"}, "create_time": 1705312802, "content": {"content_type": "text", "parts": ["Lisbon"]}}},
+		"c": {"id": "c", "parent": "a", "message": {"id": "c", "author": {"role": "assistant"}, "create_time": 1705312803, "content": {"content_type": "text", "parts": ["Regenerated"]}}}
+	}}]`
+
+	tests := []struct {
+		name         string
+		data         []byte
+		wantSource   Source
+		wantErr      error
+		wantContents [][]string
+		wantItemErr  []bool
+	}{
+		{
+			name:         "own export",
+			data:         exported(t, "Greetings", "Hello", "Hi, how can I help?"),
+			wantSource:   SourceNative,
+			wantContents: [][]string{{"Hello", "Hi, how can I help?"}},
+			wantItemErr:  []bool{false},
+		},
+		{
+			name:         "list of own exports",
+			data:         []byte("[" + string(exported(t, "One", "first")) + "," + string(exported(t, "Two", "second", "answer")) + "]"),
+			wantSource:   SourceNative,
+			wantContents: [][]string{{"first"}, {"second", "answer"}},
+			wantItemErr:  []bool{false, false},
+		},
+		{
+			name:         "chatgpt follows the current branch",
+			data:         []byte(chatGPT),
+			wantSource:   SourceChatGPT,
+			wantContents: [][]string{{"Where to?", "Lisbon"}},
+			wantItemErr:  []bool{false},
+		},
+		{
+			name:         "message too large fails only its conversation",
+			data:         []byte("[" + string(exported(t, "Large", strings.Repeat("x", 101))) + "," + string(exported(t, "Small", "fits")) + "]"),
+			wantSource:   SourceNative,
+			wantContents: [][]string{nil, {"fits"}},
+			wantItemErr:  []bool{true, false},
+		},
+		{
+			name:         "no messages",
+			data:         exported(t, "Empty"),
+			wantSource:   SourceNative,
+			wantContents: [][]string{nil},
+			wantItemErr:  []bool{true},
+		},
+		{name: "empty file", data: []byte("  "), wantErr: ErrUnrecognizedImport},
+		{name: "not json", data: []byte("# Greetings"), wantErr: ErrUnrecognizedImport},
+		{name: "unknown layout", data: []byte(`[{"title": "x"}]`), wantErr: ErrUnrecognizedImport},
+		{name: "too many conversations", data: []byte("[" + strings.Repeat(`{"messages": []},`, 10) + `{"messages": []}]`), wantErr: ErrTooManyThreads},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, imported, err := ParseImport(tt.data, testLimits)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseImport() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseImport() error = %v", err)
+			}
+			if source != tt.wantSource {
+				t.Errorf("ParseImport() source = %q, want %q", source, tt.wantSource)
+			}
+			if len(imported) != len(tt.wantContents) {
+				t.Fatalf("ParseImport() returned %d conversations, want %d", len(imported), len(tt.wantContents))
+			}
+
+			for i, item := range imported {
+				if (item.Err != nil) != tt.wantItemErr[i] {
+					t.Errorf("conversation %d error = %v, want error %t", i, item.Err, tt.wantItemErr[i])
+				}
+				if item.Err != nil {
+					continue
+				}
+
+				var contents []string
+				for _, message := range item.Document.Messages {
+					contents = append(contents, message.Content)
+				}
+				if !slices.Equal(contents, tt.wantContents[i]) {
+					t.Errorf("conversation %d messages = %q, want %q", i, contents, tt.wantContents[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		thread   string
+		messages []string
+	}{
+		{"single question", "Refunds", []string{"What is the refund policy?"}},
+		{"conversation", "Trip planning", []string{"Where should I go?", "Lisbon is lovely in spring.", "Thanks!"}},
+		{"markup and unicode", "<b>Grüße</b>", []string{"Use `**bold**` and <script>alert(1)</script>", "Ça marche 👍"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thread := core.Thread{ID: "thread-1", Name: tt.thread, CreatedAt: createdAt, UpdatedAt: createdAt}
+			var messages []core.Message
+			for i, content := range tt.messages {
+				messageType := core.MessageTypeQuery
+				if i%2 == 1 {
+					messageType = core.MessageTypeResponse
+				}
+				messages = append(messages, core.Message{
+					MessageID:   fmt.Sprintf("message-%d", i),
+					CreatedAt:   createdAt.Add(time.Duration(i) * time.Minute),
+					ThreadID:    thread.ID,
+					MessageType: messageType,
+					Content:     content,
+				})
+			}
+
+			var buf bytes.Buffer
+			if err := Write(&buf, FormatJSON, FromThread(thread, messages)); err != nil {
+				t.Fatalf("failed to export: %v", err)
+			}
+
+			_, imported, err := ParseImport(buf.Bytes(), testLimits)
+			if err != nil || len(imported) != 1 || imported[0].Err != nil {
+				t.Fatalf("failed to parse export: %v %+v", err, imported)
+			}
+
+			doc := imported[0].Document
+			if doc.Name != thread.Name || !doc.CreatedAt.Equal(thread.CreatedAt) {
+				t.Errorf("imported thread = %q created %v, want %q created %v", doc.Name, doc.CreatedAt, thread.Name, thread.CreatedAt)
+			}
+			if len(doc.Messages) != len(messages) {
+				t.Fatalf("imported %d messages, want %d", len(doc.Messages), len(messages))
+			}
+			for i, message := range doc.Messages {
+				want := messages[i]
+				if message.Content != want.Content || message.MessageType != want.MessageType || !message.CreatedAt.Equal(want.CreatedAt) {
+					t.Errorf("imported message %d = %+v, want %+v", i, message, want)
+				}
+			}
+		})
+	}
+}
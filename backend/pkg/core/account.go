@@ -0,0 +1,355 @@
+package core
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/audit"
+	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// accountDeletion reports what was removed when a user was deleted
+type accountDeletion struct {
+	DeletedThreads int64 `json:"deleted_threads"`
+	// RetainedThreads are on legal hold, they are kept and the user record is anonymized instead of deleted
+	RetainedThreads int64 `json:"retained_threads"`
+}
+
+// deleteAccount deletes everything stored about a user, then removes the user from the authentication
+// provider. Local data goes first, so a failed attempt can be retried by the user as long as they can
+// still sign in.
+func deleteAccount(ctx context.Context, dataStore *store.Store, authHandler *auth.Auth, userID string) (deletion accountDeletion, err error) {
+	if deletion.DeletedThreads, deletion.RetainedThreads, err = dataStore.Threads.DeleteForUser(ctx, userID); err != nil {
+		err = errors.Wrap(err, "failed to delete threads")
+		return
+	}
+
+	// Usage stays for billing, under a pseudonym that cannot be traced back without the user ID
+	if err = dataStore.Usage.Pseudonymize(ctx, userID, usagePseudonym(userID)); err != nil {
+		err = errors.Wrap(err, "failed to pseudonymize usage")
+		return
+	}
+
+	if deletion.RetainedThreads > 0 {
+		err = dataStore.Users.Anonymize(ctx, userID)
+	} else {
+		err = dataStore.Users.Delete(ctx, userID)
+	}
+	if err != nil {
+		err = errors.Wrap(err, "failed to delete user record")
+		return
+	}
+
+	if err = authHandler.DeleteUser(ctx, userID); err != nil {
+		return
+	}
+
+	log.Ctx(ctx).Info().
+		Str("deleted_user_id", userID).
+		Int64("deleted_threads", deletion.DeletedThreads).
+		Int64("retained_threads", deletion.RetainedThreads).
+		Msg("deleted user account")
+	return
+}
+
+func usagePseudonym(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return "deleted-" + hex.EncodeToString(sum[:8])
+}
+
+// DeleteUserHandler deletes the account of the authenticated user and all their data. The request
+// must carry confirm=true, the deletion cannot be undone.
+func (u UserAPI) DeleteUserHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to delete user: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to delete user")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, u.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ctx.Query("confirm") != "true" {
+		ctx.JSON(400, gin.H{"error": "deleting an account cannot be undone, repeat the request with confirm=true"})
+		return
+	}
+
+	var deletion accountDeletion
+	if deletion, err = deleteAccount(context.WithoutCancel(ctx.Request.Context()), u.store, u.authHandler, user.ID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordDeletion(ctx, u.store, user, user, deletion)
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"deleted": deletion})
+}
+
+// DeleteOrgUserHandler lets org admins delete the account of another user of their org
+func (o OrgAPI) DeleteOrgUserHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to delete org user: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to delete org user")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var admin tenant.User
+	if admin, err = describeTenant(ctx, o.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !admin.IsOrgAdmin() {
+		ctx.JSON(403, gin.H{"error": "only organization admins can delete users"})
+		return
+	}
+
+	if ctx.Query("confirm") != "true" {
+		ctx.JSON(400, gin.H{"error": "deleting an account cannot be undone, repeat the request with confirm=true"})
+		return
+	}
+
+	// Only users of the admin's own org can be deleted
+	var target tenant.User
+	if target, err = o.store.Users.Get(ctx.Request.Context(), ctx.Param("user_id")); err != nil || target.OrgID != admin.OrgID {
+		if err == nil || errors.Is(err, model.ErrNotFound) {
+			err = nil
+			ctx.JSON(404, gin.H{"error": "user not found"})
+			return
+		}
+
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if target.ID == admin.ID {
+		ctx.JSON(400, gin.H{"error": "delete your own account with DELETE /user"})
+		return
+	}
+	if target.Role == tenant.RoleRoot {
+		ctx.JSON(403, gin.H{"error": "the root user of an organization cannot be deleted"})
+		return
+	}
+
+	// An org without admins could no longer manage its users and settings
+	if target.IsOrgAdmin() {
+		var admins int64
+		if admins, err = o.store.Users.CountAdmins(ctx.Request.Context(), admin.OrgID); err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if admins <= 1 {
+			ctx.JSON(409, gin.H{"error": "cannot delete the last admin of the organization"})
+			return
+		}
+	}
+
+	var deletion accountDeletion
+	if deletion, err = deleteAccount(context.WithoutCancel(ctx.Request.Context()), o.store, o.authHandler, target.ID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordDeletion(ctx, o.store, admin, target, deletion)
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"deleted": deletion})
+}
+
+// recordDeletion audits the deletion of target's account by actor. The email of the deleted user is
+// not kept, the user ID is enough to correlate with earlier events.
+func recordDeletion(ctx *gin.Context, dataStore *store.Store, actor tenant.User, target tenant.User, deletion accountDeletion) {
+	event := audit.Event(audit.ActionUserDelete, actor)
+	if actor.ID == target.ID {
+		event.ActorEmail = ""
+	}
+	event.TargetType = "user"
+	event.TargetID = target.ID
+	event.Details = map[string]any{"deleted": deletion}
+	audit.Record(ctx, dataStore.Audit, event)
+}
+
+// exportedThread is a thread with its messages as stored, including moderation verdicts and redaction counts
+type exportedThread struct {
+	Thread   core.Thread    `json:"thread"`
+	Messages []core.Message `json:"messages"`
+}
+
+// exportedShare is a share including its snapshot, which the API otherwise only serves by token
+type exportedShare struct {
+	core.ThreadShare
+	Messages []core.SharedMessage `json:"messages"`
+}
+
+// DataExportHandler streams a zip archive with everything stored about the authenticated user: the
+// profile, every thread with its messages, shares and usage records
+func (u UserAPI) DataExportHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to export user data: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to export user data")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, u.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Load everything before streaming, so failures can still be reported with a status code
+	var stored *tenant.User
+	if localUser, getErr := u.store.Users.Get(ctx.Request.Context(), user.ID); getErr == nil {
+		stored = &localUser
+	} else if !errors.Is(getErr, model.ErrNotFound) {
+		err = getErr
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var threads []core.Thread
+	if threads, err = u.store.Threads.ListForUser(ctx.Request.Context(), user.ID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var shares []core.ThreadShare
+	if shares, err = u.store.Shares.ListForUser(ctx.Request.Context(), user.ID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var usage []tenant.UsageRecord
+	if usage, err = u.store.Usage.ListForUser(ctx.Request.Context(), user.ID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	exportedAt := time.Now().UTC()
+	fileName := fmt.Sprintf("data-export-%s.zip", exportedAt.Format("20060102-150405"))
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	ctx.Status(http.StatusOK)
+
+	// From here on the response is streamed, errors can only be logged
+	archive := zip.NewWriter(ctx.Writer)
+	defer func() {
+		if closeErr := archive.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	if err = writeJSONEntry(archive, "profile.json", exportedAt, gin.H{
+		"exported_at":   exportedAt,
+		"user":          stored,
+		"account":       userProfile(user),
+		"threads_count": len(threads),
+	}); err != nil {
+		return
+	}
+
+	for _, thread := range threads {
+		var messages []core.Message
+		if messages, err = u.store.Messages.ListForThread(ctx.Request.Context(), thread.ID); err != nil {
+			return
+		}
+
+		if err = writeJSONEntry(archive, "threads/"+thread.ID+".json", thread.UpdatedAt, exportedThread{Thread: thread, Messages: messages}); err != nil {
+			return
+		}
+		ctx.Writer.Flush()
+	}
+
+	exportedShares := make([]exportedShare, 0, len(shares))
+	for _, share := range shares {
+		exportedShares = append(exportedShares, exportedShare{ThreadShare: share, Messages: share.Messages})
+	}
+	if err = writeJSONEntry(archive, "shares.json", exportedAt, exportedShares); err != nil {
+		return
+	}
+
+	err = writeJSONEntry(archive, "usage.json", exportedAt, usage)
+}
+
+func writeJSONEntry(archive *zip.Writer, name string, modified time.Time, value any) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,400 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store/storetest"
+)
+
+// fakeOmnistrate serves the parts of the Omnistrate API used by the handlers. Users authenticate
+// with their ID as token.
+type fakeOmnistrate struct {
+	mu           sync.Mutex
+	users        map[string]tenant.User
+	deleted      []string
+	signinStatus int
+}
+
+var (
+	omnistrateOnce sync.Once
+	omnistrate     = &fakeOmnistrate{}
+)
+
+// useFakeOmnistrate routes all Omnistrate calls of the test binary to a fake knowing users
+func useFakeOmnistrate(t *testing.T, users ...tenant.User) *fakeOmnistrate {
+	t.Helper()
+
+	omnistrateOnce.Do(func() {
+		server := httptest.NewTLSServer(omnistrate)
+		// The SDK has the Omnistrate URL built in, so every connection goes to the fake instead
+		http.DefaultTransport = &http.Transport{
+			DialContext: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	})
+
+	omnistrate.mu.Lock()
+	defer omnistrate.mu.Unlock()
+	omnistrate.users = make(map[string]tenant.User, len(users))
+	for _, user := range users {
+		omnistrate.users[user.ID] = user
+	}
+	omnistrate.deleted = nil
+	omnistrate.signinStatus = 0
+	return omnistrate
+}
+
+func (f *fakeOmnistrate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/2022-09-01-00/signin":
+		_ = json.NewEncoder(w).Encode(map[string]string{"jwtToken": "service-account"})
+	case r.Method == http.MethodPost && r.URL.Path == "/2022-09-01-00/customer-user-signin":
+		var request struct {
+			Email string `json:"email"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		for _, user := range f.users {
+			if user.Email == request.Email && f.signinStatus == 0 {
+				_ = json.NewEncoder(w).Encode(map[string]string{"jwtToken": user.ID})
+				return
+			}
+		}
+		w.WriteHeader(cmp.Or(f.signinStatus, http.StatusBadRequest))
+		_, _ = w.Write([]byte(`{"name":"bad_request","message":"wrong user or password"}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/2022-09-01-00/user":
+		user, ok := f.users[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"name":"unauthorized","message":"invalid token"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"id":       user.ID,
+			"email":    user.Email,
+			"orgId":    user.OrgID,
+			"roleType": user.Role,
+		})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/2022-09-01-00/fleet/user/"):
+		f.deleted = append(f.deleted, strings.TrimPrefix(r.URL.Path, "/2022-09-01-00/fleet/user/"))
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// rejectSignins answers customer sign-ins with status until the next useFakeOmnistrate
+func (f *fakeOmnistrate) rejectSignins(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.signinStatus = status
+}
+
+func (f *fakeOmnistrate) deletedUsers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.deleted)
+}
+
+// seedAccount stores a user with a thread, a share and a usage record
+func seedAccount(t *testing.T, dataStore *store.Store, user tenant.User, legalHold bool) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := dataStore.Orgs.Save(ctx, &tenant.Org{ID: user.OrgID}); err != nil {
+		t.Fatalf("failed to store org: %v", err)
+	}
+	if err := dataStore.Users.Save(ctx, &user); err != nil {
+		t.Fatalf("failed to store user: %v", err)
+	}
+
+	now := time.Now().UTC()
+	thread := core.Thread{ID: user.ID + "-thread", UserID: user.ID, Name: "Quarterly plan", LegalHold: legalHold, CreatedAt: now, UpdatedAt: now}
+	messages := []core.Message{
+		{MessageID: user.ID + "-query", ThreadID: thread.ID, Content: "What is our plan?", MessageType: core.MessageTypeQuery, CreatedAt: now},
+		{MessageID: user.ID + "-response", ThreadID: thread.ID, Content: "Grow.", MessageType: core.MessageTypeResponse, CreatedAt: now},
+	}
+	if err := dataStore.Threads.CreateWithMessages(ctx, &thread, messages); err != nil {
+		t.Fatalf("failed to store thread: %v", err)
+	}
+
+	share := core.ThreadShare{ID: user.ID + "-share", TokenHash: user.ID + "-token", ThreadID: thread.ID, UserID: user.ID, OrgID: user.OrgID, ThreadName: thread.Name}
+	if err := dataStore.Shares.Save(ctx, &share); err != nil {
+		t.Fatalf("failed to store share: %v", err)
+	}
+
+	if err := dataStore.Usage.Add(ctx, tenant.UsageRecord{Day: tenant.UsageDay(now), OrgID: user.OrgID, UserID: user.ID, Requests: 1}); err != nil {
+		t.Fatalf("failed to store usage: %v", err)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	tests := []struct {
+		name         string
+		legalHold    bool
+		wantDeletion accountDeletion
+	}{
+		{name: "everything deleted", wantDeletion: accountDeletion{DeletedThreads: 1}},
+		{name: "thread on legal hold", legalHold: true, wantDeletion: accountDeletion{RetainedThreads: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dataStore := storetest.New(dbtest.Open(t))
+			user := tenant.User{ID: "user-1", Email: "jane@acme.example", Name: "Jane", OrgID: "org-1", Role: tenant.RoleEditor}
+			seedAccount(t, dataStore, user, tt.legalHold)
+			fake := useFakeOmnistrate(t, user)
+
+			deletion, err := deleteAccount(ctx, dataStore, auth.NewAuth(metrics.NewMetrics(), dataStore), user.ID)
+			if err != nil {
+				t.Fatalf("deleteAccount() error = %v", err)
+			}
+			if deletion != tt.wantDeletion {
+				t.Errorf("deleteAccount() = %+v, want %+v", deletion, tt.wantDeletion)
+			}
+
+			threads, err := dataStore.Threads.ListForUser(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("failed to list threads: %v", err)
+			}
+			shares, err := dataStore.Shares.ListForUser(ctx, user.ID)
+			if err != nil {
+				t.Fatalf("failed to list shares: %v", err)
+			}
+			if tt.legalHold {
+				if len(threads) != 1 || len(shares) != 1 {
+					t.Errorf("%d threads and %d shares left, want the thread on legal hold and its share", len(threads), len(shares))
+				}
+			} else if len(threads) != 0 || len(shares) != 0 {
+				t.Errorf("%d threads and %d shares left, want none", len(threads), len(shares))
+			}
+
+			// Usage is kept under the pseudonym
+			if usage, _ := dataStore.Usage.ListForUser(ctx, user.ID); len(usage) != 0 {
+				t.Errorf("usage records of the user = %+v, want none", usage)
+			}
+			usage, err := dataStore.Usage.ListForUser(ctx, usagePseudonym(user.ID))
+			if err != nil || len(usage) != 1 || usage[0].Requests != 1 {
+				t.Errorf("pseudonymized usage = %+v, %v, want the record of the user", usage, err)
+			}
+
+			stored, err := dataStore.Users.Get(ctx, user.ID)
+			if tt.legalHold {
+				if err != nil || stored.Email != "" || stored.Name != "" {
+					t.Errorf("user record = %+v, %v, want it anonymized", stored, err)
+				}
+			} else if !errors.Is(err, model.ErrNotFound) {
+				t.Errorf("user record = %+v, %v, want it deleted", stored, err)
+			}
+
+			if deleted := fake.deletedUsers(); !slices.Equal(deleted, []string{user.ID}) {
+				t.Errorf("users deleted from Omnistrate = %q, want %q", deleted, user.ID)
+			}
+		})
+	}
+}
+
+// serveAs sends a request with the token of user to handler mounted at pattern
+func serveAs(handler gin.HandlerFunc, method string, pattern string, target string, userID string) *httptest.ResponseRecorder {
+	engine := gin.New()
+	engine.Handle(method, pattern, handler)
+
+	request := httptest.NewRequest(method, target, nil)
+	request.Header.Set("Authorization", "Bearer "+userID)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestDeleteUserHandler(t *testing.T) {
+	dataStore := storetest.New(dbtest.Open(t))
+	user := tenant.User{ID: "user-1", Email: "jane@acme.example", OrgID: "org-1", Role: tenant.RoleEditor}
+	seedAccount(t, dataStore, user, false)
+	fake := useFakeOmnistrate(t, user)
+	api := NewUserAPI(metrics.NewMetrics(), dataStore)
+
+	recorder := serveAs(api.DeleteUserHandler, http.MethodDelete, "/user", "/user", user.ID)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status without confirmation = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+	if _, err := dataStore.Users.Get(context.Background(), user.ID); err != nil {
+		t.Fatalf("user deleted without confirmation: %v", err)
+	}
+
+	recorder = serveAs(api.DeleteUserHandler, http.MethodDelete, "/user", "/user?confirm=true", user.ID)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+	if _, err := dataStore.Users.Get(context.Background(), user.ID); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("user record still stored: %v", err)
+	}
+	if deleted := fake.deletedUsers(); !slices.Equal(deleted, []string{user.ID}) {
+		t.Errorf("users deleted from Omnistrate = %q, want %q", deleted, user.ID)
+	}
+}
+
+func TestDeleteOrgUserHandler(t *testing.T) {
+	root := tenant.User{ID: "root", Email: "root@acme.example", OrgID: "org-1", Role: tenant.RoleRoot}
+	admin := tenant.User{ID: "admin", Email: "admin@acme.example", OrgID: "org-1", Role: tenant.RoleAdmin}
+	editor := tenant.User{ID: "editor", Email: "editor@acme.example", OrgID: "org-1", Role: tenant.RoleEditor}
+	outsider := tenant.User{ID: "outsider", Email: "sam@other.example", OrgID: "org-2", Role: tenant.RoleEditor}
+
+	tests := []struct {
+		name       string
+		users      []tenant.User
+		requester  string
+		target     string
+		query      string
+		wantStatus int
+	}{
+		{name: "editor", users: []tenant.User{admin, editor}, requester: editor.ID, target: admin.ID, query: "?confirm=true", wantStatus: http.StatusForbidden},
+		{name: "without confirmation", users: []tenant.User{admin, editor}, requester: admin.ID, target: editor.ID, wantStatus: http.StatusBadRequest},
+		{name: "user of another org", users: []tenant.User{admin, outsider}, requester: admin.ID, target: outsider.ID, query: "?confirm=true", wantStatus: http.StatusNotFound},
+		{name: "unknown user", users: []tenant.User{admin}, requester: admin.ID, target: "nobody", query: "?confirm=true", wantStatus: http.StatusNotFound},
+		{name: "themselves", users: []tenant.User{root, admin}, requester: admin.ID, target: admin.ID, query: "?confirm=true", wantStatus: http.StatusBadRequest},
+		{name: "root user", users: []tenant.User{root, admin}, requester: admin.ID, target: root.ID, query: "?confirm=true", wantStatus: http.StatusForbidden},
+		// The requester's own record is stale and no longer says admin
+		{name: "last admin", users: []tenant.User{admin, {ID: "stale-admin", Email: "stale@acme.example", OrgID: "org-1", Role: tenant.RoleEditor}}, requester: "stale-admin", target: admin.ID, query: "?confirm=true", wantStatus: http.StatusConflict},
+		{name: "one of several admins", users: []tenant.User{root, admin}, requester: root.ID, target: admin.ID, query: "?confirm=true", wantStatus: http.StatusOK},
+		{name: "editor deleted by admin", users: []tenant.User{admin, editor}, requester: admin.ID, target: editor.ID, query: "?confirm=true", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataStore := storetest.New(dbtest.Open(t))
+			for _, user := range tt.users {
+				seedAccount(t, dataStore, user, false)
+			}
+
+			// Omnistrate knows the current roles
+			omnistrateUsers := slices.Clone(tt.users)
+			for i := range omnistrateUsers {
+				if omnistrateUsers[i].ID == "stale-admin" {
+					omnistrateUsers[i].Role = tenant.RoleAdmin
+				}
+			}
+			fake := useFakeOmnistrate(t, omnistrateUsers...)
+			api := NewOrgAPI(metrics.NewMetrics(), dataStore)
+
+			recorder := serveAs(api.DeleteOrgUserHandler, http.MethodDelete, "/org/user/:user_id", "/org/user/"+tt.target+tt.query, tt.requester)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+
+			_, err := dataStore.Users.Get(context.Background(), tt.target)
+			deleted := fake.deletedUsers()
+			if tt.wantStatus == http.StatusOK {
+				if !errors.Is(err, model.ErrNotFound) || !slices.Equal(deleted, []string{tt.target}) {
+					t.Errorf("target still stored (%v) or not deleted from Omnistrate (%q)", err, deleted)
+				}
+				return
+			}
+			if len(deleted) != 0 {
+				t.Errorf("users deleted from Omnistrate = %q, want none", deleted)
+			}
+		})
+	}
+}
+
+func TestDataExportHandler(t *testing.T) {
+	dataStore := storetest.New(dbtest.Open(t))
+	user := tenant.User{ID: "user-1", Email: "jane@acme.example", OrgID: "org-1", Role: tenant.RoleEditor}
+	seedAccount(t, dataStore, user, false)
+	// Another user's data must not end up in the export
+	seedAccount(t, dataStore, tenant.User{ID: "user-2", Email: "sam@acme.example", OrgID: "org-1", Role: tenant.RoleEditor}, false)
+	useFakeOmnistrate(t, user)
+	api := NewUserAPI(metrics.NewMetrics(), dataStore)
+
+	recorder := serveAs(api.DataExportHandler, http.MethodGet, "/user/data-export", "/user/data-export", user.ID)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	if err != nil {
+		t.Fatalf("export is not a zip archive: %v", err)
+	}
+	entries := make(map[string][]byte)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", file.Name, err)
+		}
+		entries[file.Name], err = io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file.Name, err)
+		}
+	}
+
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	wantNames := []string{"profile.json", "shares.json", "threads/user-1-thread.json", "usage.json"}
+	if !slices.Equal(names, wantNames) {
+		t.Fatalf("export entries = %q, want %q", names, wantNames)
+	}
+
+	var profile struct {
+		User    tenant.User `json:"user"`
+		Account struct {
+			ID string `json:"id"`
+		} `json:"account"`
+		ThreadsCount int `json:"threads_count"`
+	}
+	var thread exportedThread
+	var shares []exportedShare
+	var usage []tenant.UsageRecord
+	for name, value := range map[string]any{
+		"profile.json":               &profile,
+		"threads/user-1-thread.json": &thread,
+		"shares.json":                &shares,
+		"usage.json":                 &usage,
+	} {
+		if err = json.Unmarshal(entries[name], value); err != nil {
+			t.Fatalf("failed to decode %s: %v", name, err)
+		}
+	}
+
+	if profile.User.Email != user.Email || profile.Account.ID != user.ID || profile.ThreadsCount != 1 {
+		t.Errorf("profile = %+v, want the stored and the Omnistrate user with one thread", profile)
+	}
+	if thread.Thread.ID != "user-1-thread" || len(thread.Messages) != 2 {
+		t.Errorf("thread = %+v, want the thread with both messages", thread)
+	}
+	if len(shares) != 1 || shares[0].ID != "user-1-share" {
+		t.Errorf("shares = %+v, want the share of the user", shares)
+	}
+	if len(usage) != 1 || usage[0].UserID != user.ID {
+		t.Errorf("usage = %+v, want the record of the user", usage)
+	}
+}
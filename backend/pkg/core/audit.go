@@ -0,0 +1,198 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/audit"
+	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// parseAuditFilter reads the filters shared by the audit listing and export from the query string
+func parseAuditFilter(ctx *gin.Context, orgID string) (filter tenant.AuditFilter, err error) {
+	filter = tenant.AuditFilter{
+		OrgID:   orgID,
+		ActorID: ctx.Query("actor_id"),
+		Action:  ctx.Query("action"),
+		Limit:   defaultAuditPageSize,
+	}
+
+	if value := ctx.Query("from"); value != "" {
+		if filter.From, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, errors.New("from must be an RFC 3339 timestamp")
+		}
+	}
+
+	if value := ctx.Query("to"); value != "" {
+		if filter.To, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, errors.New("to must be an RFC 3339 timestamp")
+		}
+	}
+
+	if value := ctx.Query("before"); value != "" {
+		if filter.BeforeID, err = strconv.ParseInt(value, 10, 64); err != nil || filter.BeforeID <= 0 {
+			return filter, errors.New("before must be an event ID")
+		}
+	}
+
+	if value := ctx.Query("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit <= 0 || filter.Limit > maxAuditPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxAuditPageSize)
+		}
+	}
+
+	return filter, nil
+}
+
+// ListAuditEventsHandler lists the audit events of the org, newest first. Pass next_before of a
+// response as before to get the next page.
+func (o OrgAPI) ListAuditEventsHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to list audit events: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to list audit events")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, o.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.IsOrgAdmin() {
+		ctx.JSON(403, gin.H{"error": "only organization admins can view the audit log"})
+		return
+	}
+
+	filter, filterErr := parseAuditFilter(ctx, user.OrgID)
+	if filterErr != nil {
+		ctx.JSON(400, gin.H{"error": filterErr.Error()})
+		return
+	}
+
+	var events []tenant.AuditEvent
+	if events, err = o.store.Audit.List(ctx.Request.Context(), filter); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A full page may be followed by more events
+	var nextBefore *int64
+	if len(events) == filter.Limit {
+		nextBefore = &events[len(events)-1].ID
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"events": events, "next_before": nextBefore})
+}
+
+// ExportAuditEventsHandler streams all audit events of the org matching the filters as JSON Lines,
+// newest first. The limit parameter is ignored, the export pages through the whole log.
+func (o OrgAPI) ExportAuditEventsHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to export audit events: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to export audit events")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, o.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.IsOrgAdmin() {
+		ctx.JSON(403, gin.H{"error": "only organization admins can export the audit log"})
+		return
+	}
+
+	filter, filterErr := parseAuditFilter(ctx, user.OrgID)
+	if filterErr != nil {
+		ctx.JSON(400, gin.H{"error": filterErr.Error()})
+		return
+	}
+	filter.Limit = maxAuditPageSize
+
+	// Exporting the log is itself audited, before the export so it shows up in it
+	event := audit.Event(audit.ActionAuditExport, user)
+	event.TargetType = "org"
+	event.TargetID = user.OrgID
+	event.Details = map[string]any{"query": ctx.Request.URL.RawQuery}
+	audit.Record(ctx, o.store.Audit, event)
+
+	fileName := fmt.Sprintf("audit-%s.jsonl", time.Now().UTC().Format("20060102-150405"))
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	ctx.Status(http.StatusOK)
+
+	// From here on the response is streamed, errors can only be logged
+	encoder := json.NewEncoder(ctx.Writer)
+	for {
+		var events []tenant.AuditEvent
+		if events, err = o.store.Audit.List(ctx.Request.Context(), filter); err != nil || len(events) == 0 {
+			return
+		}
+
+		for _, event := range events {
+			if err = encoder.Encode(event); err != nil {
+				return
+			}
+		}
+		ctx.Writer.Flush()
+
+		if len(events) < filter.Limit {
+			return
+		}
+		filter.BeforeID = events[len(events)-1].ID
+	}
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/audit"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store/storetest"
+)
+
+func TestExportAuditEventsHandler(t *testing.T) {
+	handle := dbtest.Open(t)
+	dataStore := storetest.New(handle)
+	admin := tenant.User{ID: "admin", Email: "admin@acme.example", OrgID: "org-1", Role: tenant.RoleAdmin}
+	useFakeOmnistrate(t, admin)
+
+	// More than two export batches, interleaved with events of another org
+	var events []tenant.AuditEvent
+	for i := range 2*maxAuditPageSize + 345 {
+		orgID := "org-1"
+		if i%7 == 0 {
+			orgID = "org-2"
+		}
+		events = append(events, tenant.AuditEvent{OrgID: orgID, ActorID: "user-1", Action: audit.ActionSignin, Outcome: tenant.AuditOutcomeSuccess})
+	}
+	if err := handle.CreateInBatches(events, 500).Error; err != nil {
+		t.Fatalf("failed to store audit events: %v", err)
+	}
+	var wantIDs []int64
+	for _, event := range slices.Backward(events) {
+		if event.OrgID == "org-1" {
+			wantIDs = append(wantIDs, event.ID)
+		}
+	}
+
+	api := NewOrgAPI(metrics.NewMetrics(), dataStore)
+	recorder := serveAs(api.ExportAuditEventsHandler, http.MethodGet, "/org/audit/export", "/org/audit/export", admin.ID)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+
+	var exported []tenant.AuditEvent
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var event tenant.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		exported = append(exported, event)
+	}
+
+	// The export records itself first, so it is the newest event
+	if len(exported) == 0 || exported[0].Action != audit.ActionAuditExport || exported[0].ActorID != admin.ID {
+		t.Fatalf("first exported event = %+v, want the export itself", exported[:min(1, len(exported))])
+	}
+
+	var ids []int64
+	for _, event := range exported[1:] {
+		ids = append(ids, event.ID)
+	}
+	if !slices.Equal(ids, wantIDs) {
+		t.Errorf("exported %d events, want the %d events of the org newest first without gaps or duplicates", len(ids), len(wantIDs))
+	}
+}
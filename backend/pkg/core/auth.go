@@ -3,9 +3,13 @@ package core
 import (
 	"context"
 	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/audit"
 	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/logger"
 	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
 	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
 	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -15,11 +19,17 @@ import (
 
 type UserAPI struct {
 	authHandler *auth.Auth
+	metrics     *metrics.Metrics
+	store       *store.Store
+	emails      *emailThrottle
 }
 
-func NewUserAPI(m *metrics.Metrics) *UserAPI {
+func NewUserAPI(m *metrics.Metrics, dataStore *store.Store) *UserAPI {
 	return &UserAPI{
-		authHandler: auth.NewAuth(m),
+		authHandler: auth.NewAuth(m, dataStore),
+		metrics:     m,
+		store:       dataStore,
+		emails:      newEmailThrottle(config.Current.Mail.Cooldown, config.Current.Mail.MaxPerIP, config.Current.Mail.MaxConcurrent),
 	}
 }
 
@@ -30,52 +40,113 @@ func (u UserAPI) SignupHandler(ctx *gin.Context) {
 		if err != nil {
 			var serviceErr *openapiclientv1.GenericOpenAPIError
 			if errors.As(err, &serviceErr) {
-				log.Error().Err(err).Msgf("failed to signup user: %s", string(serviceErr.Body()))
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to signup user: %s", string(serviceErr.Body()))
 				return
 			}
 
-			log.Error().Err(err).Msg("failed to signup user")
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to signup user")
 		}
 	}()
 
 	// Execute the request
-	var data map[string]any
-	if err = ctx.ShouldBindJSON(&data); err != nil {
+	var request auth.SignupRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
 		// Send error back through Gin
 		ctx.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	if data == nil {
-		err = errors.New("missing request body")
-		ctx.JSON(400, gin.H{"error": err.Error()})
+	// Create the tenant
+	var createdUser tenant.User
+	var org tenant.Org
+	if createdUser, org, err = u.authHandler.CreateTenant(ctx.Request.Context(), request); err != nil {
+		event := audit.Event(audit.ActionSignup, tenant.User{Email: request.Email})
+		event.Outcome = tenant.AuditOutcomeFailure
+		event.Details = map[string]any{"reason": authFailureReason(err)}
+		audit.Record(ctx, u.store.Audit, event)
+
+		// Send error back through Gin
+		status, message := authErrorResponse(err)
+		ctx.JSON(status, gin.H{"error": message})
 		return
 	}
 
-	// Create the tenant
-	if _, _, err = u.authHandler.CreateTenant(
-		context.Background(),
-		tenant.User{
-			Email: data["email"].(string),
-			Name:  data["name"].(string),
-			Org: tenant.Org{
-				Name:             data["legal_company_name"].(string),
-				LegalCompanyName: data["legal_company_name"].(string),
-				Description:      data["company_description"].(string),
-				WebsiteURL:       data["company_url"].(string),
-			},
-		},
-		data["password"].(string),
-	); err != nil {
-		// Send error back through Gin
-		ctx.JSON(500, gin.H{"error": err.Error()})
+	// The account exists but cannot be used before the email is verified
+	if createdUser.ID == "" {
+		audit.Record(ctx, u.store.Audit, audit.Event(audit.ActionSignup, tenant.User{Email: request.Email}))
+
+		// The org is stored on the first sign-in, Omnistrate would not return the legal company name then.
+		// The local provider stored the org already.
+		if config.Current.Auth.Provider != config.AuthProviderLocal {
+			signup := tenant.PendingSignup{Email: strings.ToLower(strings.TrimSpace(request.Email)), LegalCompanyName: org.LegalCompanyName}
+			if saveErr := u.store.Signups.Save(ctx.Request.Context(), &signup); saveErr != nil {
+				log.Ctx(ctx.Request.Context()).Error().Err(saveErr).Msg("failed to store pending signup")
+			}
+		}
+		ctx.JSON(http.StatusAccepted, gin.H{"message": "User created, verify the email address before signing in"})
 		return
 	}
 
+	audit.Record(ctx, u.store.Audit, audit.Event(audit.ActionSignup, createdUser))
+
+	// Omnistrate does not return the legal company name, keep the one given at signup. The tenant
+	// exists at this point, a failure is repaired by the next sign-in.
+	createdUser.Org.LegalCompanyName = org.LegalCompanyName
+	if syncErr := u.store.SyncUser(ctx.Request.Context(), createdUser); syncErr != nil {
+		log.Ctx(ctx.Request.Context()).Error().Err(syncErr).Msg("failed to store signed up user")
+	}
+
 	// Send the response back through Gin
 	ctx.JSON(http.StatusOK, gin.H{"message": "User created successfully"})
 }
 
+// statusClientClosedRequest is reported, and logged, for requests the client gave up on before
+// they were answered
+const statusClientClosedRequest = 499
+
+// authErrorResponse returns the status code and message reported for a failed account operation.
+// Unexpected errors are not passed on, they may contain details of the Omnistrate request.
+func authErrorResponse(err error) (int, string) {
+	var authErr *auth.Error
+	switch {
+	case errors.As(err, &authErr) && (errors.Is(err, auth.ErrInvalidInput) || errors.Is(err, auth.ErrInvalidPassword)):
+		return http.StatusBadRequest, authErr.Error()
+	case errors.Is(err, auth.ErrInvalidToken):
+		return http.StatusBadRequest, auth.ErrInvalidToken.Error()
+	case errors.Is(err, auth.ErrAlreadyExists):
+		return http.StatusConflict, auth.ErrAlreadyExists.Error()
+	case errors.Is(err, auth.ForbiddenError):
+		return http.StatusForbidden, "forbidden"
+	case errors.Is(err, auth.ErrRateLimited):
+		return http.StatusTooManyRequests, auth.ErrRateLimited.Error()
+	case errors.Is(err, auth.ErrUpstreamUnavailable):
+		return http.StatusServiceUnavailable, auth.ErrUpstreamUnavailable.Error()
+	case errors.Is(err, auth.ErrUpstreamTimeout):
+		return http.StatusGatewayTimeout, auth.ErrUpstreamTimeout.Error()
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest, "request canceled"
+	}
+	return http.StatusInternalServerError, "internal error"
+}
+
+// authFailureReason names the outcome of a failed signup or sign-in for the audit log
+func authFailureReason(err error) string {
+	for _, kind := range []error{auth.ErrInvalidInput, auth.ErrInvalidPassword, auth.ErrInvalidToken, auth.ErrAlreadyExists, auth.ForbiddenError, auth.ErrRateLimited, auth.ErrUpstreamUnavailable, auth.ErrUpstreamTimeout} {
+		if errors.Is(err, kind) {
+			return kind.Error()
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	return "error"
+}
+
+type signinRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
 func (u UserAPI) SigninHandler(ctx *gin.Context) {
 	var err error
 
@@ -83,33 +154,155 @@ func (u UserAPI) SigninHandler(ctx *gin.Context) {
 		if err != nil {
 			var serviceErr *openapiclientv1.GenericOpenAPIError
 			if errors.As(err, &serviceErr) {
-				log.Error().Err(err).Msgf("failed to signin user: %s", string(serviceErr.Body()))
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to signin user: %s", string(serviceErr.Body()))
 				return
 			}
-			log.Error().Err(err).Msg("failed to signin user")
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to signin user")
 		}
 	}()
 
 	// Execute the request
-	var data map[string]any
-	if err = ctx.ShouldBindJSON(&data); err != nil {
+	var request signinRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
 		// Send error back through Gin
 		ctx.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	if data == nil {
-		err = errors.New("missing request body")
+	var session auth.Session
+	var user tenant.User
+	if session, user, err = u.authHandler.AuthenticateTenant(
+		ctx.Request.Context(),
+		strings.TrimSpace(request.Email),
+		request.Password,
+	); err != nil {
+		u.recordFailedSignin(ctx, strings.TrimSpace(request.Email), err)
+
+		// Unknown users and wrong passwords are rejected with ForbiddenError, by Omnistrate also as invalid input
+		switch {
+		case errors.Is(err, auth.ForbiddenError), errors.Is(err, auth.ErrInvalidInput), errors.Is(err, auth.ErrInvalidPassword):
+			ctx.JSON(403, gin.H{"error": "invalid credentials"})
+		default:
+			// Send error back through Gin
+			status, message := authErrorResponse(err)
+			ctx.JSON(status, gin.H{"error": message})
+		}
+		return
+	}
+
+	audit.Record(ctx, u.store.Audit, audit.Event(audit.ActionSignin, user))
+
+	// The user is signed in, a stale local copy must not lock them out. It is repaired by the next
+	// request that stores the user.
+	if syncErr := u.store.SyncUser(ctx.Request.Context(), user); syncErr != nil {
+		log.Ctx(ctx.Request.Context()).Error().Err(syncErr).Msg("failed to store signed in user")
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, sessionResponse(session))
+}
+
+// sessionResponse returns the tokens of a session. Providers without refresh tokens only return the
+// access token.
+func sessionResponse(session auth.Session) gin.H {
+	response := gin.H{"token": session.Token}
+	if session.RefreshToken != "" {
+		response["refresh_token"] = session.RefreshToken
+	}
+	if !session.ExpiresAt.IsZero() {
+		response["expires_at"] = session.ExpiresAt
+	}
+	return response
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshHandler exchanges a refresh token for a new access token and refresh token. Every refresh
+// token can only be used once.
+func (u UserAPI) RefreshHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to refresh session")
+		}
+	}()
+
+	var request refreshRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
+		// Send error back through Gin
 		ctx.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	var jwtToken string
-	if jwtToken, err = u.authHandler.AuthenticateTenant(
-		context.Background(),
-		data["email"].(string),
-		data["password"].(string),
-	); err != nil {
+	var session auth.Session
+	if session, _, err = u.authHandler.RefreshSession(ctx.Request.Context(), request.RefreshToken); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrNotSupported):
+			ctx.JSON(http.StatusNotImplemented, gin.H{"error": "refresh tokens are " + auth.ErrNotSupported.Error() + ", sign in again"})
+		case errors.Is(err, auth.ForbiddenError):
+			ctx.JSON(403, gin.H{"error": "invalid refresh token"})
+		default:
+			// Send error back through Gin
+			ctx.JSON(500, gin.H{"error": "internal error"})
+		}
+		return
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, sessionResponse(session))
+}
+
+// recordFailedSignin audits a failed sign-in. The caller is not authenticated, so only the email is
+// recorded as actor, the attempt is attributed to the org of a known user with that email.
+func (u UserAPI) recordFailedSignin(ctx *gin.Context, email string, err error) {
+	event := audit.Event(audit.ActionSignin, tenant.User{Email: email})
+	event.Outcome = tenant.AuditOutcomeFailure
+	event.Details = map[string]any{"reason": authFailureReason(err)}
+
+	if user, err := u.store.Users.GetByEmail(ctx.Request.Context(), email); err == nil {
+		event.OrgID = user.OrgID
+		event.TargetType = "user"
+		event.TargetID = user.ID
+	}
+
+	audit.Record(ctx, u.store.Audit, event)
+}
+
+// describeTenant describes the user of the token and attributes the rest of the request to them
+func describeTenant(ctx *gin.Context, authHandler *auth.Auth, jwtToken string) (user tenant.User, err error) {
+	if user, err = authHandler.DescribeTenant(ctx.Request.Context(), jwtToken); err != nil {
+		return
+	}
+
+	ctx.Request = ctx.Request.WithContext(logger.WithUser(ctx.Request.Context(), user.ID, user.OrgID))
+	return
+}
+
+func (u UserAPI) UserProfileHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to get user profile: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to get user profile")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	// Execute the request
+	var user tenant.User
+	if user, err = describeTenant(ctx, u.authHandler, jwtToken); err != nil {
 		if errors.Is(err, auth.ForbiddenError) {
 			ctx.JSON(403, gin.H{"error": "invalid credentials"})
 			return
@@ -120,22 +313,49 @@ func (u UserAPI) SigninHandler(ctx *gin.Context) {
 		return
 	}
 
+	// Pick up changes made in Omnistrate directly. Like on sign-in, a stale local copy must not keep
+	// the user from seeing their profile.
+	if syncErr := u.store.SyncUser(ctx.Request.Context(), user); syncErr != nil {
+		log.Ctx(ctx.Request.Context()).Error().Err(syncErr).Msg("failed to store described user")
+	}
+
 	// Send the response back through Gin
-	ctx.JSON(http.StatusOK, gin.H{"token": jwtToken})
+	ctx.JSON(http.StatusOK, gin.H{"user": userProfile(user)})
 }
 
-func (u UserAPI) UserProfileHandler(ctx *gin.Context) {
+// userProfile is the profile of the user in the field names of Omnistrate's describe user call,
+// whichever provider described them
+func userProfile(user tenant.User) gin.H {
+	return gin.H{
+		"id":             user.ID,
+		"email":          user.Email,
+		"name":           user.Name,
+		"roleType":       user.Role,
+		"orgId":          user.OrgID,
+		"orgName":        user.Org.Name,
+		"orgDescription": user.Org.Description,
+		"orgLogoURL":     user.Org.LogoURL,
+		"orgURL":         user.Org.WebsiteURL,
+	}
+}
+
+type updateProfileRequest struct {
+	Name *string `json:"name"`
+}
+
+// UpdateProfileHandler changes the user's profile in Omnistrate and the local copy
+func (u UserAPI) UpdateProfileHandler(ctx *gin.Context) {
 	var err error
 
 	defer func() {
 		if err != nil {
 			var serviceErr *openapiclientv1.GenericOpenAPIError
 			if errors.As(err, &serviceErr) {
-				log.Error().Err(err).Msgf("failed to get user profile: %s", string(serviceErr.Body()))
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to update user profile: %s", string(serviceErr.Body()))
 				return
 			}
 
-			log.Error().Err(err).Msg("failed to get user profile")
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to update user profile")
 		}
 	}()
 
@@ -143,14 +363,10 @@ func (u UserAPI) UserProfileHandler(ctx *gin.Context) {
 	authHeader := ctx.GetHeader("Authorization")
 	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
 
-	// Execute the request
-	var user *openapiclientv1.DescribeUserResult
-	if _, user, err = u.authHandler.DescribeTenant(
-		context.Background(),
-		jwtToken,
-	); err != nil {
+	var user tenant.User
+	if user, err = describeTenant(ctx, u.authHandler, jwtToken); err != nil {
 		if errors.Is(err, auth.ForbiddenError) {
-			ctx.JSON(403, gin.H{"error": "invalid credentials"})
+			ctx.JSON(403, gin.H{"error": "forbidden"})
 			return
 		}
 
@@ -159,6 +375,39 @@ func (u UserAPI) UserProfileHandler(ctx *gin.Context) {
 		return
 	}
 
+	var request updateProfileRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
+		// Send error back through Gin
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Name != nil && strings.TrimSpace(*request.Name) == "" {
+		ctx.JSON(400, gin.H{"error": "name must not be empty"})
+		return
+	}
+
+	var updated tenant.User
+	if updated, err = u.authHandler.UpdateTenant(ctx.Request.Context(), jwtToken, user.ID, auth.TenantUpdate{Name: request.Name}); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = u.store.SyncUser(ctx.Request.Context(), updated); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := audit.Event(audit.ActionUserProfileUpdate, user)
+	event.TargetType = "user"
+	event.TargetID = user.ID
+	audit.Record(ctx, u.store.Audit, event)
+
 	// Send the response back through Gin
-	ctx.JSON(http.StatusOK, gin.H{"user": user})
+	ctx.JSON(http.StatusOK, gin.H{"user": updated})
 }
@@ -0,0 +1,391 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store/storetest"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+func TestAuthErrorResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:        "invalid input",
+			err:         &auth.Error{Kind: auth.ErrInvalidInput, Message: "email is not valid"},
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "invalid input: email is not valid",
+		},
+		{
+			name:        "invalid password",
+			err:         errors.Wrap(&auth.Error{Kind: auth.ErrInvalidPassword, Message: "too short"}, "failed to sign up"),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "password does not meet the requirements: too short",
+		},
+		{
+			name:        "already exists",
+			err:         &auth.Error{Kind: auth.ErrAlreadyExists},
+			wantStatus:  http.StatusConflict,
+			wantMessage: auth.ErrAlreadyExists.Error(),
+		},
+		{
+			name:        "forbidden",
+			err:         errors.Wrap(auth.ForbiddenError, "failed to describe tenant"),
+			wantStatus:  http.StatusForbidden,
+			wantMessage: "forbidden",
+		},
+		{
+			name:        "rate limited",
+			err:         &auth.Error{Kind: auth.ErrRateLimited},
+			wantStatus:  http.StatusTooManyRequests,
+			wantMessage: auth.ErrRateLimited.Error(),
+		},
+		{
+			name:        "upstream unavailable",
+			err:         &auth.Error{Kind: auth.ErrUpstreamUnavailable},
+			wantStatus:  http.StatusServiceUnavailable,
+			wantMessage: auth.ErrUpstreamUnavailable.Error(),
+		},
+		{
+			name:        "upstream timeout",
+			err:         &auth.Error{Kind: auth.ErrUpstreamTimeout},
+			wantStatus:  http.StatusGatewayTimeout,
+			wantMessage: auth.ErrUpstreamTimeout.Error(),
+		},
+		{
+			name:        "canceled",
+			err:         errors.Wrap(context.Canceled, "failed to execute tenant signin request"),
+			wantStatus:  statusClientClosedRequest,
+			wantMessage: "request canceled",
+		},
+		{
+			name:        "unexpected",
+			err:         errors.New("dial tcp 10.0.0.1:443: connection refused"),
+			wantStatus:  http.StatusInternalServerError,
+			wantMessage: "internal error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, message := authErrorResponse(tt.err)
+			if status != tt.wantStatus || message != tt.wantMessage {
+				t.Errorf("authErrorResponse() = %d, %q, want %d, %q", status, message, tt.wantStatus, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestSigninHandler(t *testing.T) {
+	user := tenant.User{ID: "user-1", Email: "jane@acme.example", OrgID: "org-1", Role: tenant.RoleAdmin}
+
+	tests := []struct {
+		name          string
+		email         string
+		omnistrate    int
+		wantStatus    int
+		wantError     string
+		wantLegalName string
+	}{
+		{name: "signed in", email: user.Email, wantStatus: http.StatusOK, wantLegalName: "Acme Corporation"},
+		{name: "unknown user", email: "sam@acme.example", wantStatus: http.StatusForbidden, wantError: "invalid credentials"},
+		{name: "bad request", email: user.Email, omnistrate: http.StatusBadRequest, wantStatus: http.StatusForbidden, wantError: "invalid credentials"},
+		{name: "unauthorized", email: user.Email, omnistrate: http.StatusUnauthorized, wantStatus: http.StatusForbidden, wantError: "invalid credentials"},
+		{name: "forbidden", email: user.Email, omnistrate: http.StatusForbidden, wantStatus: http.StatusForbidden, wantError: "invalid credentials"},
+		{name: "Omnistrate fails", email: user.Email, omnistrate: http.StatusInternalServerError, wantStatus: http.StatusServiceUnavailable, wantError: auth.ErrUpstreamUnavailable.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dataStore := storetest.New(dbtest.Open(t))
+			useFakeOmnistrate(t, user).rejectSignins(tt.omnistrate)
+
+			// The user signed up without being verified right away
+			if err := dataStore.Signups.Save(ctx, &tenant.PendingSignup{Email: user.Email, LegalCompanyName: "Acme Corporation"}); err != nil {
+				t.Fatalf("failed to store pending signup: %v", err)
+			}
+
+			engine := gin.New()
+			engine.POST("/user/signin", NewUserAPI(metrics.NewMetrics(), dataStore).SigninHandler)
+			body := `{"email": "` + tt.email + `", "password": "secret"}`
+			request := httptest.NewRequest(http.MethodPost, "/user/signin", strings.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			var response struct {
+				Token string `json:"token"`
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid response %s: %v", recorder.Body, err)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if response.Token != user.ID {
+				t.Errorf("token = %q, want %q", response.Token, user.ID)
+			}
+			org, err := dataStore.Orgs.Get(ctx, user.OrgID)
+			if err != nil {
+				t.Fatalf("failed to get org: %v", err)
+			}
+			if org.LegalCompanyName != tt.wantLegalName {
+				t.Errorf("legal company name = %q, want %q from the signup", org.LegalCompanyName, tt.wantLegalName)
+			}
+		})
+	}
+}
+
+// useLocalProvider makes the local provider manage the accounts for the duration of the test, with
+// signups that have to verify their email
+func useLocalProvider(t *testing.T) {
+	t.Helper()
+
+	cfg := *config.Current
+	cfg.Auth.Provider = config.AuthProviderLocal
+	cfg.Auth.JWTSecret = "0123456789abcdef0123456789abcdef"
+	cfg.Auth.AutoVerifySignups = false
+	cfg.Mail.Transport = config.MailTransportLog
+
+	previous := config.Current
+	config.Current = &cfg
+	t.Cleanup(func() { config.Current = previous })
+}
+
+// mailbox collects the emails the log mailer writes
+type mailbox struct {
+	mu    sync.Mutex
+	lines bytes.Buffer
+}
+
+func useMailbox(t *testing.T) *mailbox {
+	t.Helper()
+
+	m := &mailbox{}
+	logger := zerolog.New(m)
+	previous := zerolog.DefaultContextLogger
+	zerolog.DefaultContextLogger = &logger
+	t.Cleanup(func() { zerolog.DefaultContextLogger = previous })
+	return m
+}
+
+func (m *mailbox) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lines.Write(p)
+}
+
+// link returns the link of the latest email to the address
+func (m *mailbox) link(t *testing.T, to string) *url.URL {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var link *url.URL
+	scanner := bufio.NewScanner(bytes.NewReader(m.lines.Bytes()))
+	for scanner.Scan() {
+		var email struct {
+			To   string `json:"to"`
+			Body string `json:"body"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &email) != nil || email.To != to {
+			continue
+		}
+		for _, field := range strings.Fields(email.Body) {
+			if parsed, err := url.Parse(field); err == nil && parsed.Scheme != "" {
+				link = parsed
+			}
+		}
+	}
+	if link == nil {
+		t.Fatalf("no email with a link to %s", to)
+	}
+	return link
+}
+
+// postJSON sends body to the handler and decodes the response into response
+func postJSON(t *testing.T, handler gin.HandlerFunc, target string, body any, response any) int {
+	t.Helper()
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	engine := gin.New()
+	engine.POST(target, handler)
+	request := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(encoded))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+
+	if err = json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("invalid response %s: %v", recorder.Body, err)
+	}
+	return recorder.Code
+}
+
+type sessionBody struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Error        string    `json:"error"`
+}
+
+func TestLocalSignupVerifySignin(t *testing.T) {
+	ctx := context.Background()
+	useLocalProvider(t)
+	emails := useMailbox(t)
+	dataStore := storetest.New(dbtest.Open(t))
+	api := NewUserAPI(metrics.NewMetrics(), dataStore)
+
+	const email = "jane@acme.example"
+	const password = "correct horse battery staple"
+	credentials := gin.H{"email": email, "password": password}
+
+	var signup struct {
+		Message string `json:"message"`
+	}
+	body := gin.H{"email": email, "password": password, "name": "Jane", "legal_company_name": "Acme Corporation"}
+	if status := postJSON(t, api.SignupHandler, "/user", body, &signup); status != http.StatusAccepted {
+		t.Fatalf("signup status = %d, want %d", status, http.StatusAccepted)
+	}
+
+	var session sessionBody
+	if status := postJSON(t, api.SigninHandler, "/user/signin", credentials, &session); status != http.StatusForbidden {
+		t.Fatalf("sign-in before verifying status = %d, want %d", status, http.StatusForbidden)
+	}
+
+	// The emailed link carries the address and the token
+	link := emails.link(t, email)
+	if link.Path != "/verify-email" {
+		t.Errorf("link path = %q, want /verify-email", link.Path)
+	}
+	var verified gin.H
+	verify := gin.H{"email": link.Query().Get("email"), "token": link.Query().Get("token")}
+	if status := postJSON(t, api.VerifyEmailHandler, "/user/verify", verify, &verified); status != http.StatusOK {
+		t.Fatalf("verify status = %d, want %d: %v", status, http.StatusOK, verified)
+	}
+
+	if status := postJSON(t, api.SigninHandler, "/user/signin", credentials, &session); status != http.StatusOK {
+		t.Fatalf("sign-in status = %d, want %d: %s", status, http.StatusOK, session.Error)
+	}
+	if session.Token == "" || session.RefreshToken == "" || !session.ExpiresAt.After(time.Now()) {
+		t.Errorf("session = %+v, want an access token, a refresh token and its expiry", session)
+	}
+
+	// The token works on the other handlers, the org was stored at signup
+	recorder := serveAs(api.UserProfileHandler, http.MethodGet, "/user/profile", "/user/profile", session.Token)
+	var profile struct {
+		User map[string]string `json:"user"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &profile); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("profile = %d %s, want %d", recorder.Code, recorder.Body, http.StatusOK)
+	}
+	if profile.User["email"] != email || profile.User["orgName"] != "Acme Corporation" {
+		t.Errorf("profile = %v, want the signed up user and org", profile.User)
+	}
+	org, err := dataStore.Orgs.Get(ctx, profile.User["orgId"])
+	if err != nil || org.LegalCompanyName != "Acme Corporation" {
+		t.Errorf("stored org = %+v, %v, want the legal company name from the signup", org, err)
+	}
+	if _, err = dataStore.Signups.Take(ctx, email); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("pending signup error = %v, want %v, the local provider stores the org right away", err, model.ErrNotFound)
+	}
+}
+
+func TestRefreshHandler(t *testing.T) {
+	useLocalProvider(t)
+	emails := useMailbox(t)
+	api := NewUserAPI(metrics.NewMetrics(), storetest.New(dbtest.Open(t)))
+
+	const email = "jane@acme.example"
+	const password = "correct horse battery staple"
+	body := gin.H{"email": email, "password": password, "name": "Jane", "legal_company_name": "Acme"}
+	var response gin.H
+	if status := postJSON(t, api.SignupHandler, "/user", body, &response); status != http.StatusAccepted {
+		t.Fatalf("signup status = %d, want %d", status, http.StatusAccepted)
+	}
+	link := emails.link(t, email)
+	verify := gin.H{"email": email, "token": link.Query().Get("token")}
+	if status := postJSON(t, api.VerifyEmailHandler, "/user/verify", verify, &response); status != http.StatusOK {
+		t.Fatalf("verify status = %d, want %d", status, http.StatusOK)
+	}
+	var signin sessionBody
+	if status := postJSON(t, api.SigninHandler, "/user/signin", gin.H{"email": email, "password": password}, &signin); status != http.StatusOK {
+		t.Fatalf("sign-in status = %d, want %d: %s", status, http.StatusOK, signin.Error)
+	}
+
+	tests := []struct {
+		name       string
+		body       any
+		wantStatus int
+		wantError  string
+	}{
+		{name: "refresh token", body: gin.H{"refresh_token": signin.RefreshToken}, wantStatus: http.StatusOK},
+		{name: "used refresh token", body: gin.H{"refresh_token": signin.RefreshToken}, wantStatus: http.StatusForbidden, wantError: "invalid refresh token"},
+		{name: "unknown refresh token", body: gin.H{"refresh_token": "not-a-token"}, wantStatus: http.StatusForbidden, wantError: "invalid refresh token"},
+		{name: "access token", body: gin.H{"refresh_token": signin.Token}, wantStatus: http.StatusForbidden, wantError: "invalid refresh token"},
+		{name: "missing refresh token", body: gin.H{}, wantStatus: http.StatusBadRequest},
+	}
+	// Steps in order, the first refresh uses up the token
+	for _, tt := range tests {
+		var session sessionBody
+		status := postJSON(t, api.RefreshHandler, "/user/token/refresh", tt.body, &session)
+		if status != tt.wantStatus {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.name, status, tt.wantStatus, session.Error)
+		}
+		if tt.wantError != "" && session.Error != tt.wantError {
+			t.Errorf("%s: error = %q, want %q", tt.name, session.Error, tt.wantError)
+		}
+		if status != http.StatusOK {
+			continue
+		}
+
+		if session.Token == "" || session.RefreshToken == "" || session.RefreshToken == signin.RefreshToken {
+			t.Errorf("%s: session = %+v, want a new access token and refresh token", tt.name, session)
+		}
+		recorder := serveAs(api.UserProfileHandler, http.MethodGet, "/user/profile", "/user/profile", session.Token)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s: profile with the refreshed access token status = %d, want %d", tt.name, recorder.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestRefreshHandlerOmnistrate(t *testing.T) {
+	api := NewUserAPI(metrics.NewMetrics(), storetest.New(dbtest.Open(t)))
+
+	var response sessionBody
+	status := postJSON(t, api.RefreshHandler, "/user/token/refresh", gin.H{"refresh_token": "token"}, &response)
+	if status != http.StatusNotImplemented {
+		t.Errorf("status = %d, want %d: Omnistrate issues no refresh tokens", status, http.StatusNotImplemented)
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
 	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
 	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
 	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/moderation"
+	"github.com/omnistrate-community/ai-chatbot/pkg/redaction"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
 	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
 	"github.com/rs/zerolog/log"
-	"gorm.io/gorm"
 	"net/http"
 	"strings"
 )
@@ -18,26 +22,39 @@ import (
 type Chat struct {
 	metrics     *metrics.Metrics
 	authHandler *auth.Auth
+	store       *store.Store
+	redactor    *redaction.Pipeline
+	classifier  moderation.Classifier
 }
 
-func NewChat(metricsService *metrics.Metrics) *Chat {
+// NewChat returns the chat API. classifier may be nil to disable moderation.
+func NewChat(metricsService *metrics.Metrics, dataStore *store.Store, classifier moderation.Classifier) *Chat {
 	return &Chat{
 		metrics:     metricsService,
-		authHandler: auth.NewAuth(metricsService),
+		authHandler: auth.NewAuth(metricsService, dataStore),
+		store:       dataStore,
+		redactor:    redaction.NewPipeline(redaction.DefaultDetectors()...),
+		classifier:  classifier,
 	}
 }
 
-func (c *Chat) startThread(threadName string, user tenant.User) (thread *ThreadContext, err error) {
-	thread = NewThreadContext(c.metrics, threadName, user)
+func (c *Chat) startThread(ctx context.Context, threadName string, user tenant.User) (thread *ThreadContext, err error) {
+	thread = NewThreadContext(c.metrics, c.store, threadName, user)
 
-	if err = thread.Save(); err != nil {
+	if err = thread.Save(ctx); err != nil {
 		err = errors.Join(err, errors.New("failed to save thread"))
 		return
 	}
 
+	recordUsage(ctx, c.store, user, tenant.UsageRecord{ThreadsCreated: 1})
+
 	return
 }
 
+type newThreadRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
 func (c *Chat) NewThreadHandler(ctx *gin.Context) {
 	var err error
 	var threadName string
@@ -46,11 +63,11 @@ func (c *Chat) NewThreadHandler(ctx *gin.Context) {
 		if err != nil {
 			var serviceErr *openapiclientv1.GenericOpenAPIError
 			if errors.As(err, &serviceErr) {
-				log.Error().Err(err).Msgf("failed to start thread: %s", string(serviceErr.Body()))
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to start thread: %s", string(serviceErr.Body()))
 				return
 			}
 
-			log.Error().Err(err).Str("thread_name", threadName).Msg("failed to start thread")
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Str("thread_name", threadName).Msg("failed to start thread")
 		}
 	}()
 
@@ -60,7 +77,7 @@ func (c *Chat) NewThreadHandler(ctx *gin.Context) {
 
 	// Get user context
 	var user tenant.User
-	if user, _, err = c.authHandler.DescribeTenant(context.Background(), jwtToken); err != nil {
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
 		if errors.Is(err, auth.ForbiddenError) {
 			// Handle the error
 			ctx.JSON(403, gin.H{"error": "forbidden"})
@@ -73,23 +90,17 @@ func (c *Chat) NewThreadHandler(ctx *gin.Context) {
 	}
 
 	// Start a new thread
-	var data map[string]any
-	if err = ctx.BindJSON(&data); err != nil {
+	var request newThreadRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
 		// Handle the error
 		ctx.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	if data == nil {
-		// Handle the error
-		ctx.JSON(400, gin.H{"error": "missing thread name"})
-		return
-	}
-
-	threadName = data["name"].(string)
+	threadName = request.Name
 
 	var thread *ThreadContext
-	if thread, err = c.startThread(threadName, user); err != nil {
+	if thread, err = c.startThread(ctx.Request.Context(), threadName, user); err != nil {
 		// Handle the error
 		ctx.JSON(500, gin.H{"error": err.Error()})
 		return
@@ -106,11 +117,11 @@ func (c *Chat) ListThreadsHandler(ctx *gin.Context) {
 		if err != nil {
 			var serviceErr *openapiclientv1.GenericOpenAPIError
 			if errors.As(err, &serviceErr) {
-				log.Error().Err(err).Msgf("failed to list threads: %s", string(serviceErr.Body()))
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to list threads: %s", string(serviceErr.Body()))
 				return
 			}
 
-			log.Error().Err(err).Msg("failed to list threads")
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to list threads")
 		}
 	}()
 
@@ -119,7 +130,7 @@ func (c *Chat) ListThreadsHandler(ctx *gin.Context) {
 	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
 
 	var user tenant.User
-	if user, _, err = c.authHandler.DescribeTenant(context.Background(), jwtToken); err != nil {
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
 		if errors.Is(err, auth.ForbiddenError) {
 			// Handle the error
 			ctx.JSON(403, gin.H{"error": "forbidden"})
@@ -133,7 +144,7 @@ func (c *Chat) ListThreadsHandler(ctx *gin.Context) {
 
 	// List all threads for the user
 	var threads []core.Thread
-	if threads, err = core.GetThreadsForUser(user.ID); err != nil {
+	if threads, err = c.store.Threads.ListForUser(ctx.Request.Context(), user.ID); err != nil {
 		// Handle the error
 		ctx.JSON(500, gin.H{"error": err.Error()})
 		return
@@ -150,11 +161,11 @@ func (c *Chat) GetThreadHandler(ctx *gin.Context) {
 		if err != nil {
 			var serviceErr *openapiclientv1.GenericOpenAPIError
 			if errors.As(err, &serviceErr) {
-				log.Error().Err(err).Msgf("failed to get thread details: %s", string(serviceErr.Body()))
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to get thread details: %s", string(serviceErr.Body()))
 				return
 			}
 
-			log.Error().Err(err).Str("thread_id", ctx.Param("thread_id")).Msg("failed to get thread details")
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to get thread details")
 		}
 	}()
 
@@ -163,7 +174,7 @@ func (c *Chat) GetThreadHandler(ctx *gin.Context) {
 	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
 
 	var user tenant.User
-	if user, _, err = c.authHandler.DescribeTenant(context.Background(), jwtToken); err != nil {
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
 		if errors.Is(err, auth.ForbiddenError) {
 			// Handle the error
 			ctx.JSON(403, gin.H{"error": "forbidden"})
@@ -180,8 +191,8 @@ func (c *Chat) GetThreadHandler(ctx *gin.Context) {
 
 	// Get the thread
 	var thread core.Thread
-	if thread, err = core.GetThreadByID(threadID, user.ID); err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+	if thread, err = c.store.Threads.Get(ctx.Request.Context(), threadID, user.ID); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
 			// Handle the error
 			ctx.JSON(404, gin.H{"error": "thread not found"})
 			return
@@ -194,7 +205,7 @@ func (c *Chat) GetThreadHandler(ctx *gin.Context) {
 
 	// Get messages for thread
 	var messages []core.Message
-	if messages, err = thread.GetMessages(); err != nil {
+	if messages, err = c.store.Messages.ListForThread(ctx.Request.Context(), thread.ID); err != nil {
 		// Handle the error
 		ctx.JSON(500, gin.H{"error": err.Error()})
 		return
@@ -204,6 +215,10 @@ func (c *Chat) GetThreadHandler(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"thread_id": thread.ID, "thread_name": thread.Name, "messages": messages})
 }
 
+type queryThreadRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
 func (c *Chat) QueryThreadHandler(ctx *gin.Context) {
 	var err error
 
@@ -211,11 +226,11 @@ func (c *Chat) QueryThreadHandler(ctx *gin.Context) {
 		if err != nil {
 			var serviceErr *openapiclientv1.GenericOpenAPIError
 			if errors.As(err, &serviceErr) {
-				log.Error().Err(err).Msgf("failed to query thread: %s", string(serviceErr.Body()))
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to query thread: %s", string(serviceErr.Body()))
 				return
 			}
 
-			log.Error().Err(err).Msg("failed to query thread")
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to query thread")
 		}
 	}()
 
@@ -225,7 +240,7 @@ func (c *Chat) QueryThreadHandler(ctx *gin.Context) {
 
 	// Get user context
 	var user tenant.User
-	if user, _, err = c.authHandler.DescribeTenant(context.Background(), jwtToken); err != nil {
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
 		if errors.Is(err, auth.ForbiddenError) {
 			// Handle the error
 			ctx.JSON(403, gin.H{"error": "forbidden"})
@@ -242,8 +257,8 @@ func (c *Chat) QueryThreadHandler(ctx *gin.Context) {
 
 	// Get the thread
 	var thread core.Thread
-	if thread, err = core.GetThreadByID(threadID, user.ID); err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+	if thread, err = c.store.Threads.Get(ctx.Request.Context(), threadID, user.ID); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
 			// Handle the error
 			ctx.JSON(404, gin.H{"error": "thread not found"})
 			return
@@ -255,28 +270,56 @@ func (c *Chat) QueryThreadHandler(ctx *gin.Context) {
 	}
 
 	// Get the query from the request body
-	var data map[string]any
-	if err = ctx.BindJSON(&data); err != nil {
+	var request queryThreadRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
 		// Handle the error
 		ctx.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	if data == nil {
-		// Handle the error
-		ctx.JSON(400, gin.H{"error": "missing query"})
+	// Do not start generations that a shutdown would cut off
+	if !utils.InflightQueries.Begin() {
+		ctx.Header("Retry-After", "5")
+		ctx.JSON(503, gin.H{"error": "server is shutting down"})
 		return
 	}
+	defer utils.InflightQueries.Done()
 
-	// Query the thread
-	threadContext := FromThread(c.metrics, thread)
+	c.metrics.IncrementTotalRequests(user.ID, user.OrgID, user.Email)
+
+	// Query the thread on behalf of the authenticated user
+	thread.User = user
+	threadContext := FromThread(c.metrics, c.store, c.redactor, c.classifier, thread)
 	var response string
-	if response, err = threadContext.Query(context.Background(), data["message"].(string)); err != nil {
+	var verdict *core.ModerationVerdict
+	// Keep generating even if the client goes away, so the response is still stored with the thread
+	if response, verdict, err = threadContext.Query(context.WithoutCancel(ctx.Request.Context()), request.Message); err != nil {
+		var blockedErr *redaction.BlockedError
+		if errors.As(err, &blockedErr) {
+			// Refused by the org's policy, nothing to log as a failure
+			ctx.JSON(422, gin.H{"error": blockedErr.Error(), "categories": blockedErr.Categories})
+			err = nil
+			return
+		}
+
+		var refusedErr *moderation.RefusedError
+		if errors.As(err, &refusedErr) {
+			ctx.JSON(422, gin.H{"error": refusedErr.Error(), "categories": refusedErr.Categories})
+			err = nil
+			return
+		}
+
 		// Handle the error
 		ctx.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Annotated and withheld responses carry the verdict, so the frontend can flag them
+	if verdict != nil && (verdict.Action == string(moderation.ActionAnnotate) || moderation.Refused(verdict)) {
+		ctx.JSON(http.StatusOK, gin.H{"response": response, "moderation": verdict})
+		return
+	}
+
 	// Send the response back through Gin
 	ctx.JSON(http.StatusOK, gin.H{"response": response})
 }
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/conversation"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/rs/zerolog/log"
+)
+
+func (c *Chat) ExportThreadHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to export thread: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to export thread")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			// Handle the error
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Handle the error
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var format conversation.Format
+	if format, err = conversation.ParseFormat(ctx.Query("format")); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get the thread
+	var thread core.Thread
+	if thread, err = c.store.Threads.Get(ctx.Request.Context(), ctx.Param("thread_id"), user.ID); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			// Handle the error
+			ctx.JSON(404, gin.H{"error": "thread not found"})
+			return
+		}
+
+		// Handle the error
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var messages []core.Message
+	if messages, err = c.store.Messages.ListForThread(ctx.Request.Context(), thread.ID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	doc := conversation.FromThread(thread, messages)
+
+	ctx.Header("Content-Type", format.ContentType())
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", conversation.FileName(doc, format)))
+	ctx.Status(http.StatusOK)
+	if err = conversation.Write(ctx.Writer, format, doc); err != nil {
+		// Headers are already out, all we can do is log
+		return
+	}
+}
+
+// ExportAllThreadsHandler streams a zip archive with one file per thread of the user
+func (c *Chat) ExportAllThreadsHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to export threads: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to export threads")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			// Handle the error
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Handle the error
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var format conversation.Format
+	if format, err = conversation.ParseFormat(ctx.DefaultQuery("format", string(conversation.FormatJSON))); err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var threads []core.Thread
+	if threads, err = c.store.Threads.ListForUser(ctx.Request.Context(), user.ID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileName := fmt.Sprintf("threads-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	ctx.Status(http.StatusOK)
+
+	// From here on the response is streamed, errors can only be logged
+	archive := zip.NewWriter(ctx.Writer)
+	for _, thread := range threads {
+		var messages []core.Message
+		if messages, err = c.store.Messages.ListForThread(ctx.Request.Context(), thread.ID); err != nil {
+			_ = archive.Close()
+			return
+		}
+
+		doc := conversation.FromThread(thread, messages)
+		header := &zip.FileHeader{
+			Name:     conversation.FileName(doc, format),
+			Method:   zip.Deflate,
+			Modified: thread.UpdatedAt,
+		}
+
+		entry, createErr := archive.CreateHeader(header)
+		if createErr != nil {
+			err = createErr
+			_ = archive.Close()
+			return
+		}
+
+		if err = conversation.Write(entry, format, doc); err != nil {
+			_ = archive.Close()
+			return
+		}
+
+		ctx.Writer.Flush()
+	}
+
+	err = archive.Close()
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/conversation"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/rs/zerolog/log"
+)
+
+type importResult struct {
+	Index    int    `json:"index"`
+	Title    string `json:"title"`
+	ThreadID string `json:"thread_id,omitempty"`
+	Messages int    `json:"messages"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportThreadsHandler imports a ChatGPT conversations.json or one of our own JSON exports. The file
+// is either the raw request body or the "file" field of a multipart form.
+func (c *Chat) ImportThreadsHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to import threads: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to import threads")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			// Handle the error
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Handle the error
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Read the upload, bounded by the configured size limit
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, config.Current.Import.MaxBytes)
+
+	var data []byte
+	if strings.HasPrefix(ctx.ContentType(), "multipart/") {
+		var file io.ReadCloser
+		if file, err = openImportFile(ctx); err == nil {
+			data, err = io.ReadAll(file)
+			_ = file.Close()
+		}
+	} else {
+		data, err = io.ReadAll(ctx.Request.Body)
+	}
+
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "import file is too large"})
+			return
+		}
+
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var source conversation.Source
+	var imported []conversation.Imported
+	if source, imported, err = conversation.ParseImport(data, conversation.Limits{
+		MaxConversations: config.Current.Import.MaxConversations,
+		MaxMessages:      config.Current.Import.MaxMessages,
+		MaxMessageBytes:  config.Current.Import.MaxMessageBytes,
+	}); err != nil {
+		if errors.Is(err, conversation.ErrTooManyThreads) {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The threads reference the user, whose local copy may not exist yet
+	if err = c.store.SyncUser(ctx.Request.Context(), user); err != nil {
+		ctx.JSON(500, gin.H{"error": "failed to import threads"})
+		return
+	}
+
+	results := make([]importResult, 0, len(imported))
+	succeeded := 0
+	for _, item := range imported {
+		result := importResult{
+			Index:    item.Index,
+			Title:    item.Document.Name,
+			Messages: len(item.Document.Messages),
+		}
+
+		if item.Err != nil {
+			result.Error = item.Err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		if result.ThreadID, err = c.importDocument(ctx.Request.Context(), item.Document, user); err != nil {
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Int("index", item.Index).Msg("failed to store imported conversation")
+			result.Error = "failed to store conversation"
+			err = nil
+		} else {
+			succeeded++
+		}
+
+		results = append(results, result)
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{
+		"source":   source,
+		"imported": succeeded,
+		"failed":   len(results) - succeeded,
+		"results":  results,
+	})
+}
+
+func openImportFile(ctx *gin.Context) (io.ReadCloser, error) {
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+
+	return header.Open()
+}
+
+// importDocument stores a parsed conversation as a new thread owned by the user. Message IDs from
+// the source are not reused, they are only unique within the source system.
+func (c *Chat) importDocument(ctx context.Context, doc conversation.Document, user tenant.User) (threadID string, err error) {
+	thread := core.Thread{
+		ID:        uuid.New().String(),
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+		Name:      doc.Name,
+		UserID:    user.ID,
+		User:      user,
+	}
+
+	messages := make([]core.Message, 0, len(doc.Messages))
+	for _, message := range doc.Messages {
+		messages = append(messages, core.Message{
+			MessageID:   uuid.New().String(),
+			CreatedAt:   message.CreatedAt,
+			ThreadID:    thread.ID,
+			Content:     message.Content,
+			MessageType: message.MessageType,
+		})
+	}
+
+	if err = c.store.Threads.CreateWithMessages(ctx, &thread, messages); err != nil {
+		return
+	}
+
+	c.metrics.IncrementTotalChatThreads(user.ID, user.OrgID, user.Email)
+	recordUsage(ctx, c.store, user, tenant.UsageRecord{ThreadsCreated: 1})
+	threadID = thread.ID
+	return
+}
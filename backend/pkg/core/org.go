@@ -0,0 +1,449 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/audit"
+	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/moderation"
+	"github.com/omnistrate-community/ai-chatbot/pkg/redaction"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+type OrgAPI struct {
+	authHandler *auth.Auth
+	metrics     *metrics.Metrics
+	store       *store.Store
+}
+
+func NewOrgAPI(m *metrics.Metrics, dataStore *store.Store) *OrgAPI {
+	return &OrgAPI{
+		authHandler: auth.NewAuth(m, dataStore),
+		metrics:     m,
+		store:       dataStore,
+	}
+}
+
+type updateOrgSettingsRequest struct {
+	PublicSharingDisabled *bool `json:"public_sharing_disabled"`
+	// PIIPolicy replaces the stored policy when present, an empty object falls back to the defaults
+	PIIPolicy map[string]string `json:"pii_policy"`
+	// ModerationPolicy replaces the stored policy when present, an empty object falls back to the defaults
+	ModerationPolicy map[string]string `json:"moderation_policy"`
+	// Retention periods in days, 0 keeps data forever
+	MessageRetentionDays *int `json:"message_retention_days"`
+	ThreadRetentionDays  *int `json:"thread_retention_days"`
+}
+
+// changes lists the settings present in the request with their new values
+func (r updateOrgSettingsRequest) changes() map[string]any {
+	changes := map[string]any{}
+	if r.PublicSharingDisabled != nil {
+		changes["public_sharing_disabled"] = *r.PublicSharingDisabled
+	}
+	if r.PIIPolicy != nil {
+		changes["pii_policy"] = r.PIIPolicy
+	}
+	if r.ModerationPolicy != nil {
+		changes["moderation_policy"] = r.ModerationPolicy
+	}
+	if r.MessageRetentionDays != nil {
+		changes["message_retention_days"] = *r.MessageRetentionDays
+	}
+	if r.ThreadRetentionDays != nil {
+		changes["thread_retention_days"] = *r.ThreadRetentionDays
+	}
+	return changes
+}
+
+type updateOrgProfileRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	LogoURL     *string `json:"logo_url"`
+	WebsiteURL  *string `json:"website_url"`
+}
+
+// changes lists the profile fields present in the request with their new values
+func (r updateOrgProfileRequest) changes() map[string]any {
+	changes := map[string]any{}
+	if r.Name != nil {
+		changes["name"] = *r.Name
+	}
+	if r.Description != nil {
+		changes["description"] = *r.Description
+	}
+	if r.LogoURL != nil {
+		changes["logo_url"] = *r.LogoURL
+	}
+	if r.WebsiteURL != nil {
+		changes["website_url"] = *r.WebsiteURL
+	}
+	return changes
+}
+
+type setLegalHoldRequest struct {
+	LegalHold *bool `json:"legal_hold" binding:"required"`
+}
+
+func (o OrgAPI) GetSettingsHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to get org settings: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to get org settings")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, o.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var settings tenant.OrgSettings
+	if settings, err = o.store.OrgSettings.Get(ctx.Request.Context(), user.OrgID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"settings": settings})
+}
+
+func (o OrgAPI) UpdateSettingsHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to update org settings: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to update org settings")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, o.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.IsOrgAdmin() {
+		ctx.JSON(403, gin.H{"error": "only organization admins can change org settings"})
+		return
+	}
+
+	var request updateOrgSettingsRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
+		// Send error back through Gin
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.PIIPolicy != nil {
+		if validationErr := redaction.ValidatePolicy(request.PIIPolicy); validationErr != nil {
+			ctx.JSON(400, gin.H{"error": validationErr.Error()})
+			return
+		}
+	}
+
+	if (request.MessageRetentionDays != nil && *request.MessageRetentionDays < 0) ||
+		(request.ThreadRetentionDays != nil && *request.ThreadRetentionDays < 0) {
+		ctx.JSON(400, gin.H{"error": "retention periods must not be negative"})
+		return
+	}
+
+	if request.ModerationPolicy != nil {
+		if validationErr := moderation.ValidatePolicy(request.ModerationPolicy); validationErr != nil {
+			ctx.JSON(400, gin.H{"error": validationErr.Error()})
+			return
+		}
+	}
+
+	var settings tenant.OrgSettings
+	if settings, err = o.store.OrgSettings.Get(ctx.Request.Context(), user.OrgID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.PublicSharingDisabled != nil {
+		settings.PublicSharingDisabled = *request.PublicSharingDisabled
+	}
+
+	if request.PIIPolicy != nil {
+		settings.PIIPolicy = request.PIIPolicy
+	}
+
+	if request.ModerationPolicy != nil {
+		settings.ModerationPolicy = request.ModerationPolicy
+	}
+
+	if request.MessageRetentionDays != nil {
+		settings.MessageRetentionDays = *request.MessageRetentionDays
+	}
+
+	if request.ThreadRetentionDays != nil {
+		settings.ThreadRetentionDays = *request.ThreadRetentionDays
+	}
+
+	if err = o.store.OrgSettings.Save(ctx.Request.Context(), &settings); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := audit.Event(audit.ActionOrgSettingsUpdate, user)
+	event.TargetType = "org"
+	event.TargetID = user.OrgID
+	event.Details = request.changes()
+	audit.Record(ctx, o.store.Audit, event)
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"settings": settings})
+}
+
+// GetProfileHandler returns the org's profile as stored locally
+func (o OrgAPI) GetProfileHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to get org profile: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to get org profile")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, o.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = o.store.SyncUser(ctx.Request.Context(), user); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var org tenant.Org
+	if org, err = o.store.Orgs.Get(ctx.Request.Context(), user.OrgID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"org": org})
+}
+
+// UpdateProfileHandler changes the org's profile in Omnistrate and the local copy
+func (o OrgAPI) UpdateProfileHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to update org profile: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to update org profile")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, o.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.IsOrgAdmin() {
+		ctx.JSON(403, gin.H{"error": "only organization admins can change the org profile"})
+		return
+	}
+
+	var request updateOrgProfileRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
+		// Send error back through Gin
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Name != nil && strings.TrimSpace(*request.Name) == "" {
+		ctx.JSON(400, gin.H{"error": "name must not be empty"})
+		return
+	}
+
+	for _, value := range []*string{request.LogoURL, request.WebsiteURL} {
+		if value != nil && *value != "" && !utils.IsHTTPURL(*value) {
+			ctx.JSON(400, gin.H{"error": "logo_url and website_url must be http or https URLs"})
+			return
+		}
+	}
+
+	var updated tenant.User
+	if updated, err = o.authHandler.UpdateTenant(ctx.Request.Context(), jwtToken, user.ID, auth.TenantUpdate{
+		OrgName:        request.Name,
+		OrgDescription: request.Description,
+		OrgLogoURL:     request.LogoURL,
+		OrgWebsiteURL:  request.WebsiteURL,
+	}); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "only the owner of the organization can change its profile"})
+			return
+		}
+
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = o.store.SyncUser(ctx.Request.Context(), updated); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var org tenant.Org
+	if org, err = o.store.Orgs.Get(ctx.Request.Context(), user.OrgID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := audit.Event(audit.ActionOrgProfileUpdate, user)
+	event.TargetType = "org"
+	event.TargetID = user.OrgID
+	event.Details = request.changes()
+	audit.Record(ctx, o.store.Audit, event)
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"org": org})
+}
+
+// SetLegalHoldHandler places or lifts a legal hold on any thread of the org. Threads on hold are
+// exempt from the retention policies.
+func (o OrgAPI) SetLegalHoldHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to set legal hold: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to set legal hold")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, o.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Send error back through Gin
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.IsOrgAdmin() {
+		ctx.JSON(403, gin.H{"error": "only organization admins can place legal holds"})
+		return
+	}
+
+	var request setLegalHoldRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
+		// Send error back through Gin
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	threadID := ctx.Param("thread_id")
+	if err = o.store.Threads.SetLegalHold(ctx.Request.Context(), threadID, user.OrgID, *request.LegalHold); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			err = nil
+			ctx.JSON(404, gin.H{"error": "thread not found"})
+			return
+		}
+
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Ctx(ctx.Request.Context()).Info().Str("thread_id", threadID).Bool("legal_hold", *request.LegalHold).Msg("changed legal hold")
+
+	event := audit.Event(audit.ActionThreadLegalHold, user)
+	event.TargetType = "thread"
+	event.TargetID = threadID
+	event.Details = map[string]any{"legal_hold": *request.LegalHold}
+	audit.Record(ctx, o.store.Audit, event)
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"thread_id": threadID, "legal_hold": *request.LegalHold})
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store/storetest"
+)
+
+func TestUpdateProfileHandlerValidation(t *testing.T) {
+	admin := tenant.User{ID: "admin", Email: "admin@acme.example", OrgID: "org-1", Role: tenant.RoleAdmin}
+	editor := tenant.User{ID: "editor", Email: "editor@acme.example", OrgID: "org-1", Role: tenant.RoleEditor}
+	useFakeOmnistrate(t, admin, editor)
+	api := NewOrgAPI(metrics.NewMetrics(), storetest.New(dbtest.Open(t)))
+
+	tests := []struct {
+		name       string
+		user       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "editor", user: editor.ID, body: `{"name": "Acme"}`, wantStatus: http.StatusForbidden, wantError: "only organization admins"},
+		{name: "invalid JSON", user: admin.ID, body: `{"name": `, wantStatus: http.StatusBadRequest},
+		{name: "empty name", user: admin.ID, body: `{"name": "  "}`, wantStatus: http.StatusBadRequest, wantError: "name must not be empty"},
+		{name: "relative logo URL", user: admin.ID, body: `{"logo_url": "/logo.png"}`, wantStatus: http.StatusBadRequest, wantError: "must be http or https URLs"},
+		{name: "script website URL", user: admin.ID, body: `{"website_url": "javascript:alert(1)"}`, wantStatus: http.StatusBadRequest, wantError: "must be http or https URLs"},
+		{name: "website URL without host", user: admin.ID, body: `{"website_url": "https://"}`, wantStatus: http.StatusBadRequest, wantError: "must be http or https URLs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.PUT("/org/profile", api.UpdateProfileHandler)
+
+			request := httptest.NewRequest(http.MethodPut, "/org/profile", strings.NewReader(tt.body))
+			request.Header.Set("Authorization", "Bearer "+tt.user)
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantError) {
+				t.Errorf("response = %s, want an error containing %q", recorder.Body, tt.wantError)
+			}
+		})
+	}
+}
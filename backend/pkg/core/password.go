@@ -0,0 +1,201 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/audit"
+	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	errTooManyEmails = errors.New("too many emails are being sent, try again later")
+	errShuttingDown  = errors.New("server is shutting down")
+)
+
+type emailRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type verifyEmailRequest struct {
+	Email string `json:"email" binding:"required"`
+	Token string `json:"token" binding:"required"`
+}
+
+type resetPasswordRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// bindEmail reads an email address from the request body
+func bindEmail(ctx *gin.Context) (string, error) {
+	var request emailRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		return "", err
+	}
+
+	email := strings.TrimSpace(request.Email)
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return "", errors.New("email must be a valid email address")
+	}
+	return email, nil
+}
+
+// VerifyEmailHandler verifies the email of a new account with the token from the verification link
+func (u UserAPI) VerifyEmailHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to verify email: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to verify email")
+		}
+	}()
+
+	var request verifyEmailRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
+		// Send error back through Gin
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := audit.Event(audit.ActionEmailVerify, tenant.User{Email: request.Email})
+	if err = u.authHandler.VerifyEmail(ctx.Request.Context(), request.Email, request.Token); err != nil {
+		event.Outcome = tenant.AuditOutcomeFailure
+		event.Details = map[string]any{"reason": authFailureReason(err)}
+		audit.Record(ctx, u.store.Audit, event)
+
+		status, message := authErrorResponse(err)
+		ctx.JSON(status, gin.H{"error": message})
+		return
+	}
+	audit.Record(ctx, u.store.Audit, event)
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"message": "Email verified, you can sign in now"})
+}
+
+// ResendVerificationHandler emails the verification link again. It answers the same whether or not
+// an account exists, so it cannot be used to find out who signed up.
+func (u UserAPI) ResendVerificationHandler(ctx *gin.Context) {
+	email, err := bindEmail(ctx)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !u.emails.allow(email, ctx.ClientIP(), time.Now()) {
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": auth.ErrRateLimited.Error()})
+		return
+	}
+
+	// Sent in the background, the response time would otherwise tell whether the account exists
+	requestCtx := context.WithoutCancel(ctx.Request.Context())
+	if queueErr := u.emails.send(func() {
+		if sendErr := u.authHandler.SendVerification(requestCtx, email); sendErr != nil {
+			log.Ctx(requestCtx).Warn().Err(sendErr).Msg("failed to send verification email")
+		}
+	}); queueErr != nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": queueErr.Error()})
+		return
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "If an account with this email exists, a verification link is on its way"})
+}
+
+// ForgotPasswordHandler emails a password reset link. It answers the same whether or not an account
+// exists, so it cannot be used to find out who signed up.
+func (u UserAPI) ForgotPasswordHandler(ctx *gin.Context) {
+	email, err := bindEmail(ctx)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !u.emails.allow(email, ctx.ClientIP(), time.Now()) {
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": auth.ErrRateLimited.Error()})
+		return
+	}
+
+	event := audit.Event(audit.ActionPasswordResetRequest, tenant.User{Email: email})
+	if user, lookupErr := u.store.Users.GetByEmail(ctx.Request.Context(), email); lookupErr == nil {
+		event.OrgID = user.OrgID
+		event.TargetType = "user"
+		event.TargetID = user.ID
+	}
+	audit.Record(ctx, u.store.Audit, event)
+
+	// Sent in the background, the response time would otherwise tell whether the account exists
+	requestCtx := context.WithoutCancel(ctx.Request.Context())
+	if queueErr := u.emails.send(func() {
+		if sendErr := u.authHandler.RequestPasswordReset(requestCtx, email); sendErr != nil {
+			log.Ctx(requestCtx).Warn().Err(sendErr).Msg("failed to send password reset email")
+		}
+	}); queueErr != nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": queueErr.Error()})
+		return
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "If an account with this email exists, a password reset link is on its way"})
+}
+
+// ResetPasswordHandler sets a new password with the token from the reset link
+func (u UserAPI) ResetPasswordHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to reset password: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to reset password")
+		}
+	}()
+
+	var request resetPasswordRequest
+	if err = ctx.ShouldBindJSON(&request); err != nil {
+		// Send error back through Gin
+		ctx.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := audit.Event(audit.ActionPasswordReset, tenant.User{Email: request.Email})
+	if user, lookupErr := u.store.Users.GetByEmail(ctx.Request.Context(), strings.TrimSpace(request.Email)); lookupErr == nil {
+		event.OrgID = user.OrgID
+		event.TargetType = "user"
+		event.TargetID = user.ID
+	}
+
+	if err = u.authHandler.ResetPassword(ctx.Request.Context(), request.Email, request.Token, request.Password); err != nil {
+		event.Outcome = tenant.AuditOutcomeFailure
+		event.Details = map[string]any{"reason": authFailureReason(err)}
+		audit.Record(ctx, u.store.Audit, event)
+
+		status, message := authErrorResponse(err)
+		ctx.JSON(status, gin.H{"error": message})
+		return
+	}
+	audit.Record(ctx, u.store.Audit, event)
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"message": "Password changed, you can sign in now"})
+}
@@ -0,0 +1,352 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/omnistrate-community/ai-chatbot/pkg/audit"
+	"github.com/omnistrate-community/ai-chatbot/pkg/auth"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/conversation"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/rs/zerolog/log"
+)
+
+const shareTokenBytes = 32
+
+type createShareRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// newShareToken returns a random URL-safe token and the hash under which it is stored
+func newShareToken() (token string, tokenHash string, err error) {
+	buf := make([]byte, shareTokenBytes)
+	if _, err = rand.Read(buf); err != nil {
+		return
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	tokenHash = hashShareToken(token)
+	return
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Chat) CreateShareHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to share thread: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to share thread")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			// Handle the error
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Handle the error
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check the org policy before anything else
+	var settings tenant.OrgSettings
+	if settings, err = c.store.OrgSettings.Get(ctx.Request.Context(), user.OrgID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if settings.PublicSharingDisabled {
+		ctx.JSON(403, gin.H{"error": "public sharing is disabled for this organization"})
+		return
+	}
+
+	// The request body is optional
+	var request createShareRequest
+	if ctx.Request.ContentLength != 0 {
+		if err = ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	now := time.Now()
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		ctx.JSON(400, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	// Get the thread
+	threadID := ctx.Param("thread_id")
+
+	var thread core.Thread
+	if thread, err = c.store.Threads.Get(ctx.Request.Context(), threadID, user.ID); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			// Handle the error
+			ctx.JSON(404, gin.H{"error": "thread not found"})
+			return
+		}
+
+		// Handle the error
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Freeze the messages as they are right now
+	var messages []core.Message
+	if messages, err = c.store.Messages.ListForThread(ctx.Request.Context(), thread.ID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	snapshot := make([]core.SharedMessage, 0, len(messages))
+	for _, message := range messages {
+		snapshot = append(snapshot, core.SharedMessage{
+			MessageID:   message.MessageID,
+			CreatedAt:   message.CreatedAt,
+			Content:     message.Content,
+			MessageType: message.MessageType,
+		})
+	}
+
+	var token, tokenHash string
+	if token, tokenHash, err = newShareToken(); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	share := core.ThreadShare{
+		ID:         uuid.New().String(),
+		TokenHash:  tokenHash,
+		ThreadID:   thread.ID,
+		UserID:     user.ID,
+		OrgID:      user.OrgID,
+		ThreadName: thread.Name,
+		Messages:   snapshot,
+		ExpiresAt:  request.ExpiresAt,
+	}
+
+	if err = c.store.Shares.Save(ctx.Request.Context(), &share); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	event := audit.Event(audit.ActionShareCreate, user)
+	event.TargetType = "share"
+	event.TargetID = share.ID
+	event.Details = map[string]any{"thread_id": thread.ID, "expires_at": share.ExpiresAt}
+	audit.Record(ctx, c.store.Audit, event)
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{
+		"share_id":   share.ID,
+		"token":      token,
+		"path":       config.Current.APIPrefix + "/share/" + token,
+		"expires_at": share.ExpiresAt,
+	})
+}
+
+func (c *Chat) ListSharesHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to list thread shares: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to list thread shares")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			// Handle the error
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Handle the error
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only the owner of the thread may see its shares
+	var thread core.Thread
+	if thread, err = c.store.Threads.Get(ctx.Request.Context(), ctx.Param("thread_id"), user.ID); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			// Handle the error
+			ctx.JSON(404, gin.H{"error": "thread not found"})
+			return
+		}
+
+		// Handle the error
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var shares []core.ThreadShare
+	if shares, err = c.store.Shares.ListForThread(ctx.Request.Context(), thread.ID, user.ID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"shares": shares})
+}
+
+func (c *Chat) RevokeShareHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			var serviceErr *openapiclientv1.GenericOpenAPIError
+			if errors.As(err, &serviceErr) {
+				log.Ctx(ctx.Request.Context()).Error().Err(err).Msgf("failed to revoke thread share: %s", string(serviceErr.Body()))
+				return
+			}
+
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Str("share_id", ctx.Param("share_id")).Msg("failed to revoke thread share")
+		}
+	}()
+
+	// Use the admin context to get the user profile
+	authHeader := ctx.GetHeader("Authorization")
+	jwtToken := strings.TrimPrefix(authHeader, "Bearer ")
+
+	var user tenant.User
+	if user, err = describeTenant(ctx, c.authHandler, jwtToken); err != nil {
+		if errors.Is(err, auth.ForbiddenError) {
+			// Handle the error
+			ctx.JSON(403, gin.H{"error": "forbidden"})
+			return
+		}
+
+		// Handle the error
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var share core.ThreadShare
+	if share, err = c.store.Shares.Get(ctx.Request.Context(), ctx.Param("share_id"), ctx.Param("thread_id"), user.ID); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			ctx.JSON(404, gin.H{"error": "share not found"})
+			return
+		}
+
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if share.RevokedAt == nil {
+		now := time.Now()
+		share.RevokedAt = &now
+		if err = c.store.Shares.Save(ctx.Request.Context(), &share); err != nil {
+			ctx.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		event := audit.Event(audit.ActionShareRevoke, user)
+		event.TargetType = "share"
+		event.TargetID = share.ID
+		event.Details = map[string]any{"thread_id": share.ThreadID}
+		audit.Record(ctx, c.store.Audit, event)
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{"share_id": share.ID, "revoked_at": share.RevokedAt})
+}
+
+// GetSharedThreadHandler serves a shared thread snapshot. It is mounted without authentication,
+// the token itself is the credential.
+func (c *Chat) GetSharedThreadHandler(ctx *gin.Context) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Ctx(ctx.Request.Context()).Error().Err(err).Msg("failed to get shared thread")
+		}
+	}()
+
+	var share core.ThreadShare
+	if share, err = c.store.Shares.GetByTokenHash(ctx.Request.Context(), hashShareToken(ctx.Param("token"))); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			err = nil
+			ctx.JSON(404, gin.H{"error": "share not found"})
+			return
+		}
+
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Revoked, expired and disallowed shares are indistinguishable from unknown ones
+	if !share.IsActive(time.Now()) {
+		ctx.JSON(404, gin.H{"error": "share not found"})
+		return
+	}
+
+	var settings tenant.OrgSettings
+	if settings, err = c.store.OrgSettings.Get(ctx.Request.Context(), share.OrgID); err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if settings.PublicSharingDisabled {
+		ctx.JSON(404, gin.H{"error": "share not found"})
+		return
+	}
+
+	// Shared threads can also be rendered as a standalone page
+	if ctx.Query("format") == string(conversation.FormatHTML) {
+		ctx.Header("Content-Type", conversation.FormatHTML.ContentType())
+		ctx.Header("Content-Security-Policy", config.Current.Security.ShareContentSecurityPolicy)
+		ctx.Status(http.StatusOK)
+		err = conversation.Write(ctx.Writer, conversation.FormatHTML, conversation.FromShare(share))
+		return
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(http.StatusOK, gin.H{
+		"thread_name": share.ThreadName,
+		"shared_at":   share.CreatedAt,
+		"expires_at":  share.ExpiresAt,
+		"messages":    share.Messages,
+	})
+}
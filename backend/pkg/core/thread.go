@@ -4,21 +4,31 @@ import (
 	"context"
 	"github.com/google/uuid"
 	"github.com/omnistrate-community/ai-chatbot/pkg/ai"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
 	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
 	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
 	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/moderation"
+	"github.com/omnistrate-community/ai-chatbot/pkg/redaction"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/sashabaranov/go-openai"
 )
 
 type ThreadContext struct {
 	core.Thread
 
-	llmEngine *ai.LLMEngine
-	metrics   *metrics.Metrics
+	llmEngine  *ai.LLMEngine
+	redactor   *redaction.Pipeline
+	classifier moderation.Classifier
+	metrics    *metrics.Metrics
+	store      *store.Store
 }
 
 func NewThreadContext(
 	metricsService *metrics.Metrics,
+	dataStore *store.Store,
 	threadName string,
 	user tenant.User,
 ) *ThreadContext {
@@ -33,41 +43,101 @@ func NewThreadContext(
 		},
 		llmEngine: ai.NewLLMEngine(metricsService),
 		metrics:   metricsService,
+		store:     dataStore,
 	}
 }
 
 func FromThread(
 	metricsService *metrics.Metrics,
+	dataStore *store.Store,
+	redactor *redaction.Pipeline,
+	classifier moderation.Classifier,
 	thread core.Thread,
 ) *ThreadContext {
 	return &ThreadContext{
-		Thread:    thread,
-		llmEngine: ai.NewLLMEngine(metricsService),
-		metrics:   metricsService,
+		Thread:     thread,
+		llmEngine:  ai.NewLLMEngine(metricsService),
+		redactor:   redactor,
+		classifier: classifier,
+		metrics:    metricsService,
+		store:      dataStore,
 	}
 }
 
-func (t *ThreadContext) Query(ctx context.Context, query string) (response string, err error) {
-	// Store query in messages
+func (t *ThreadContext) Save(ctx context.Context) error {
+	return t.store.Threads.Save(ctx, &t.Thread)
+}
+
+// Query sends a query to the model and stores both the query and the response. The returned verdict
+// is the moderation verdict of the response, nil if moderation is disabled.
+func (t *ThreadContext) Query(ctx context.Context, query string) (response string, verdict *core.ModerationVerdict, err error) {
+	var settings tenant.OrgSettings
+	if settings, err = t.store.OrgSettings.Get(ctx, t.User.OrgID); err != nil {
+		err = errors.Wrap(err, "thread.Query: failed to get org settings")
+		return
+	}
+
+	// Keep personal data from leaving the backend as the org's policy demands
+	var redacted redaction.Result
+	if redacted, err = t.redact(ctx, query, settings); err != nil {
+		return
+	}
+
+	// Moderate the redacted query, external classifiers must not see the personal data either
+	var queryVerdict *core.ModerationVerdict
+	if queryVerdict, err = t.moderate(ctx, moderation.StageInput, redacted.Text, settings); err != nil {
+		return
+	}
+
+	// Store query in messages, the user keeps seeing what they typed
 	message := core.Message{
-		MessageID:   uuid.New().String(),
-		ThreadID:    t.ID,
-		Thread:      t.Thread,
-		Content:     query,
-		MessageType: core.MessageTypeQuery,
+		MessageID:      uuid.New().String(),
+		ThreadID:       t.ID,
+		Thread:         t.Thread,
+		Content:        query,
+		MessageType:    core.MessageTypeQuery,
+		RedactionCount: redacted.Count(),
+		Moderation:     queryVerdict,
 	}
 
-	if err = message.Save(); err != nil {
+	if err = t.store.Messages.Save(ctx, &message); err != nil {
 		err = errors.Wrap(err, "thread.Query: failed to save query message")
 		return
 	}
 
-	// Query the LLM engine
-	if response, _, err = t.llmEngine.Query(ctx, message); err != nil {
+	if moderation.Refused(queryVerdict) {
+		err = &moderation.RefusedError{Categories: queryVerdict.Categories}
+		return
+	}
+
+	// Query the LLM engine with the redacted prompt
+	prompt := message
+	prompt.Content = redacted.Text
+
+	var usage *openai.Usage
+	if response, usage, err = t.llmEngine.Query(ctx, prompt); err != nil {
 		err = errors.Wrap(err, "thread.Query: failed to query LLM engine")
 		return
 	}
 
+	delta := tenant.UsageRecord{Requests: 1}
+	if usage != nil {
+		delta.RequestTokens = int64(usage.PromptTokens)
+		delta.ResponseTokens = int64(usage.CompletionTokens)
+	}
+	recordUsage(ctx, t.store, t.User, delta)
+
+	if verdict, err = t.moderate(ctx, moderation.StageOutput, response, settings); err != nil {
+		return
+	}
+
+	if moderation.Refused(verdict) {
+		response = moderation.WithheldResponse
+	} else {
+		// Put the original values back in place of the placeholders the model echoed
+		response = redacted.Restore(response)
+	}
+
 	// Store response in messages
 	message = core.Message{
 		MessageID:   uuid.New().String(),
@@ -75,12 +145,58 @@ func (t *ThreadContext) Query(ctx context.Context, query string) (response strin
 		Thread:      t.Thread,
 		Content:     response,
 		MessageType: core.MessageTypeResponse,
+		Moderation:  verdict,
 	}
 
-	if err = message.Save(); err != nil {
+	if err = t.store.Messages.Save(ctx, &message); err != nil {
 		err = errors.Wrap(err, "thread.Query: failed to save response message")
 		return
 	}
 
 	return
 }
+
+// moderate classifies a query or response and applies the org's moderation policy. Classifier
+// failures fail the query, unmoderated content is never passed on.
+func (t *ThreadContext) moderate(ctx context.Context, stage string, text string, settings tenant.OrgSettings) (verdict *core.ModerationVerdict, err error) {
+	policy := moderation.NewPolicy(config.Current.Moderation.DefaultAction, settings.ModerationPolicy)
+	if verdict, err = moderation.Check(ctx, t.classifier, text, policy); err != nil {
+		err = errors.Wrapf(err, "thread.Query: failed to moderate %s", stage)
+		return
+	}
+
+	if verdict == nil {
+		return
+	}
+
+	t.metrics.IncrementModerationVerdicts(stage, verdict.Action)
+	if verdict.Action != moderation.VerdictPass {
+		log.Ctx(ctx).Info().Str("stage", stage).Str("action", verdict.Action).Strs("categories", verdict.Categories).
+			Msg("thread.Query: moderation flagged content")
+	}
+	return
+}
+
+// redact applies the org's personal data policy to a query. It returns a *redaction.BlockedError if
+// the query must not be sent at all.
+func (t *ThreadContext) redact(ctx context.Context, query string, settings tenant.OrgSettings) (result redaction.Result, err error) {
+	policy := redaction.NewPolicy(config.Current.Redaction.DefaultAction, settings.PIIPolicy)
+	if result, err = t.redactor.Apply(query, policy); err != nil {
+		var blockedErr *redaction.BlockedError
+		if errors.As(err, &blockedErr) {
+			for _, category := range blockedErr.Categories {
+				t.metrics.AddPIIDetections(category, string(redaction.ActionBlock), 1)
+			}
+			log.Ctx(ctx).Info().Strs("categories", blockedErr.Categories).Msg("thread.Query: blocked query containing personal data")
+		}
+		return
+	}
+
+	for category, count := range result.Redactions {
+		t.metrics.AddPIIDetections(category, string(redaction.ActionRedact), count)
+	}
+	if count := result.Count(); count > 0 {
+		log.Ctx(ctx).Info().Int("redactions", count).Msg("thread.Query: redacted personal data from query")
+	}
+	return
+}
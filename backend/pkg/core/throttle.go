@@ -0,0 +1,112 @@
+package core
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
+)
+
+// emailThrottleWindow is the period the per IP limit applies to
+const emailThrottleWindow = time.Hour
+
+// emailThrottle limits the verification and reset links that can be requested, per address and per
+// client IP, and how many emails are sent at once. The limits apply per replica.
+type emailThrottle struct {
+	cooldown time.Duration
+	maxPerIP int
+
+	mu        sync.Mutex
+	addresses map[string]time.Time
+	ips       map[string]ipWindow
+	pruned    time.Time
+
+	sending chan struct{}
+}
+
+// ipWindow counts the requests of one client IP since start
+type ipWindow struct {
+	start time.Time
+	count int
+}
+
+func newEmailThrottle(cooldown time.Duration, maxPerIP int, maxConcurrent int) *emailThrottle {
+	return &emailThrottle{
+		cooldown:  cooldown,
+		maxPerIP:  maxPerIP,
+		addresses: make(map[string]time.Time),
+		ips:       make(map[string]ipWindow),
+		sending:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+// allow reports whether an email may be requested for the address from the client IP and counts
+// the request if so. The answer does not depend on whether an account exists for the address.
+func (t *emailThrottle) allow(address string, ip string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(now)
+
+	address = strings.ToLower(address)
+	if last, ok := t.addresses[address]; ok && now.Sub(last) < t.cooldown {
+		return false
+	}
+
+	window := t.ips[ip]
+	if now.Sub(window.start) >= emailThrottleWindow {
+		window = ipWindow{start: now}
+	}
+	if window.count >= t.maxPerIP {
+		return false
+	}
+
+	window.count++
+	t.ips[ip] = window
+	t.addresses[address] = now
+	return true
+}
+
+// prune forgets requests that no longer count towards a limit, the caller holds mu
+func (t *emailThrottle) prune(now time.Time) {
+	if now.Sub(t.pruned) < t.cooldown {
+		return
+	}
+	t.pruned = now
+
+	for address, last := range t.addresses {
+		if now.Sub(last) >= t.cooldown {
+			delete(t.addresses, address)
+		}
+	}
+	for ip, window := range t.ips {
+		if now.Sub(window.start) >= emailThrottleWindow {
+			delete(t.ips, ip)
+		}
+	}
+}
+
+// send runs fn in the background unless too many emails are being sent already or the server is
+// shutting down. Shutdown waits for the emails that are being sent.
+func (t *emailThrottle) send(fn func()) error {
+	select {
+	case t.sending <- struct{}{}:
+	default:
+		return errTooManyEmails
+	}
+
+	if !utils.InflightEmails.Begin() {
+		<-t.sending
+		return errShuttingDown
+	}
+
+	go func() {
+		defer func() {
+			<-t.sending
+			utils.InflightEmails.Done()
+		}()
+		fn()
+	}()
+	return nil
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEmailThrottleAllow(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	type request struct {
+		address string
+		ip      string
+		after   time.Duration
+		want    bool
+	}
+
+	tests := []struct {
+		name     string
+		requests []request
+	}{
+		{
+			name: "same address within the cooldown",
+			requests: []request{
+				{"user@example.com", "10.0.0.1", 0, true},
+				{"User@Example.com", "10.0.0.2", 30 * time.Second, false},
+				{"user@example.com", "10.0.0.1", time.Minute, true},
+			},
+		},
+		{
+			name: "other addresses are not held back",
+			requests: []request{
+				{"a@example.com", "10.0.0.1", 0, true},
+				{"b@example.com", "10.0.0.1", time.Second, true},
+			},
+		},
+		{
+			name: "too many addresses from one IP",
+			requests: []request{
+				{"a@example.com", "10.0.0.1", 0, true},
+				{"b@example.com", "10.0.0.1", time.Second, true},
+				{"c@example.com", "10.0.0.1", 2 * time.Second, false},
+				{"c@example.com", "10.0.0.2", 3 * time.Second, true},
+				{"d@example.com", "10.0.0.1", time.Hour, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := newEmailThrottle(time.Minute, 2, 1)
+			for i, r := range tt.requests {
+				if got := throttle.allow(r.address, r.ip, start.Add(r.after)); got != r.want {
+					t.Errorf("request %d: allow(%q, %q) = %v, want %v", i, r.address, r.ip, got, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEmailThrottleSend(t *testing.T) {
+	throttle := newEmailThrottle(time.Minute, 1, 1)
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	if err := throttle.send(func() { <-release; close(done) }); err != nil {
+		t.Fatalf("first send was refused: %v", err)
+	}
+	if err := throttle.send(func() {}); !errors.Is(err, errTooManyEmails) {
+		t.Errorf("send while the limit is reached = %v, want %v", err, errTooManyEmails)
+	}
+
+	close(release)
+	<-done
+	// The slot is freed right after fn returns
+	accepted := false
+	for i := 0; i < 100 && !accepted; i++ {
+		if accepted = throttle.send(func() {}) == nil; !accepted {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if !accepted {
+		t.Error("send was refused after the running email finished")
+	}
+}
@@ -0,0 +1,24 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"github.com/rs/zerolog/log"
+)
+
+// recordUsage adds to the usage ledger of the user. Failures are logged and otherwise ignored, the
+// user's request already succeeded at this point.
+func recordUsage(ctx context.Context, dataStore *store.Store, user tenant.User, delta tenant.UsageRecord) {
+	now := time.Now()
+	delta.Day = tenant.UsageDay(now)
+	delta.OrgID = user.OrgID
+	delta.UserID = user.ID
+	delta.UpdatedAt = now
+
+	if err := dataStore.Usage.Add(ctx, delta); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("user_id", user.ID).Msg("failed to record usage")
+	}
+}
@@ -1,39 +1,211 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"github.com/rs/zerolog/log"
-	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/glebarez/sqlite"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var dbHost = os.Getenv("DB_HOST")
-var dbPort = os.Getenv("DB_PORT")
-var dbName = os.Getenv("DB_NAME")
-var dbUser = os.Getenv("DB_USER")
-var dbPassword = os.Getenv("DB_PASSWORD")
+const (
+	DriverPostgres = config.DatabaseDriverPostgres
+	DriverSQLite   = config.DatabaseDriverSQLite
+)
 
 var initSync sync.Once
+var initErr error
 var dbHandle *gorm.DB
+var replicaHandles []*gorm.DB
+var replicaCounter atomic.Uint64
 
-func Connect() *gorm.DB {
+// Driver returns the configured database driver
+func Driver() string {
+	return config.Current.Database.Driver
+}
+
+// Connect opens the primary database and any read replicas. The first call retries with backoff
+// until the connect timeout elapses, later calls return the same handle.
+func Connect() (*gorm.DB, error) {
 	initSync.Do(func() {
-		var err error
+		ctx, cancel := context.WithTimeout(context.Background(), config.Current.Database.ConnectTimeout)
+		defer cancel()
 
-		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-			dbHost, dbUser, dbPassword, dbName, dbPort)
+		if dbHandle, initErr = openWithRetry(ctx, "primary", primaryDialector); initErr != nil {
+			return
+		}
 
-		if dbHandle, err = gorm.Open(postgres.Open(dsn), &gorm.Config{}); err != nil {
-			log.Fatal().Err(err).Msg("failed to connect to database")
+		for i, replicaDSN := range config.Current.Database.ReadReplicaURLs {
+			dsn := replicaDSN
+			var replica *gorm.DB
+			if replica, initErr = openWithRetry(ctx, fmt.Sprintf("replica_%d", i), func() (gorm.Dialector, error) {
+				return postgres.Open(dsn), nil
+			}); initErr != nil {
+				return
+			}
+			replicaHandles = append(replicaHandles, replica)
 		}
 	})
 
-	return dbHandle
+	return dbHandle, initErr
+}
+
+// Reader returns a handle for read-only list and search queries. Replicas are picked round robin,
+// without replicas this is the primary.
+func Reader() *gorm.DB {
+	if len(replicaHandles) == 0 {
+		return dbHandle
+	}
+
+	next := replicaCounter.Add(1)
+	return replicaHandles[next%uint64(len(replicaHandles))]
+}
+
+// Handles returns the primary followed by all read replicas
+func Handles() []*gorm.DB {
+	if dbHandle == nil {
+		return nil
+	}
+	return append([]*gorm.DB{dbHandle}, replicaHandles...)
+}
+
+// Pools returns the connection pools of the primary and all replicas keyed by role, e.g. for metrics
+func Pools() map[string]*sql.DB {
+	pools := make(map[string]*sql.DB)
+	if dbHandle == nil {
+		return pools
+	}
+
+	if sqlDB, err := dbHandle.DB(); err == nil {
+		pools["primary"] = sqlDB
+	}
+
+	for i, replica := range replicaHandles {
+		if sqlDB, err := replica.DB(); err == nil {
+			pools[fmt.Sprintf("replica_%d", i)] = sqlDB
+		}
+	}
+
+	return pools
+}
+
+// Close closes all connection pools
+func Close() (err error) {
+	for role, pool := range Pools() {
+		if closeErr := pool.Close(); closeErr != nil {
+			err = errors.Wrapf(closeErr, "failed to close %s database pool", role)
+		}
+	}
+	return
+}
+
+func primaryDialector() (gorm.Dialector, error) {
+	switch Driver() {
+	case DriverPostgres:
+		return postgres.Open(postgresDSN()), nil
+	case DriverSQLite:
+		return sqlite.Open(sqliteDSN(config.Current.Database.SQLitePath)), nil
+	}
+
+	return nil, errors.Errorf("unsupported database driver %q", Driver())
+}
+
+func openWithRetry(ctx context.Context, role string, dialector func() (gorm.Dialector, error)) (handle *gorm.DB, err error) {
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		if handle, err = open(ctx, dialector); err == nil {
+			return
+		}
+
+		log.Warn().Err(err).Str("role", role).Int("attempt", attempt).Dur("retry_in", backoff).Msg("failed to connect to database")
+
+		select {
+		case <-ctx.Done():
+			err = errors.Wrapf(err, "giving up connecting to %s database after %d attempts", role, attempt)
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, 10*time.Second)
+	}
+}
+
+func open(ctx context.Context, dialector func() (gorm.Dialector, error)) (handle *gorm.DB, err error) {
+	var d gorm.Dialector
+	if d, err = dialector(); err != nil {
+		return
+	}
+
+	if handle, err = gorm.Open(d, &gorm.Config{}); err != nil {
+		return
+	}
+
+	var sqlDB *sql.DB
+	if sqlDB, err = handle.DB(); err != nil {
+		return
+	}
+
+	if Driver() == DriverSQLite {
+		// SQLite only supports a single writer, serialize access instead of failing with SQLITE_BUSY
+		sqlDB.SetMaxOpenConns(1)
+	} else {
+		sqlDB.SetMaxOpenConns(config.Current.Database.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(config.Current.Database.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(config.Current.Database.ConnMaxLifetime)
+		sqlDB.SetConnMaxIdleTime(config.Current.Database.ConnMaxIdleTime)
+	}
+
+	if err = sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
+		handle = nil
+	}
+	return
+}
+
+func postgresDSN() string {
+	settings := config.Current.Database
+	if settings.URL != "" {
+		return settings.URL
+	}
+
+	values := []struct{ key, value string }{
+		{"host", settings.Host},
+		{"port", strconv.Itoa(settings.Port)},
+		{"user", settings.User},
+		{"password", settings.Password},
+		{"dbname", settings.Name},
+		{"sslmode", settings.SSLMode},
+		{"sslrootcert", settings.SSLRootCert},
+		{"sslcert", settings.SSLCert},
+		{"sslkey", settings.SSLKey},
+	}
+
+	var parts []string
+	for _, setting := range values {
+		if setting.value != "" {
+			parts = append(parts, setting.key+"="+quoteDSNValue(setting.value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue quotes a libpq key/value connection string value, so passwords may contain spaces
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
 }
 
-func RegisterModel[T any](m T) error {
-	return Connect().AutoMigrate(m)
+func sqliteDSN(path string) string {
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
 }
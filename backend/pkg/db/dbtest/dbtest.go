@@ -0,0 +1,39 @@
+// Package dbtest provides migrated databases for tests
+package dbtest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/migrate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open returns a SQLite database in a temporary directory with all migrations applied. Foreign keys
+// are enforced like in production.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	handle, err := gorm.Open(sqlite.Open("file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	sqlDB, err := handle.DB()
+	if err != nil {
+		t.Fatalf("failed to get connection pool: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	if _, err = migrate.Up(context.Background(), sqlDB, db.DriverSQLite); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return handle
+}
@@ -0,0 +1,352 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/db"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// advisoryLockID is an arbitrary, fixed key so that only one replica migrates at a time
+const advisoryLockID = 7_343_915_021
+
+var ErrSchemaOutOfDate = errors.New("database schema is not up to date, run the migrate subcommand")
+var ErrUnsupportedDriver = errors.New("unsupported database driver")
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// dialect holds the driver specific parts of the bookkeeping
+type dialect struct {
+	createTable string
+	tableExists string
+	lock        string
+	unlock      string
+}
+
+var dialects = map[string]dialect{
+	db.DriverPostgres: {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		)`,
+		tableExists: "SELECT to_regclass('schema_migrations') IS NOT NULL",
+		lock:        fmt.Sprintf("SELECT pg_advisory_lock(%d)", advisoryLockID),
+		unlock:      fmt.Sprintf("SELECT pg_advisory_unlock(%d)", advisoryLockID),
+	},
+	// SQLite is single node and serializes writers on its own, no lock needed
+	db.DriverSQLite: {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`,
+		tableExists: "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'",
+	},
+}
+
+func dialectFor(driver string) (dialect, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return dialect{}, errors.Wrapf(ErrUnsupportedDriver, "%q", driver)
+	}
+	return d, nil
+}
+
+// Load returns all embedded migrations for the driver ordered by version
+func Load(driver string) (migrations []Migration, err error) {
+	if _, err = dialectFor(driver); err != nil {
+		return
+	}
+
+	dir := path.Join("migrations", driver)
+
+	var entries []fs.DirEntry
+	if entries, err = migrationFiles.ReadDir(dir); err != nil {
+		return
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			err = errors.Errorf("invalid migration file name %q", entry.Name())
+			return
+		}
+
+		var version int64
+		if version, err = strconv.ParseInt(match[1], 10, 64); err != nil {
+			return
+		}
+
+		var content []byte
+		if content, err = migrationFiles.ReadFile(path.Join(dir, entry.Name())); err != nil {
+			return
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			err = errors.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+			return
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			err = errors.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+			return
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return
+}
+
+// Up applies all pending migrations
+func Up(ctx context.Context, sqlDB *sql.DB, driver string) (applied []Migration, err error) {
+	err = withLock(ctx, sqlDB, driver, func(conn *sql.Conn, d dialect) error {
+		migrations, err := Load(driver)
+		if err != nil {
+			return err
+		}
+
+		done, err := appliedVersions(ctx, conn, d)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			log.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("applying migration")
+			if err = apply(ctx, conn, migration.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+					migration.Version, migration.Name, time.Now().UTC())
+				return err
+			}); err != nil {
+				return errors.Wrapf(err, "failed to apply migration %d_%s", migration.Version, migration.Name)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+	return
+}
+
+// Down rolls back the given number of most recently applied migrations
+func Down(ctx context.Context, sqlDB *sql.DB, driver string, steps int) (reverted []Migration, err error) {
+	err = withLock(ctx, sqlDB, driver, func(conn *sql.Conn, d dialect) error {
+		migrations, err := Load(driver)
+		if err != nil {
+			return err
+		}
+
+		done, err := appliedVersions(ctx, conn, d)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return errors.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+			}
+
+			log.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("reverting migration")
+			if err = apply(ctx, conn, migration.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+				return err
+			}); err != nil {
+				return errors.Wrapf(err, "failed to revert migration %d_%s", migration.Version, migration.Name)
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+	return
+}
+
+// Statuses lists every known migration along with when it was applied, if at all
+func Statuses(ctx context.Context, sqlDB *sql.DB, driver string) (statuses []Status, err error) {
+	var d dialect
+	if d, err = dialectFor(driver); err != nil {
+		return
+	}
+
+	var migrations []Migration
+	if migrations, err = Load(driver); err != nil {
+		return
+	}
+
+	var conn *sql.Conn
+	if conn, err = sqlDB.Conn(ctx); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var done map[int64]time.Time
+	if done, err = appliedVersions(ctx, conn, d); err != nil {
+		return
+	}
+
+	for _, migration := range migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := done[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return
+}
+
+// EnsureCurrent returns ErrSchemaOutOfDate if any migration has not been applied yet
+func EnsureCurrent(ctx context.Context, sqlDB *sql.DB, driver string) error {
+	statuses, err := Statuses(ctx, sqlDB, driver)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			return errors.Wrapf(ErrSchemaOutOfDate, "migration %d_%s is pending", status.Version, status.Name)
+		}
+	}
+
+	return nil
+}
+
+func withLock(ctx context.Context, sqlDB *sql.DB, driver string, fn func(conn *sql.Conn, d dialect) error) (err error) {
+	var d dialect
+	if d, err = dialectFor(driver); err != nil {
+		return
+	}
+
+	// Advisory locks are held per session, so everything has to go through the same connection
+	var conn *sql.Conn
+	if conn, err = sqlDB.Conn(ctx); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if d.lock != "" {
+		if _, err = conn.ExecContext(ctx, d.lock); err != nil {
+			return errors.Wrap(err, "failed to acquire migration lock")
+		}
+
+		defer func() {
+			// Use a fresh context, the lock must be released even if ctx was cancelled
+			if _, unlockErr := conn.ExecContext(context.Background(), d.unlock); unlockErr != nil {
+				log.Warn().Err(unlockErr).Msg("failed to release migration lock")
+			}
+		}()
+	}
+
+	if _, err = conn.ExecContext(ctx, d.createTable); err != nil {
+		return
+	}
+
+	return fn(conn, d)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn, d dialect) (done map[int64]time.Time, err error) {
+	done = make(map[int64]time.Time)
+
+	var exists bool
+	if err = conn.QueryRowContext(ctx, d.tableExists).Scan(&exists); err != nil || !exists {
+		return
+	}
+
+	var rows *sql.Rows
+	if rows, err = conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return
+		}
+		done[version] = appliedAt
+	}
+
+	err = rows.Err()
+	return
+}
+
+// apply runs a migration script and the bookkeeping statement in a single transaction
+func apply(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) (err error) {
+	var tx *sql.Tx
+	if tx, err = conn.BeginTx(ctx, nil); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				err = fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+			}
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return
+	}
+
+	if err = record(tx); err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
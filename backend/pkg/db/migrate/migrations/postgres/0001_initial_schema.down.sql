@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS thread_shares;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS threads;
+DROP TABLE IF EXISTS org_settings;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS orgs;
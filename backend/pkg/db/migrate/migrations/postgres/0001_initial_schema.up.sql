@@ -0,0 +1,69 @@
+-- Baseline schema. Statements are idempotent so databases previously created by GORM
+-- AutoMigrate can be brought under versioned migrations without changes.
+
+CREATE TABLE IF NOT EXISTS orgs (
+    id                 TEXT PRIMARY KEY,
+    name               TEXT,
+    legal_company_name TEXT,
+    description        TEXT,
+    logo_url           TEXT,
+    website_url        TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_orgs_name ON orgs (name);
+
+CREATE TABLE IF NOT EXISTS users (
+    id     TEXT PRIMARY KEY,
+    email  TEXT,
+    name   TEXT,
+    org_id TEXT,
+    CONSTRAINT uni_users_email UNIQUE (email),
+    CONSTRAINT fk_users_org FOREIGN KEY (org_id) REFERENCES orgs (id)
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT;
+CREATE INDEX IF NOT EXISTS idx_users_name ON users (name);
+CREATE INDEX IF NOT EXISTS idx_users_org_id ON users (org_id);
+
+CREATE TABLE IF NOT EXISTS org_settings (
+    org_id                  TEXT PRIMARY KEY,
+    public_sharing_disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at              TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS threads (
+    id         TEXT PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    name       TEXT,
+    user_id    TEXT,
+    CONSTRAINT fk_threads_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_threads_name ON threads (name);
+CREATE INDEX IF NOT EXISTS idx_threads_user_id ON threads (user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+    created_at   TIMESTAMPTZ,
+    message_id   TEXT PRIMARY KEY,
+    thread_id    TEXT,
+    content      TEXT,
+    message_type TEXT,
+    CONSTRAINT fk_messages_thread FOREIGN KEY (thread_id) REFERENCES threads (id)
+);
+CREATE INDEX IF NOT EXISTS idx_messages_thread_id ON messages (thread_id);
+CREATE INDEX IF NOT EXISTS idx_messages_message_type ON messages (message_type);
+
+CREATE TABLE IF NOT EXISTS thread_shares (
+    id          TEXT PRIMARY KEY,
+    token_hash  TEXT,
+    thread_id   TEXT,
+    user_id     TEXT,
+    org_id      TEXT,
+    thread_name TEXT,
+    messages    TEXT,
+    created_at  TIMESTAMPTZ,
+    expires_at  TIMESTAMPTZ,
+    revoked_at  TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_thread_shares_token_hash ON thread_shares (token_hash);
+CREATE INDEX IF NOT EXISTS idx_thread_shares_thread_id ON thread_shares (thread_id);
+CREATE INDEX IF NOT EXISTS idx_thread_shares_user_id ON thread_shares (user_id);
+CREATE INDEX IF NOT EXISTS idx_thread_shares_org_id ON thread_shares (org_id);
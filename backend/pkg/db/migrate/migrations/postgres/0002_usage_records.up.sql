@@ -0,0 +1,12 @@
+CREATE TABLE usage_records (
+    day             TEXT   NOT NULL,
+    org_id          TEXT   NOT NULL,
+    user_id         TEXT   NOT NULL,
+    requests        BIGINT NOT NULL DEFAULT 0,
+    request_tokens  BIGINT NOT NULL DEFAULT 0,
+    response_tokens BIGINT NOT NULL DEFAULT 0,
+    threads_created BIGINT NOT NULL DEFAULT 0,
+    updated_at      TIMESTAMPTZ,
+    PRIMARY KEY (day, org_id, user_id)
+);
+CREATE INDEX idx_usage_records_org_id ON usage_records (org_id);
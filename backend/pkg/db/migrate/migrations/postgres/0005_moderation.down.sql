@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP COLUMN moderation;
+ALTER TABLE org_settings DROP COLUMN moderation_policy;
@@ -0,0 +1,2 @@
+ALTER TABLE org_settings ADD COLUMN moderation_policy TEXT;
+ALTER TABLE messages ADD COLUMN moderation TEXT;
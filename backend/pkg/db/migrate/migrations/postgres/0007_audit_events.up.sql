@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ NOT NULL,
+    org_id      TEXT,
+    actor_id    TEXT,
+    actor_email TEXT,
+    action      TEXT NOT NULL,
+    outcome     TEXT NOT NULL,
+    target_type TEXT,
+    target_id   TEXT,
+    ip          TEXT,
+    user_agent  TEXT,
+    request_id  TEXT,
+    details     TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_org_id ON audit_events (org_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
+
+-- The audit log is append-only, refuse changes even from the application's own database user
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
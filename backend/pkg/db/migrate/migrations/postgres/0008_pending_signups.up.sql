@@ -0,0 +1,6 @@
+-- What a signup entered that Omnistrate does not store, kept until the user first signs in
+CREATE TABLE IF NOT EXISTS pending_signups (
+    email              TEXT PRIMARY KEY,
+    legal_company_name TEXT,
+    created_at         TIMESTAMPTZ
+);
@@ -0,0 +1,63 @@
+CREATE TABLE IF NOT EXISTS orgs (
+    id                 TEXT PRIMARY KEY,
+    name               TEXT,
+    legal_company_name TEXT,
+    description        TEXT,
+    logo_url           TEXT,
+    website_url        TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_orgs_name ON orgs (name);
+
+CREATE TABLE IF NOT EXISTS users (
+    id     TEXT PRIMARY KEY,
+    email  TEXT,
+    name   TEXT,
+    org_id TEXT REFERENCES orgs (id),
+    role   TEXT,
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+CREATE INDEX IF NOT EXISTS idx_users_name ON users (name);
+CREATE INDEX IF NOT EXISTS idx_users_org_id ON users (org_id);
+
+CREATE TABLE IF NOT EXISTS org_settings (
+    org_id                  TEXT PRIMARY KEY,
+    public_sharing_disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at              DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS threads (
+    id         TEXT PRIMARY KEY,
+    created_at DATETIME,
+    updated_at DATETIME,
+    name       TEXT,
+    user_id    TEXT REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_threads_name ON threads (name);
+CREATE INDEX IF NOT EXISTS idx_threads_user_id ON threads (user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+    created_at   DATETIME,
+    message_id   TEXT PRIMARY KEY,
+    thread_id    TEXT REFERENCES threads (id),
+    content      TEXT,
+    message_type TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_messages_thread_id ON messages (thread_id);
+CREATE INDEX IF NOT EXISTS idx_messages_message_type ON messages (message_type);
+
+CREATE TABLE IF NOT EXISTS thread_shares (
+    id          TEXT PRIMARY KEY,
+    token_hash  TEXT,
+    thread_id   TEXT,
+    user_id     TEXT,
+    org_id      TEXT,
+    thread_name TEXT,
+    messages    TEXT,
+    created_at  DATETIME,
+    expires_at  DATETIME,
+    revoked_at  DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_thread_shares_token_hash ON thread_shares (token_hash);
+CREATE INDEX IF NOT EXISTS idx_thread_shares_thread_id ON thread_shares (thread_id);
+CREATE INDEX IF NOT EXISTS idx_thread_shares_user_id ON thread_shares (user_id);
+CREATE INDEX IF NOT EXISTS idx_thread_shares_org_id ON thread_shares (org_id);
@@ -0,0 +1,9 @@
+CREATE TABLE org_data_keys (
+    org_id        TEXT    NOT NULL,
+    version       INTEGER NOT NULL,
+    master_key_id TEXT    NOT NULL,
+    wrapped_key   TEXT    NOT NULL,
+    created_at    DATETIME,
+    shredded_at   DATETIME,
+    PRIMARY KEY (org_id, version)
+);
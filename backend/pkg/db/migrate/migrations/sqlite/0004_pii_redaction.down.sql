@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP COLUMN redaction_count;
+ALTER TABLE org_settings DROP COLUMN pii_policy;
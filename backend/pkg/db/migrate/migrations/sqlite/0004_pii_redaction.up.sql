@@ -0,0 +1,2 @@
+ALTER TABLE org_settings ADD COLUMN pii_policy TEXT;
+ALTER TABLE messages ADD COLUMN redaction_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS job_leases;
+DROP INDEX IF EXISTS idx_thread_shares_created_at;
+DROP INDEX IF EXISTS idx_messages_created_at;
+ALTER TABLE threads DROP COLUMN legal_hold;
+ALTER TABLE org_settings DROP COLUMN thread_retention_days;
+ALTER TABLE org_settings DROP COLUMN message_retention_days;
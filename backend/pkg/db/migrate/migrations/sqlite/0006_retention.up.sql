@@ -0,0 +1,11 @@
+ALTER TABLE org_settings ADD COLUMN message_retention_days INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE org_settings ADD COLUMN thread_retention_days INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE threads ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages (created_at);
+CREATE INDEX IF NOT EXISTS idx_thread_shares_created_at ON thread_shares (created_at);
+
+CREATE TABLE IF NOT EXISTS job_leases (
+    name       TEXT PRIMARY KEY,
+    holder     TEXT NOT NULL,
+    expires_at DATETIME NOT NULL
+);
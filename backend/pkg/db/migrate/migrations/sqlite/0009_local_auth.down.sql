@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_email_lower;
+DROP TABLE IF EXISTS auth_tokens;
+DROP TABLE IF EXISTS local_credentials;
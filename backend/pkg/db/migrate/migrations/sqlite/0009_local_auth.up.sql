@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS local_credentials (
+    user_id           TEXT PRIMARY KEY,
+    password_hash     TEXT NOT NULL,
+    email_verified_at DATETIME,
+    -- Access tokens carry the session version, a password reset raises it to end every session
+    session_version   INTEGER NOT NULL DEFAULT 0,
+    created_at        DATETIME,
+    updated_at        DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS auth_tokens (
+    hash       TEXT PRIMARY KEY,
+    kind       TEXT NOT NULL,
+    user_id    TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_user_id ON auth_tokens (user_id);
+
+-- Emails are matched without regard to case
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email));
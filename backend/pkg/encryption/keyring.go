@@ -0,0 +1,356 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/pkg/errors"
+)
+
+// prefix marks encrypted values. Values without it are plaintext written before encryption was enabled.
+const prefix = "enc:v1:"
+
+var ErrKeyShredded = errors.New("the data key of this organization has been destroyed")
+var ErrNotConfigured = errors.New("encrypted data found but no master key is configured")
+
+// orgKeys are the unwrapped data keys of one org
+type orgKeys struct {
+	keys     map[int][]byte
+	active   int
+	shredded bool
+	loadedAt time.Time
+}
+
+// Keyring encrypts content with per-org data keys (envelope encryption). Data keys are created on
+// first use, stored wrapped by the master key and cached unwrapped for a while.
+type Keyring struct {
+	masterKeys *MasterKeys
+	dataKeys   tenant.DataKeyRepository
+	cacheTTL   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*orgKeys
+}
+
+// NewKeyring returns a keyring. With nil master keys it passes plaintext through unchanged and
+// fails on encrypted values.
+func NewKeyring(masterKeys *MasterKeys, dataKeys tenant.DataKeyRepository, cacheTTL time.Duration) *Keyring {
+	return &Keyring{
+		masterKeys: masterKeys,
+		dataKeys:   dataKeys,
+		cacheTTL:   cacheTTL,
+		cache:      make(map[string]*orgKeys),
+	}
+}
+
+// Enabled reports whether new content is encrypted
+func (k *Keyring) Enabled() bool {
+	return k.masterKeys != nil
+}
+
+// IsEncrypted reports whether value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt encrypts plaintext with the active data key of the org. Empty values stay empty.
+func (k *Keyring) Encrypt(ctx context.Context, orgID string, plaintext string) (string, error) {
+	if !k.Enabled() || plaintext == "" {
+		return plaintext, nil
+	}
+
+	if orgID == "" {
+		return "", errors.New("cannot encrypt content without an organization")
+	}
+
+	keys, err := k.orgKeys(ctx, orgID, true)
+	if err != nil {
+		return "", err
+	}
+	if keys.shredded {
+		return "", ErrKeyShredded
+	}
+
+	sealed, err := seal(keys.keys[keys.active], []byte(plaintext), orgID)
+	if err != nil {
+		return "", err
+	}
+
+	// The org is part of the value so decryption needs no context, it is authenticated as additional data
+	return prefix + strconv.Itoa(keys.active) + ":" + orgID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. Plaintext values are returned unchanged.
+func (k *Keyring) Decrypt(ctx context.Context, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	if !k.Enabled() {
+		return "", ErrNotConfigured
+	}
+
+	version, orgID, sealed, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := k.orgKeys(ctx, orgID, false)
+	if err != nil {
+		return "", err
+	}
+
+	// The version may have been created by a rotation on another replica after the keys were cached
+	if _, ok := keys.keys[version]; !ok && !keys.shredded {
+		k.evict(orgID)
+		if keys, err = k.orgKeys(ctx, orgID, false); err != nil {
+			return "", err
+		}
+	}
+
+	if keys.shredded {
+		return "", ErrKeyShredded
+	}
+
+	key, ok := keys.keys[version]
+	if !ok {
+		return "", errors.Errorf("data key version %d of org %s does not exist", version, orgID)
+	}
+
+	plaintext, err := open(key, sealed, orgID)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rotate creates a new data key version for the org. New content is encrypted with it, existing
+// content stays readable with the older versions.
+func (k *Keyring) Rotate(ctx context.Context, orgID string) (version int, err error) {
+	if !k.Enabled() {
+		return 0, errors.New("encryption is not configured")
+	}
+	defer k.evict(orgID)
+
+	var existing []tenant.OrgDataKey
+	if existing, err = k.dataKeys.ListForOrg(ctx, orgID); err != nil {
+		return
+	}
+
+	for _, key := range existing {
+		if key.IsShredded() {
+			return 0, ErrKeyShredded
+		}
+		version = max(version, key.Version)
+	}
+
+	version++
+	err = k.createDataKey(ctx, orgID, version)
+	return
+}
+
+// Rewrap wraps every data key that is not wrapped by the primary master key with it. Run it after
+// replacing the master key, afterwards the previous master key can be removed.
+func (k *Keyring) Rewrap(ctx context.Context) (rewrapped int, err error) {
+	if !k.Enabled() {
+		return 0, errors.New("encryption is not configured")
+	}
+
+	var keys []tenant.OrgDataKey
+	if keys, err = k.dataKeys.List(ctx); err != nil {
+		return
+	}
+
+	for _, key := range keys {
+		if key.IsShredded() || key.MasterKeyID == k.masterKeys.PrimaryID() {
+			continue
+		}
+
+		aad := wrapAAD(key.OrgID, key.Version)
+
+		var dataKey []byte
+		if dataKey, err = k.masterKeys.unwrap(key.MasterKeyID, key.WrappedKey, aad); err != nil {
+			return rewrapped, errors.Wrapf(err, "failed to unwrap data key %d of org %s", key.Version, key.OrgID)
+		}
+
+		if key.WrappedKey, err = k.masterKeys.wrap(dataKey, aad); err != nil {
+			return
+		}
+		key.MasterKeyID = k.masterKeys.PrimaryID()
+
+		if err = k.dataKeys.Save(ctx, &key); err != nil {
+			return
+		}
+		rewrapped++
+	}
+
+	k.mu.Lock()
+	k.cache = make(map[string]*orgKeys)
+	k.mu.Unlock()
+	return
+}
+
+// Shred destroys all data keys of the org. Everything encrypted for the org becomes unreadable for
+// good and no new content can be stored for it, also if it had no keys yet. Other replicas stop
+// decrypting once their cached keys expire.
+func (k *Keyring) Shred(ctx context.Context, orgID string) error {
+	defer k.evict(orgID)
+	return k.dataKeys.Shred(ctx, orgID, time.Now().UTC())
+}
+
+func (k *Keyring) evict(orgID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.cache, orgID)
+}
+
+// orgKeys returns the cached keys of the org, loading them and creating the first one if needed
+func (k *Keyring) orgKeys(ctx context.Context, orgID string, create bool) (*orgKeys, error) {
+	k.mu.Lock()
+	cached, ok := k.cache[orgID]
+	k.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < k.cacheTTL {
+		return cached, nil
+	}
+
+	loaded, err := k.load(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(loaded.keys) == 0 && !loaded.shredded {
+		if !create {
+			return nil, errors.Errorf("org %s has no data key", orgID)
+		}
+
+		// Another replica may create the first key at the same time, the loser reloads the winner's key
+		if createErr := k.createDataKey(ctx, orgID, 1); createErr != nil {
+			if loaded, err = k.load(ctx, orgID); err != nil {
+				return nil, err
+			}
+			if len(loaded.keys) == 0 {
+				return nil, errors.Wrap(createErr, "failed to create data key")
+			}
+		} else if loaded, err = k.load(ctx, orgID); err != nil {
+			return nil, err
+		}
+	}
+
+	k.mu.Lock()
+	k.cache[orgID] = loaded
+	k.mu.Unlock()
+	return loaded, nil
+}
+
+func (k *Keyring) load(ctx context.Context, orgID string) (*orgKeys, error) {
+	stored, err := k.dataKeys.ListForOrg(ctx, orgID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load data keys")
+	}
+
+	loaded := &orgKeys{keys: make(map[int][]byte), loadedAt: time.Now()}
+	for _, key := range stored {
+		if key.IsShredded() {
+			loaded.shredded = true
+			continue
+		}
+
+		dataKey, err := k.masterKeys.unwrap(key.MasterKeyID, key.WrappedKey, wrapAAD(orgID, key.Version))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to unwrap data key %d of org %s", key.Version, orgID)
+		}
+
+		loaded.keys[key.Version] = dataKey
+		loaded.active = max(loaded.active, key.Version)
+	}
+	return loaded, nil
+}
+
+func (k *Keyring) createDataKey(ctx context.Context, orgID string, version int) (err error) {
+	dataKey := make([]byte, keySize)
+	if _, err = rand.Read(dataKey); err != nil {
+		return
+	}
+
+	key := tenant.OrgDataKey{OrgID: orgID, Version: version, MasterKeyID: k.masterKeys.PrimaryID()}
+	if key.WrappedKey, err = k.masterKeys.wrap(dataKey, wrapAAD(orgID, version)); err != nil {
+		return
+	}
+
+	return k.dataKeys.Create(ctx, &key)
+}
+
+// wrapAAD binds a wrapped data key to its org and version, so keys cannot be swapped between rows
+func wrapAAD(orgID string, version int) string {
+	return fmt.Sprintf("org-data-key:%s:%d", orgID, version)
+}
+
+func parse(value string) (version int, orgID string, sealed []byte, err error) {
+	rest := strings.TrimPrefix(value, prefix)
+
+	versionEnd := strings.Index(rest, ":")
+	orgEnd := strings.LastIndex(rest, ":")
+	if versionEnd < 0 || orgEnd <= versionEnd {
+		err = errors.New("malformed encrypted value")
+		return
+	}
+
+	if version, err = strconv.Atoi(rest[:versionEnd]); err != nil {
+		err = errors.New("malformed encrypted value")
+		return
+	}
+	orgID = rest[versionEnd+1 : orgEnd]
+
+	if sealed, err = base64.StdEncoding.DecodeString(rest[orgEnd+1:]); err != nil {
+		err = errors.New("malformed encrypted value")
+	}
+	return
+}
+
+// seal encrypts with AES-256-GCM and returns the nonce followed by the ciphertext
+func seal(key []byte, plaintext []byte, aad string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(aad)), nil
+}
+
+func open(key []byte, sealed []byte, aad string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(aad))
+	if err != nil {
+		return nil, errors.New("failed to decrypt, wrong key or tampered data")
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,212 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+)
+
+func testMasterKeys(t *testing.T) *MasterKeys {
+	t.Helper()
+
+	masterKeys, err := LoadMasterKeys(config.EncryptionConfig{
+		MasterKey: base64.StdEncoding.EncodeToString(make([]byte, keySize)),
+	})
+	if err != nil {
+		t.Fatalf("failed to load master keys: %v", err)
+	}
+	return masterKeys
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	keyring := NewKeyring(testMasterKeys(t), tenant.NewGormDataKeyRepository(dbtest.Open(t)), time.Hour)
+
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"empty", ""},
+		{"text", "What is our refund policy?"},
+		{"unicode", "Grüße aus Köln 👋"},
+		{"long", strings.Repeat("a long message ", 1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := keyring.Encrypt(ctx, "org-1", tt.plaintext)
+			if err != nil {
+				t.Fatalf("failed to encrypt: %v", err)
+			}
+			if tt.plaintext != "" && (!IsEncrypted(value) || strings.Contains(value, tt.plaintext)) {
+				t.Errorf("Encrypt(%q) = %q, want an encrypted value", tt.plaintext, value)
+			}
+
+			plaintext, err := keyring.Decrypt(ctx, value)
+			if err != nil {
+				t.Fatalf("failed to decrypt: %v", err)
+			}
+			if plaintext != tt.plaintext {
+				t.Errorf("Decrypt(Encrypt(%q)) = %q", tt.plaintext, plaintext)
+			}
+		})
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	ctx := context.Background()
+	dataKeys := tenant.NewGormDataKeyRepository(dbtest.Open(t))
+	keyring := NewKeyring(testMasterKeys(t), dataKeys, time.Hour)
+
+	encrypted, err := keyring.Encrypt(ctx, "org-1", "secret")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	if _, err = keyring.Encrypt(ctx, "org-2", "other secret"); err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		value   string
+		want    string
+		wantErr bool
+		errIs   error
+	}{
+		{name: "encrypted", keyring: keyring, value: encrypted, want: "secret"},
+		{name: "plaintext from before encryption", keyring: keyring, value: "written in plaintext", want: "written in plaintext"},
+		{name: "moved to another org", keyring: keyring, value: strings.Replace(encrypted, ":org-1:", ":org-2:", 1), wantErr: true},
+		{name: "unknown version", keyring: keyring, value: strings.Replace(encrypted, "enc:v1:1:", "enc:v1:7:", 1), wantErr: true},
+		{name: "malformed", keyring: keyring, value: "enc:v1:garbage", wantErr: true},
+		{name: "no master key", keyring: NewKeyring(nil, dataKeys, time.Hour), value: encrypted, wantErr: true, errIs: ErrNotConfigured},
+		{name: "plaintext without master key", keyring: NewKeyring(nil, dataKeys, time.Hour), value: "plain", want: "plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.keyring.Decrypt(ctx, tt.value)
+			if (err != nil) != tt.wantErr || (tt.errIs != nil && !errors.Is(err, tt.errIs)) {
+				t.Fatalf("Decrypt(%q) error = %v, want error %t %v", tt.value, err, tt.wantErr, tt.errIs)
+			}
+			if got != tt.want {
+				t.Errorf("Decrypt(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	keyring := NewKeyring(testMasterKeys(t), tenant.NewGormDataKeyRepository(dbtest.Open(t)), time.Hour)
+
+	before, err := keyring.Encrypt(ctx, "org-1", "before rotation")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	version, err := keyring.Rotate(ctx, "org-1")
+	if err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	if version != 2 {
+		t.Errorf("Rotate() = %d, want 2", version)
+	}
+
+	after, err := keyring.Encrypt(ctx, "org-1", "after rotation")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	if !strings.HasPrefix(after, "enc:v1:2:") {
+		t.Errorf("Encrypt() after rotation = %q, want it encrypted with version 2", after)
+	}
+
+	for value, want := range map[string]string{before: "before rotation", after: "after rotation"} {
+		if got, err := keyring.Decrypt(ctx, value); err != nil || got != want {
+			t.Errorf("Decrypt(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+}
+
+func TestShred(t *testing.T) {
+	ctx := context.Background()
+	keyring := NewKeyring(testMasterKeys(t), tenant.NewGormDataKeyRepository(dbtest.Open(t)), time.Hour)
+
+	shredded, err := keyring.Encrypt(ctx, "org-1", "to be forgotten")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	kept, err := keyring.Encrypt(ctx, "org-2", "kept")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	if err = keyring.Shred(ctx, "org-1"); err != nil {
+		t.Fatalf("failed to shred: %v", err)
+	}
+
+	if _, err = keyring.Decrypt(ctx, shredded); !errors.Is(err, ErrKeyShredded) {
+		t.Errorf("Decrypt() of a shredded org error = %v, want %v", err, ErrKeyShredded)
+	}
+	if _, err = keyring.Encrypt(ctx, "org-1", "new content"); !errors.Is(err, ErrKeyShredded) {
+		t.Errorf("Encrypt() for a shredded org error = %v, want %v", err, ErrKeyShredded)
+	}
+	if got, err := keyring.Decrypt(ctx, kept); err != nil || got != "kept" {
+		t.Errorf("Decrypt() of another org = %q, %v, want %q", got, err, "kept")
+	}
+}
+
+func TestDecryptAfterRotationOnAnotherReplica(t *testing.T) {
+	ctx := context.Background()
+	dataKeys := tenant.NewGormDataKeyRepository(dbtest.Open(t))
+	masterKeys := testMasterKeys(t)
+
+	// Two replicas sharing the database, with caches that outlive the test
+	rotating := NewKeyring(masterKeys, dataKeys, time.Hour)
+	stale := NewKeyring(masterKeys, dataKeys, time.Hour)
+
+	before, err := rotating.Encrypt(ctx, "org-1", "before rotation")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	if _, err = stale.Decrypt(ctx, before); err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+
+	if _, err = rotating.Rotate(ctx, "org-1"); err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	after, err := rotating.Encrypt(ctx, "org-1", "after rotation")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	plaintext, err := stale.Decrypt(ctx, after)
+	if err != nil {
+		t.Fatalf("stale replica failed to decrypt content of the rotated key: %v", err)
+	}
+	if plaintext != "after rotation" {
+		t.Errorf("got %q, want %q", plaintext, "after rotation")
+	}
+}
+
+func TestShredOrgWithoutKeys(t *testing.T) {
+	ctx := context.Background()
+	keyring := NewKeyring(testMasterKeys(t), tenant.NewGormDataKeyRepository(dbtest.Open(t)), time.Hour)
+
+	if err := keyring.Shred(ctx, "org-1"); err != nil {
+		t.Fatalf("failed to shred: %v", err)
+	}
+
+	if _, err := keyring.Encrypt(ctx, "org-1", "after shredding"); !errors.Is(err, ErrKeyShredded) {
+		t.Errorf("Encrypt() error = %v, want %v", err, ErrKeyShredded)
+	}
+	if _, err := keyring.Rotate(ctx, "org-1"); !errors.Is(err, ErrKeyShredded) {
+		t.Errorf("Rotate() error = %v, want %v", err, ErrKeyShredded)
+	}
+}
@@ -0,0 +1,132 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/pkg/errors"
+)
+
+const keySize = 32
+
+// MasterKeys wrap and unwrap the per-org data keys. New data keys are always wrapped with the
+// primary key, the others are only kept to unwrap data keys until they are rewrapped.
+type MasterKeys struct {
+	primaryID string
+	keys      map[string][]byte
+}
+
+// keyFile is the format of ENCRYPTION_KEY_FILE, modelled after the key material exports of
+// common KMS products:
+//
+//	{"primary_key_id": "2024-06", "keys": [{"id": "2024-06", "key": "<base64>"}, {"id": "2023-01", "key": "<base64>"}]}
+type keyFile struct {
+	PrimaryKeyID string `json:"primary_key_id"`
+	Keys         []struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	} `json:"keys"`
+}
+
+// LoadMasterKeys reads the master keys from the configuration. It returns nil if encryption is not configured.
+func LoadMasterKeys(settings config.EncryptionConfig) (masterKeys *MasterKeys, err error) {
+	switch {
+	case settings.KeyFile != "":
+		return loadKeyFile(settings.KeyFile)
+	case settings.MasterKey == "":
+		return nil, nil
+	}
+
+	masterKeys = &MasterKeys{keys: make(map[string][]byte)}
+	for i, encoded := range append([]string{settings.MasterKey}, settings.PreviousMasterKeys...) {
+		var key []byte
+		if key, err = decodeKey(encoded); err != nil {
+			return nil, errors.Wrap(err, "invalid master key in configuration")
+		}
+
+		// Keys from the environment have no name, identify them by fingerprint
+		id := fingerprint(key)
+		if i == 0 {
+			masterKeys.primaryID = id
+		}
+		masterKeys.keys[id] = key
+	}
+	return
+}
+
+func loadKeyFile(path string) (masterKeys *MasterKeys, err error) {
+	var content []byte
+	if content, err = os.ReadFile(path); err != nil {
+		return nil, errors.Wrap(err, "failed to read master keyfile")
+	}
+
+	var file keyFile
+	if err = json.Unmarshal(content, &file); err != nil {
+		return nil, errors.Wrap(err, "failed to parse master keyfile")
+	}
+
+	masterKeys = &MasterKeys{primaryID: file.PrimaryKeyID, keys: make(map[string][]byte)}
+	for _, entry := range file.Keys {
+		if entry.ID == "" {
+			return nil, errors.New("master keyfile contains a key without id")
+		}
+
+		var key []byte
+		if key, err = decodeKey(entry.Key); err != nil {
+			return nil, errors.Wrapf(err, "invalid master key %q in keyfile", entry.ID)
+		}
+		masterKeys.keys[entry.ID] = key
+	}
+
+	if _, ok := masterKeys.keys[masterKeys.primaryID]; !ok {
+		return nil, errors.Errorf("primary master key %q is not in the keyfile", file.PrimaryKeyID)
+	}
+	return
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "key is not base64 encoded")
+	}
+	if len(key) != keySize {
+		return nil, errors.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// PrimaryID returns the ID of the key new data keys are wrapped with
+func (m *MasterKeys) PrimaryID() string {
+	return m.primaryID
+}
+
+func (m *MasterKeys) wrap(dataKey []byte, aad string) (wrapped string, err error) {
+	var sealed []byte
+	if sealed, err = seal(m.keys[m.primaryID], dataKey, aad); err != nil {
+		return
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (m *MasterKeys) unwrap(masterKeyID string, wrapped string, aad string) ([]byte, error) {
+	key, ok := m.keys[masterKeyID]
+	if !ok {
+		return nil, errors.Errorf("master key %q is not configured", masterKeyID)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, errors.Wrap(err, "wrapped data key is not base64 encoded")
+	}
+
+	return open(key, sealed, aad)
+}
@@ -0,0 +1,160 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Probe checks a single dependency and returns nil when it is usable
+type Probe func(ctx context.Context) error
+
+type CheckResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// check caches the outcome of a probe. The mutex is held while probing, so concurrent readiness
+// requests wait for the running probe instead of starting their own.
+type check struct {
+	mu     sync.Mutex
+	probe  Probe
+	result CheckResult
+}
+
+// Checker runs the registered readiness probes and caches their results for a TTL, so frequent
+// orchestrator probes do not hit expensive dependencies like the model provider on every request
+type Checker struct {
+	ttl     time.Duration
+	timeout time.Duration
+	checks  map[string]*check
+
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(ttl time.Duration, timeout time.Duration) *Checker {
+	return &Checker{
+		ttl:     ttl,
+		timeout: timeout,
+		checks:  make(map[string]*check),
+	}
+}
+
+// Register adds a named probe. It must be called before the handlers are mounted.
+func (c *Checker) Register(name string, probe Probe) {
+	c.checks[name] = &check{probe: probe}
+}
+
+// ShutDown makes readiness fail from now on, whatever the probes report, so load balancers stop
+// sending traffic while in-flight requests are drained
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Check runs all probes whose cached result has expired, in parallel, and reports the overall status
+func (c *Checker) Check(ctx context.Context) (report Report) {
+	report = Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks))}
+
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, name, c.checks[name])
+		}()
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return
+}
+
+func (c *Checker) run(ctx context.Context, name string, chk *check) CheckResult {
+	chk.mu.Lock()
+	defer chk.mu.Unlock()
+
+	if !chk.result.CheckedAt.IsZero() && time.Since(chk.result.CheckedAt) < c.ttl {
+		return chk.result
+	}
+
+	// Do not let an aborted probe request poison the cache
+	probeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := chk.probe(probeCtx)
+
+	chk.result = CheckResult{
+		Status:    StatusOK,
+		LatencyMS: time.Since(start).Milliseconds(),
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		chk.result.Status = StatusUnavailable
+		chk.result.Error = err.Error()
+		log.Ctx(ctx).Warn().Err(err).Str("check", name).Int64("latency_ms", chk.result.LatencyMS).Msg("readiness check failed")
+	}
+	return chk.result
+}
+
+// LivenessHandler reports that the process is up and serving requests. It does not touch any
+// dependency, a failing database must not get the process restarted.
+func (c *Checker) LivenessHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": StatusOK})
+}
+
+// ReadinessHandler reports per-dependency status and answers 503 if any dependency is unavailable.
+// The probe is unauthenticated, errors and timings are only logged, they can reveal hosts and
+// account names.
+func (c *Checker) ReadinessHandler(ctx *gin.Context) {
+	if c.shuttingDown.Load() {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": StatusShuttingDown})
+		return
+	}
+
+	report := c.Check(ctx.Request.Context())
+
+	code := http.StatusOK
+	if report.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	checks := make(map[string]string, len(report.Checks))
+	for name, result := range report.Checks {
+		checks[name] = result.Status
+	}
+
+	// Send the response back through Gin
+	ctx.JSON(code, gin.H{"status": report.Status, "checks": checks})
+}
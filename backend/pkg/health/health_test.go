@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func readiness(t *testing.T, checker *Checker) *httptest.ResponseRecorder {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	checker.ReadinessHandler(ctx)
+	return recorder
+}
+
+func TestReadinessFailsAfterShutDown(t *testing.T) {
+	checker := NewChecker(time.Hour, time.Second)
+	checker.Register("database", func(ctx context.Context) error { return nil })
+
+	if recorder := readiness(t, checker); recorder.Code != http.StatusOK {
+		t.Fatalf("readiness = %d before shutdown, want %d", recorder.Code, http.StatusOK)
+	}
+
+	// The cached probe result must not keep the instance ready
+	checker.ShutDown()
+	if recorder := readiness(t, checker); recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("readiness = %d after shutdown, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestReadinessHidesProbeErrors(t *testing.T) {
+	checker := NewChecker(time.Hour, time.Second)
+	checker.Register("database", func(ctx context.Context) error { return nil })
+	checker.Register("model_provider", func(ctx context.Context) error {
+		return errors.New("failed to reach https://internal-llm.example:8443 as svc-account")
+	})
+
+	recorder := readiness(t, checker)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("readiness = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+
+	var body struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode readiness response %q: %v", recorder.Body.String(), err)
+	}
+
+	want := map[string]string{"database": StatusOK, "model_provider": StatusUnavailable}
+	if body.Status != StatusUnavailable || !maps.Equal(body.Checks, want) {
+		t.Errorf("readiness response = %+v, want status %s and checks %v", body, StatusUnavailable, want)
+	}
+	if strings.Contains(recorder.Body.String(), "internal-llm") {
+		t.Errorf("readiness response %q contains the probe error", recorder.Body.String())
+	}
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Job is periodic background work. It should stop early when ctx is cancelled.
+type Job func(ctx context.Context) error
+
+type job struct {
+	name      string
+	interval  time.Duration
+	run       Job
+	exclusive bool
+}
+
+// Runner runs registered jobs on their intervals inside the server process. Jobs registered with
+// Register run on every replica, exclusive jobs on the replica holding their lease.
+type Runner struct {
+	metrics *metrics.Metrics
+	leases  LeaseRepository
+	holder  string
+	jobs    []job
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewRunner(metricsService *metrics.Metrics, leases LeaseRepository) *Runner {
+	hostname, _ := os.Hostname()
+	return &Runner{metrics: metricsService, leases: leases, holder: hostname + "/" + uuid.NewString()}
+}
+
+// Register adds a job that runs on every replica, like refreshing data kept in memory. It must be
+// called before Start.
+func (r *Runner) Register(name string, interval time.Duration, run Job) {
+	r.jobs = append(r.jobs, job{name: name, interval: interval, run: run})
+}
+
+// RegisterExclusive adds a job that runs on one replica at a time. The replica that runs it takes a
+// lease for one interval and keeps renewing it, another replica takes over once the lease expires.
+// A run that takes longer than the interval can still overlap with one on another replica, so the
+// job must be safe to repeat. It must be called before Start.
+func (r *Runner) RegisterExclusive(name string, interval time.Duration, run Job) {
+	r.jobs = append(r.jobs, job{name: name, interval: interval, run: run, exclusive: true})
+}
+
+// Start runs every job once right away and then on its interval until Stop is called
+func (r *Runner) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+
+	for _, j := range r.jobs {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+
+			ticker := time.NewTicker(j.interval)
+			defer ticker.Stop()
+
+			r.runOnce(ctx, j)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					r.runOnce(ctx, j)
+				}
+			}
+		}()
+	}
+}
+
+// Stop cancels running jobs and waits for them to return
+func (r *Runner) Stop() {
+	if r.cancel == nil {
+		return
+	}
+
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *Runner) runOnce(ctx context.Context, j job) {
+	logger := log.With().Str("job", j.name).Logger()
+	ctx = logger.WithContext(ctx)
+
+	if j.exclusive {
+		acquired, err := r.leases.Acquire(ctx, j.name, r.holder, j.interval)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error().Err(err).Msg("failed to acquire job lease")
+			}
+			return
+		}
+		if !acquired {
+			logger.Debug().Msg("background job is running on another replica")
+			return
+		}
+	}
+
+	start := time.Now()
+	err := j.run(ctx)
+	duration := time.Since(start)
+
+	if err != nil && ctx.Err() == nil {
+		r.metrics.ObserveJobRun(j.name, false, duration)
+		logger.Error().Err(err).Dur("duration", duration).Msg("background job failed")
+		return
+	}
+
+	r.metrics.ObserveJobRun(j.name, true, duration)
+	logger.Debug().Dur("duration", duration).Msg("background job finished")
+}
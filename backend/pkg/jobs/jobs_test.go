@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+)
+
+func TestLeaseAcquire(t *testing.T) {
+	ctx := context.Background()
+	leases := NewGormLeaseRepository(dbtest.Open(t))
+
+	steps := []struct {
+		name     string
+		job      string
+		holder   string
+		duration time.Duration
+		want     bool
+	}{
+		{name: "free lease", job: "retention", holder: "replica-1", duration: time.Hour, want: true},
+		{name: "held by another replica", job: "retention", holder: "replica-2", duration: time.Hour, want: false},
+		{name: "renewed by its holder", job: "retention", holder: "replica-1", duration: -time.Minute, want: true},
+		{name: "expired", job: "retention", holder: "replica-2", duration: time.Hour, want: true},
+		{name: "lost by its previous holder", job: "retention", holder: "replica-1", duration: time.Hour, want: false},
+		{name: "other job", job: "audit", holder: "replica-1", duration: time.Hour, want: true},
+	}
+	for _, step := range steps {
+		acquired, err := leases.Acquire(ctx, step.job, step.holder, step.duration)
+		if err != nil {
+			t.Fatalf("%s: Acquire() error = %v", step.name, err)
+		}
+		if acquired != step.want {
+			t.Errorf("%s: Acquire() = %v, want %v", step.name, acquired, step.want)
+		}
+	}
+}
+
+func TestLeaseAcquireConcurrently(t *testing.T) {
+	leases := NewGormLeaseRepository(dbtest.Open(t))
+
+	var acquired atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ok, err := leases.Acquire(context.Background(), "retention", string(rune('a'+i)), time.Hour)
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+			}
+			if ok {
+				acquired.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired.Load() != 1 {
+		t.Errorf("%d replicas acquired the lease, want 1", acquired.Load())
+	}
+}
+
+func TestRunnerExclusiveJobs(t *testing.T) {
+	leases := NewGormLeaseRepository(dbtest.Open(t))
+	metricsServer := metrics.NewMetrics()
+
+	var exclusiveRuns, everywhereRuns atomic.Int32
+	var runners []*Runner
+	for range 3 {
+		runner := NewRunner(metricsServer, leases)
+		runner.RegisterExclusive("retention", time.Hour, func(context.Context) error {
+			exclusiveRuns.Add(1)
+			return nil
+		})
+		runner.Register("refresh", time.Hour, func(context.Context) error {
+			everywhereRuns.Add(1)
+			return nil
+		})
+		runners = append(runners, runner)
+	}
+
+	// Two rounds, the lease keeps the exclusive job on the first replica
+	for range 2 {
+		for _, runner := range runners {
+			for _, j := range runner.jobs {
+				runner.runOnce(context.Background(), j)
+			}
+		}
+	}
+
+	if everywhereRuns.Load() != 6 {
+		t.Errorf("job ran %d times, want twice per replica", everywhereRuns.Load())
+	}
+	if exclusiveRuns.Load() != 2 {
+		t.Errorf("exclusive job ran %d times, want twice", exclusiveRuns.Load())
+	}
+}
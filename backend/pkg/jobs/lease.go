@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lease records which replica runs an exclusive job until when
+type Lease struct {
+	Name      string `gorm:"primaryKey"`
+	Holder    string
+	ExpiresAt time.Time
+}
+
+func (Lease) TableName() string {
+	return "job_leases"
+}
+
+type LeaseRepository interface {
+	// Acquire takes or renews the lease of a job for holder. It returns false if another holder has
+	// a lease that has not expired yet.
+	Acquire(ctx context.Context, name string, holder string, duration time.Duration) (bool, error)
+}
+
+type gormLeaseRepository struct {
+	db *gorm.DB
+}
+
+func NewGormLeaseRepository(db *gorm.DB) LeaseRepository {
+	return &gormLeaseRepository{db: db}
+}
+
+func (r *gormLeaseRepository) Acquire(ctx context.Context, name string, holder string, duration time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	lease := Lease{Name: name, Holder: holder, ExpiresAt: now.Add(duration)}
+
+	// A single upsert, so two replicas cannot both see the lease as expired and take it
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"holder", "expires_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "job_leases.expires_at < ? OR job_leases.holder = ?", Vars: []any{now, holder}},
+		}},
+	}).Create(&lease)
+	return result.RowsAffected > 0, result.Error
+}
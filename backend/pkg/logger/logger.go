@@ -1,8 +1,14 @@
 package logger
 
-import "github.com/rs/zerolog"
+import (
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
 
 func init() {
 	// UNIX Time is faster and smaller than most timestamps
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+
+	// log.Ctx falls back to the global logger outside of requests, e.g. in background jobs
+	zerolog.DefaultContextLogger = &log.Logger
 }
@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// requestInfo lets WithUser tell the access log about the user of a request. The logger itself is
+// never changed, log lines written concurrently by background work of the request would race with it.
+type requestInfo struct {
+	mu     sync.Mutex
+	logger *zerolog.Logger
+	userID string
+}
+
+type requestInfoKey struct{}
+
+// Incoming request IDs are logged verbatim, so only accept short and harmless ones
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Middleware assigns every request an ID, taken from X-Request-ID if the caller sent a valid one,
+// and echoes it in the response. It attaches a logger carrying the request ID, route and thread ID
+// to the request context, retrieve it with log.Ctx, and writes one access log line per request.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		ctx.Header(RequestIDHeader, requestID)
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		fields := log.With().Str("request_id", requestID).Str("route", route)
+		if threadID := ctx.Param("thread_id"); threadID != "" {
+			fields = fields.Str("thread_id", threadID)
+		}
+
+		span := trace.SpanFromContext(ctx.Request.Context())
+		if span.SpanContext().IsValid() {
+			fields = fields.Str("trace_id", span.SpanContext().TraceID().String())
+			span.SetAttributes(attribute.String("http.request_id", requestID))
+		}
+
+		requestLogger := fields.Logger()
+		info := &requestInfo{logger: &requestLogger}
+		requestCtx := context.WithValue(ctx.Request.Context(), requestInfoKey{}, info)
+		ctx.Request = ctx.Request.WithContext(requestLogger.WithContext(requestCtx))
+
+		ctx.Next()
+
+		// WithUser may have attributed the request to a user, the access log carries them as well
+		info.mu.Lock()
+		requestLogger = *info.logger
+		info.mu.Unlock()
+
+		status := ctx.Writer.Status()
+		event := requestLogger.Info()
+		switch {
+		case status >= 500:
+			event = requestLogger.Error()
+		case strings.HasSuffix(route, "/healthz") || strings.HasSuffix(route, "/readyz"):
+			// Orchestrator probes would drown out real traffic
+			event = requestLogger.Debug()
+		}
+
+		event.
+			Str("method", ctx.Request.Method).
+			Str("path", ctx.Request.URL.Path).
+			Int("status", status).
+			Dur("latency_ms", time.Since(start)).
+			Int("bytes", max(ctx.Writer.Size(), 0)).
+			Str("client_ip", ctx.ClientIP()).
+			Str("user_agent", ctx.Request.UserAgent()).
+			Msg("request")
+	}
+}
+
+// WithUser attributes the rest of the request to the authenticated user. It derives a logger with the
+// user and org from the request logger, which the access log uses, and returns ctx with that logger.
+// Handlers make it the context of the request, so later log lines carry the user as well:
+//
+//	ctx.Request = ctx.Request.WithContext(logger.WithUser(ctx.Request.Context(), user.ID, user.OrgID))
+//
+// Outside a request ctx is returned unchanged.
+func WithUser(ctx context.Context, userID string, orgID string) context.Context {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return ctx
+	}
+
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	if info.userID != userID {
+		userLogger := info.logger.With().Str("user_id", userID).Str("org_id", orgID).Logger()
+		info.logger = &userLogger
+		info.userID = userID
+	}
+	return info.logger.WithContext(ctx)
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// captureLogs sends the global logger to a buffer for the duration of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = previous })
+	return &buf
+}
+
+// logLines decodes the JSON log lines with the given message
+func logLines(t *testing.T, buf *bytes.Buffer, message string) (lines []map[string]any) {
+	t.Helper()
+
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var line map[string]any
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("failed to decode log line %q: %v", raw, err)
+		}
+		if line["message"] == message {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+func TestWithUserAttributesRequest(t *testing.T) {
+	buf := captureLogs(t)
+
+	engine := gin.New()
+	engine.Use(Middleware())
+	engine.GET("/profile", func(ctx *gin.Context) {
+		before := ctx.Request.Context()
+		ctx.Request = ctx.Request.WithContext(WithUser(ctx.Request.Context(), "user-1", "org-1"))
+
+		log.Ctx(ctx.Request.Context()).Info().Msg("handled")
+		log.Ctx(before).Info().Msg("earlier context")
+		ctx.Status(http.StatusNoContent)
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/profile", nil))
+
+	for _, message := range []string{"handled", "request"} {
+		lines := logLines(t, buf, message)
+		if len(lines) != 1 || lines[0]["user_id"] != "user-1" || lines[0]["org_id"] != "org-1" {
+			t.Errorf("%q log lines = %v, want one attributed to user-1 of org-1", message, lines)
+		}
+	}
+
+	// The logger of the context taken before is not changed
+	if lines := logLines(t, buf, "earlier context"); len(lines) != 1 || lines[0]["user_id"] != nil {
+		t.Errorf("earlier context log lines = %v, want one without a user", lines)
+	}
+}
+
+func TestAccessLogOfPanickingRequest(t *testing.T) {
+	buf := captureLogs(t)
+
+	engine := gin.New()
+	engine.Use(Middleware(), utils.Recovery())
+	engine.GET("/panic", func(ctx *gin.Context) {
+		panic("boom")
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	lines := logLines(t, buf, "request")
+	if len(lines) != 1 || lines[0]["status"] != float64(http.StatusInternalServerError) {
+		t.Errorf("access log lines = %v, want one with status 500", lines)
+	}
+}
@@ -0,0 +1,140 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends account emails like verification and password reset links
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// NewMailer returns the mailer selected by MAIL_TRANSPORT
+func NewMailer(cfg config.MailConfig) Mailer {
+	if cfg.Transport == config.MailTransportSMTP {
+		return &SMTPMailer{
+			addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+			host:     cfg.SMTPHost,
+			from:     cfg.From,
+			username: cfg.SMTPUsername,
+			password: cfg.SMTPPassword,
+			timeout:  cfg.SMTPTimeout,
+		}
+	}
+	return LogMailer{}
+}
+
+// LogMailer writes emails to the log instead of sending them. The log then holds the links, only use
+// it in development.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, message Message) error {
+	log.Ctx(ctx).Info().Str("to", message.To).Str("subject", message.Subject).Str("body", message.Body).Msg("email not sent, MAIL_TRANSPORT is log")
+	return nil
+}
+
+// SMTPMailer sends emails through an SMTP relay. The connection is upgraded with STARTTLS when the
+// server offers it, credentials are only sent over TLS.
+type SMTPMailer struct {
+	addr     string
+	host     string
+	from     string
+	username string
+	password string
+	timeout  time.Duration
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	// Headers are written as is, a line break would let the caller add their own
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return errors.New("email headers must not contain line breaks")
+	}
+
+	// net/smtp does not take a context, the connection deadline bounds the whole conversation
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to the SMTP server")
+	}
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close()
+		return errors.Wrap(err, "failed to set the SMTP connection deadline")
+	}
+	// A caller giving up earlier interrupts the conversation as well
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		_ = conn.Close()
+		return errors.Wrap(err, "failed to greet the SMTP server")
+	}
+	defer func() { _ = client.Close() }()
+
+	return errors.Wrap(m.send(client, message), "failed to send email")
+}
+
+func (m *SMTPMailer) send(client *smtp.Client, message Message) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(message.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(m.format(message)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (m *SMTPMailer) format(message Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", message.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
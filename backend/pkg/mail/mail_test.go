@@ -0,0 +1,75 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+)
+
+// silentServer accepts SMTP connections and never answers
+func silentServer(t *testing.T) (host string, port int) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestSMTPMailerTimeout(t *testing.T) {
+	host, port := silentServer(t)
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  time.Duration
+	}{
+		{name: "server does not answer", timeout: 100 * time.Millisecond},
+		{name: "caller gives up", timeout: time.Minute, cancel: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailer := NewMailer(config.MailConfig{
+				Transport:   config.MailTransportSMTP,
+				From:        "no-reply@acme.example",
+				SMTPHost:    host,
+				SMTPPort:    port,
+				SMTPTimeout: tt.timeout,
+			})
+
+			ctx := context.Background()
+			if tt.cancel > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.cancel)
+				defer cancel()
+			}
+
+			start := time.Now()
+			err := mailer.Send(ctx, Message{To: "jane@acme.example", Subject: "Verify your email", Body: "Hello"})
+			if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+				t.Errorf("Send() error = %v, want a timeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Send() returned after %v, want it to give up after about 100ms", elapsed)
+			}
+		})
+	}
+}
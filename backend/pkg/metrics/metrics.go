@@ -1,78 +1,244 @@
 package metrics
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"strconv"
+	"time"
+)
+
+// Upstreams used to classify errors
+const (
+	UpstreamOmnistrate    = "omnistrate"
+	UpstreamDatabase      = "database"
+	UpstreamModelProvider = "model_provider"
 )
 
 type Metrics struct {
 	customRegistry                *prometheus.Registry
+	labelPolicy                   string
 	TotalRequestsCounter          *prometheus.CounterVec `json:"-"`
 	TotalRequestTokens            *prometheus.CounterVec `json:"-"`
 	TotalResponseTokens           *prometheus.CounterVec `json:"-"`
 	TotalChatThreadsCreated       *prometheus.CounterVec `json:"-"`
 	TotalSuccessfulSigninAttempts *prometheus.CounterVec `json:"-"`
 	TotalUsersPerOrganization     *prometheus.GaugeVec   `json:"-"`
+
+	HTTPRequestDuration   *prometheus.HistogramVec `json:"-"`
+	HTTPRequestsTotal     *prometheus.CounterVec   `json:"-"`
+	LLMGenerationDuration *prometheus.HistogramVec `json:"-"`
+	LLMTimeToFirstToken   *prometheus.HistogramVec `json:"-"`
+	LLMTokensPerSecond    *prometheus.HistogramVec `json:"-"`
+	UpstreamErrors        *prometheus.CounterVec   `json:"-"`
+	PIIDetections         *prometheus.CounterVec   `json:"-"`
+	ModerationVerdicts    *prometheus.CounterVec   `json:"-"`
+	JobRuns               *prometheus.CounterVec   `json:"-"`
+	JobDuration           *prometheus.HistogramVec `json:"-"`
+	RetentionPurged       *prometheus.CounterVec   `json:"-"`
 }
 
 func NewMetrics() (m *Metrics) {
+	labelPolicy := config.Current.Metrics.LabelPolicy
+	var tenantLabels []string
+	switch labelPolicy {
+	case config.MetricsLabelPolicyFull:
+		tenantLabels = []string{"user_id", "organization_id", "email"}
+	case config.MetricsLabelPolicyHashed:
+		tenantLabels = []string{"user_id", "organization_id"}
+	default:
+		labelPolicy = config.MetricsLabelPolicyOrg
+		tenantLabels = []string{"organization_id"}
+	}
+
 	m = &Metrics{
 		customRegistry: prometheus.NewRegistry(),
+		labelPolicy:    labelPolicy,
 		TotalRequestsCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "total_requests",
 			Help: "Total number of requests",
-		}, []string{"user_id", "organization_id", "email"}),
+		}, tenantLabels),
 		TotalRequestTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "total_request_tokens",
 			Help: "Total number of request tokens",
-		}, []string{"user_id", "organization_id", "email"}),
+		}, tenantLabels),
 		TotalResponseTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "total_response_tokens",
 			Help: "Total number of response tokens",
-		}, []string{"user_id", "organization_id", "email"}),
+		}, tenantLabels),
 		TotalChatThreadsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "total_chat_threads_created",
 			Help: "Total number of chat threads created",
-		}, []string{"user_id", "organization_id", "email"}),
+		}, tenantLabels),
 		TotalSuccessfulSigninAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "total_successful_signin_attempts",
 			Help: "Total number of successful signin attempts",
-		}, []string{"user_id", "organization_id", "email"}),
+		}, tenantLabels),
 		TotalUsersPerOrganization: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "total_users_per_organization",
 			Help: "Total number of users per organization",
 		}, []string{"organization_id"}),
+		HTTPRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		HTTPRequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests",
+		}, []string{"method", "route", "status"}),
+		LLMGenerationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "llm_generation_duration_seconds",
+			Help:    "Total time to generate a response",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+		}, []string{"model"}),
+		LLMTimeToFirstToken: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "llm_time_to_first_token_seconds",
+			Help:    "Time until the first token of a response is received",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+		}, []string{"model"}),
+		LLMTokensPerSecond: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "llm_tokens_per_second",
+			Help:    "Completion tokens generated per second after the first token",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		}, []string{"model"}),
+		UpstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "upstream_errors_total",
+			Help: "Total number of failed calls to upstream dependencies",
+		}, []string{"upstream", "operation"}),
+		PIIDetections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pii_detections_total",
+			Help: "Total number of personal data values found in prompts, by category and the action taken",
+		}, []string{"category", "action"}),
+		ModerationVerdicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "moderation_verdicts_total",
+			Help: "Total number of moderated queries and responses, by stage and the action taken",
+		}, []string{"stage", "action"}),
+		JobRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "background_job_runs_total",
+			Help: "Total number of background job runs, by job and result",
+		}, []string{"job", "result"}),
+		JobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "background_job_duration_seconds",
+			Help:    "Duration of background job runs",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"job"}),
+		RetentionPurged: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "retention_purged_total",
+			Help: "Total number of rows deleted by retention policies, by kind",
+		}, []string{"organization_id", "kind"}),
 	}
 
 	m.register()
 	return
 }
 
+// tenantLabelValues maps a tenant to label values according to the configured label policy
+func (m *Metrics) tenantLabelValues(userID, orgID, email string) []string {
+	switch m.labelPolicy {
+	case config.MetricsLabelPolicyFull:
+		return []string{userID, orgID, email}
+	case config.MetricsLabelPolicyHashed:
+		return []string{hashUserID(userID), orgID}
+	default:
+		return []string{orgID}
+	}
+}
+
+// hashUserID pseudonymizes a user ID. The hash is stable so per-user series can still be followed.
+func hashUserID(userID string) string {
+	sum := sha256.Sum256([]byte(config.Current.Metrics.LabelHashSalt + userID))
+	return hex.EncodeToString(sum[:8])
+}
+
 func (m *Metrics) IncrementTotalRequests(userID, orgID, email string) {
-	m.TotalRequestsCounter.WithLabelValues(userID, orgID, email).Inc()
+	m.TotalRequestsCounter.WithLabelValues(m.tenantLabelValues(userID, orgID, email)...).Inc()
 }
 
 func (m *Metrics) IncrementTotalRequestTokens(userID, orgID, email string, count float64) {
-	m.TotalRequestTokens.WithLabelValues(userID, orgID, email).Add(count)
+	m.TotalRequestTokens.WithLabelValues(m.tenantLabelValues(userID, orgID, email)...).Add(count)
 }
 
 func (m *Metrics) IncrementTotalResponseTokens(userID, orgID, email string, count float64) {
-	m.TotalResponseTokens.WithLabelValues(userID, orgID, email).Add(count)
+	m.TotalResponseTokens.WithLabelValues(m.tenantLabelValues(userID, orgID, email)...).Add(count)
 }
 
 func (m *Metrics) IncrementTotalChatThreads(userID, orgID, email string) {
-	m.TotalChatThreadsCreated.WithLabelValues(userID, orgID, email).Inc()
+	m.TotalChatThreadsCreated.WithLabelValues(m.tenantLabelValues(userID, orgID, email)...).Inc()
 }
 
 func (m *Metrics) IncrementTotalSuccessfulSigninAttempts(userID, orgID, email string) {
-	m.TotalSuccessfulSigninAttempts.WithLabelValues(userID, orgID, email).Inc()
+	m.TotalSuccessfulSigninAttempts.WithLabelValues(m.tenantLabelValues(userID, orgID, email)...).Inc()
 }
 
 func (m *Metrics) SetTotalUsersPerOrganization(organizationID string, totalUsers float64) {
 	m.TotalUsersPerOrganization.WithLabelValues(organizationID).Set(totalUsers)
 }
 
+// RefreshUsersPerOrganization sets TotalUsersPerOrganization from the given counter. It runs as a
+// background job.
+func (m *Metrics) RefreshUsersPerOrganization(ctx context.Context, count func(context.Context) (map[string]int64, error)) error {
+	counts, err := count(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Reset first so deleted orgs do not linger
+	m.TotalUsersPerOrganization.Reset()
+	for orgID, total := range counts {
+		m.SetTotalUsersPerOrganization(orgID, float64(total))
+	}
+	return nil
+}
+
+func (m *Metrics) ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	statusLabel := strconv.Itoa(status)
+	m.HTTPRequestDuration.WithLabelValues(method, route, statusLabel).Observe(duration.Seconds())
+	m.HTTPRequestsTotal.WithLabelValues(method, route, statusLabel).Inc()
+}
+
+// ObserveLLMGeneration records a completed generation. Throughput is only recorded when the
+// provider reported token usage.
+func (m *Metrics) ObserveLLMGeneration(model string, total, timeToFirstToken time.Duration, completionTokens int) {
+	m.LLMGenerationDuration.WithLabelValues(model).Observe(total.Seconds())
+	m.LLMTimeToFirstToken.WithLabelValues(model).Observe(timeToFirstToken.Seconds())
+
+	if generation := total - timeToFirstToken; completionTokens > 0 && generation > 0 {
+		m.LLMTokensPerSecond.WithLabelValues(model).Observe(float64(completionTokens) / generation.Seconds())
+	}
+}
+
+func (m *Metrics) IncrementUpstreamErrors(upstream, operation string) {
+	m.UpstreamErrors.WithLabelValues(upstream, operation).Inc()
+}
+
+func (m *Metrics) AddPIIDetections(category, action string, count int) {
+	m.PIIDetections.WithLabelValues(category, action).Add(float64(count))
+}
+
+func (m *Metrics) IncrementModerationVerdicts(stage, action string) {
+	m.ModerationVerdicts.WithLabelValues(stage, action).Inc()
+}
+
+func (m *Metrics) ObserveJobRun(job string, succeeded bool, duration time.Duration) {
+	result := "success"
+	if !succeeded {
+		result = "failure"
+	}
+	m.JobRuns.WithLabelValues(job, result).Inc()
+	m.JobDuration.WithLabelValues(job).Observe(duration.Seconds())
+}
+
+func (m *Metrics) AddRetentionPurged(orgID, kind string, count int64) {
+	m.RetentionPurged.WithLabelValues(orgID, kind).Add(float64(count))
+}
+
 func (m *Metrics) Reset() {
 	m.TotalRequestsCounter.Reset()
 	m.TotalRequestTokens.Reset()
@@ -80,6 +246,17 @@ func (m *Metrics) Reset() {
 	m.TotalChatThreadsCreated.Reset()
 	m.TotalSuccessfulSigninAttempts.Reset()
 	m.TotalUsersPerOrganization.Reset()
+	m.HTTPRequestDuration.Reset()
+	m.HTTPRequestsTotal.Reset()
+	m.LLMGenerationDuration.Reset()
+	m.LLMTimeToFirstToken.Reset()
+	m.LLMTokensPerSecond.Reset()
+	m.UpstreamErrors.Reset()
+	m.PIIDetections.Reset()
+	m.ModerationVerdicts.Reset()
+	m.JobRuns.Reset()
+	m.JobDuration.Reset()
+	m.RetentionPurged.Reset()
 }
 
 func (m *Metrics) register() {
@@ -89,6 +266,24 @@ func (m *Metrics) register() {
 	m.customRegistry.MustRegister(m.TotalChatThreadsCreated)
 	m.customRegistry.MustRegister(m.TotalSuccessfulSigninAttempts)
 	m.customRegistry.MustRegister(m.TotalUsersPerOrganization)
+	m.customRegistry.MustRegister(m.HTTPRequestDuration)
+	m.customRegistry.MustRegister(m.HTTPRequestsTotal)
+	m.customRegistry.MustRegister(m.LLMGenerationDuration)
+	m.customRegistry.MustRegister(m.LLMTimeToFirstToken)
+	m.customRegistry.MustRegister(m.LLMTokensPerSecond)
+	m.customRegistry.MustRegister(m.UpstreamErrors)
+	m.customRegistry.MustRegister(m.PIIDetections)
+	m.customRegistry.MustRegister(m.ModerationVerdicts)
+	m.customRegistry.MustRegister(m.JobRuns)
+	m.customRegistry.MustRegister(m.JobDuration)
+	m.customRegistry.MustRegister(m.RetentionPurged)
+}
+
+// RegisterDBStats exposes connection pool statistics, labelled with the pool role
+func (m *Metrics) RegisterDBStats(pools map[string]*sql.DB) {
+	for role, pool := range pools {
+		m.customRegistry.MustRegister(collectors.NewDBStatsCollector(pool, role))
+	}
 }
 
 func (m *Metrics) Handler() http.Handler {
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HTTPMiddleware records latency and status codes per route. Unmatched paths are grouped under a
+// single route label to keep cardinality bounded.
+func (m *Metrics) HTTPMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		m.ObserveHTTPRequest(ctx.Request.Method, route, ctx.Writer.Status(), time.Since(start))
+	}
+}
+
+// InstrumentGORM counts failed database operations. Missing records are not failures.
+func (m *Metrics) InstrumentGORM(db *gorm.DB) error {
+	record := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				m.IncrementUpstreamErrors(UpstreamDatabase, operation)
+			}
+		}
+	}
+
+	processor := db.Callback()
+	if err := processor.Create().After("gorm:create").Register("metrics:create", record("create")); err != nil {
+		return err
+	}
+	if err := processor.Query().After("gorm:query").Register("metrics:query", record("query")); err != nil {
+		return err
+	}
+	if err := processor.Update().After("gorm:update").Register("metrics:update", record("update")); err != nil {
+		return err
+	}
+	if err := processor.Delete().After("gorm:delete").Register("metrics:delete", record("delete")); err != nil {
+		return err
+	}
+	if err := processor.Row().After("gorm:row").Register("metrics:row", record("row")); err != nil {
+		return err
+	}
+	return processor.Raw().After("gorm:raw").Register("metrics:raw", record("raw"))
+}
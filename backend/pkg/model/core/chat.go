@@ -1,7 +1,6 @@
 package core
 
 import (
-	"github.com/omnistrate-community/ai-chatbot/pkg/db"
 	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
 	"time"
 )
@@ -20,6 +19,8 @@ type Thread struct {
 	Name      string      `gorm:"index"`
 	UserID    string      `gorm:"index"`
 	User      tenant.User `gorm:"foreignKey:UserID" json:"-"`
+	// LegalHold exempts the thread from retention policies
+	LegalHold bool
 }
 
 type Message struct {
@@ -29,37 +30,15 @@ type Message struct {
 	Thread      Thread    `gorm:"foreignKey:ThreadID" json:"-"`
 	Content     string
 	MessageType MessageType `gorm:"index"`
+	// RedactionCount is the number of personal data values replaced before the query was sent to the model
+	RedactionCount int
+	// Moderation is the verdict of the moderation stage, nil if moderation is disabled
+	Moderation *ModerationVerdict `gorm:"serializer:json"`
 }
 
-func Initialize() error {
-	return db.Connect().AutoMigrate(
-		&Thread{},
-		&Message{},
-	)
-}
-
-func (t *Thread) Save() error {
-	return db.Connect().Save(t).Error
-}
-
-func (t *Thread) GetMessages() ([]Message, error) {
-	var messages []Message
-	err := db.Connect().Model(&Message{}).Where("thread_id = ?", t.ID).Find(&messages).Error
-	return messages, err
-}
-
-func GetThreadsForUser(userID string) ([]Thread, error) {
-	var threads []Thread
-	err := db.Connect().Where("user_id = ?", userID).Find(&threads).Error
-	return threads, err
-}
-
-func GetThreadByID(threadID string, userID string) (Thread, error) {
-	var thread Thread
-	err := db.Connect().Where("id = ?", threadID).Where("user_id = ?", userID).First(&thread).Error
-	return thread, err
-}
-
-func (m *Message) Save() error {
-	return db.Connect().Model(&Message{}).Where(m).Save(m).Error
+// ModerationVerdict records what the moderation stage found in a message and what it did about it
+type ModerationVerdict struct {
+	// Action is pass if nothing was flagged, otherwise the action taken: refuse, annotate or allow
+	Action     string   `json:"action"`
+	Categories []string `json:"categories,omitempty"`
 }
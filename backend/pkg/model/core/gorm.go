@@ -0,0 +1,220 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.ErrNotFound
+	}
+	return err
+}
+
+type gormThreadRepository struct {
+	db     *gorm.DB
+	reader func() *gorm.DB
+}
+
+// NewGormThreadRepository returns a thread repository writing to db. Thread listings are read
+// through reader, which may return a read replica.
+func NewGormThreadRepository(db *gorm.DB, reader func() *gorm.DB) ThreadRepository {
+	return &gormThreadRepository{db: db, reader: reader}
+}
+
+func (r *gormThreadRepository) Save(ctx context.Context, thread *Thread) error {
+	return r.db.WithContext(ctx).Save(thread).Error
+}
+
+func (r *gormThreadRepository) Get(ctx context.Context, threadID string, userID string) (Thread, error) {
+	var thread Thread
+	err := r.db.WithContext(ctx).Where("id = ?", threadID).Where("user_id = ?", userID).First(&thread).Error
+	return thread, translateError(err)
+}
+
+func (r *gormThreadRepository) ListForUser(ctx context.Context, userID string) ([]Thread, error) {
+	var threads []Thread
+	err := r.reader().WithContext(ctx).Where("user_id = ?", userID).Find(&threads).Error
+	return threads, err
+}
+
+func (r *gormThreadRepository) CreateWithMessages(ctx context.Context, thread *Thread, messages []Message) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(thread).Error; err != nil {
+			return err
+		}
+
+		if len(messages) == 0 {
+			return nil
+		}
+
+		return tx.Omit(clause.Associations).CreateInBatches(messages, 500).Error
+	})
+}
+
+func (r *gormThreadRepository) SetLegalHold(ctx context.Context, threadID string, orgID string, hold bool) error {
+	// UpdateColumn keeps updated_at, placing a hold is not activity on the thread
+	result := r.db.WithContext(ctx).Model(&Thread{}).
+		Where("id = ?", threadID).
+		Where("user_id IN (?)", r.db.Table("users").Select("id").Where("org_id = ?", orgID)).
+		UpdateColumn("legal_hold", hold)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormThreadRepository) PurgeInactive(ctx context.Context, orgID string, before time.Time, limit int) (int64, error) {
+	db := r.db.WithContext(ctx)
+
+	var threadIDs []string
+	err := orgThreads(db, orgID).
+		Where("threads.updated_at < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM messages WHERE messages.thread_id = threads.id AND messages.created_at >= ?)", before).
+		Limit(limit).
+		Pluck("threads.id", &threadIDs).Error
+	if err != nil || len(threadIDs) == 0 {
+		return 0, err
+	}
+
+	var purged int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("thread_id IN ?", threadIDs).Delete(&Message{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("thread_id IN ?", threadIDs).Delete(&ThreadShare{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("id IN ?", threadIDs).Delete(&Thread{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+func (r *gormThreadRepository) DeleteForUser(ctx context.Context, userID string) (deleted int64, retained int64, err error) {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		userThreads := tx.Model(&Thread{}).Select("id").Where("user_id = ?", userID).Where("legal_hold = ?", false)
+
+		if err := tx.Where("thread_id IN (?)", userThreads).Delete(&Message{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("thread_id IN (?)", userThreads).Delete(&ThreadShare{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ?", userID).Where("legal_hold = ?", false).Delete(&Thread{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+
+		return tx.Model(&Thread{}).Where("user_id = ?", userID).Count(&retained).Error
+	})
+	return
+}
+
+// orgThreads selects the IDs of the org's threads that are not on legal hold
+func orgThreads(db *gorm.DB, orgID string) *gorm.DB {
+	return db.Table("threads").
+		Select("threads.id").
+		Joins("JOIN users ON users.id = threads.user_id").
+		Where("users.org_id = ?", orgID).
+		Where("threads.legal_hold = ?", false)
+}
+
+type gormMessageRepository struct {
+	db *gorm.DB
+}
+
+func NewGormMessageRepository(db *gorm.DB) MessageRepository {
+	return &gormMessageRepository{db: db}
+}
+
+// Save stores the message only. The thread is saved on its own beforehand, upserting it through the
+// association again would also bypass the encryption of its name.
+func (r *gormMessageRepository) Save(ctx context.Context, message *Message) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(message).Error
+}
+
+func (r *gormMessageRepository) ListForThread(ctx context.Context, threadID string) ([]Message, error) {
+	var messages []Message
+	err := r.db.WithContext(ctx).Where("thread_id = ?", threadID).Order("created_at asc").Find(&messages).Error
+	return messages, err
+}
+
+func (r *gormMessageRepository) PurgeOlderThan(ctx context.Context, orgID string, before time.Time, limit int) (int64, error) {
+	db := r.db.WithContext(ctx)
+
+	batch := db.Model(&Message{}).
+		Select("message_id").
+		Where("thread_id IN (?)", orgThreads(db, orgID)).
+		Where("created_at < ?", before).
+		Limit(limit)
+
+	result := db.Where("message_id IN (?)", batch).Delete(&Message{})
+	return result.RowsAffected, result.Error
+}
+
+type gormShareRepository struct {
+	db     *gorm.DB
+	reader func() *gorm.DB
+}
+
+func NewGormShareRepository(db *gorm.DB, reader func() *gorm.DB) ShareRepository {
+	return &gormShareRepository{db: db, reader: reader}
+}
+
+func (r *gormShareRepository) Save(ctx context.Context, share *ThreadShare) error {
+	return r.db.WithContext(ctx).Save(share).Error
+}
+
+func (r *gormShareRepository) Get(ctx context.Context, shareID string, threadID string, userID string) (ThreadShare, error) {
+	var share ThreadShare
+	err := r.db.WithContext(ctx).Where("id = ?", shareID).Where("thread_id = ?", threadID).Where("user_id = ?", userID).First(&share).Error
+	return share, translateError(err)
+}
+
+func (r *gormShareRepository) GetByTokenHash(ctx context.Context, tokenHash string) (ThreadShare, error) {
+	var share ThreadShare
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&share).Error
+	return share, translateError(err)
+}
+
+func (r *gormShareRepository) ListForThread(ctx context.Context, threadID string, userID string) ([]ThreadShare, error) {
+	var shares []ThreadShare
+	err := r.reader().WithContext(ctx).Where("thread_id = ?", threadID).Where("user_id = ?", userID).Order("created_at desc").Find(&shares).Error
+	return shares, err
+}
+
+func (r *gormShareRepository) ListForUser(ctx context.Context, userID string) ([]ThreadShare, error) {
+	var shares []ThreadShare
+	err := r.reader().WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc").Find(&shares).Error
+	return shares, err
+}
+
+func (r *gormShareRepository) PurgeCreatedBefore(ctx context.Context, orgID string, before time.Time, limit int) (int64, error) {
+	db := r.db.WithContext(ctx)
+
+	batch := db.Model(&ThreadShare{}).
+		Select("id").
+		Where("org_id = ?", orgID).
+		Where("created_at < ?", before).
+		Where("thread_id NOT IN (?)", db.Table("threads").Select("id").Where("legal_hold = ?", true)).
+		Limit(limit)
+
+	result := db.Where("id IN (?)", batch).Delete(&ThreadShare{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// ThreadRepository stores threads. Lookups are always scoped to the owning user.
+type ThreadRepository interface {
+	Save(ctx context.Context, thread *Thread) error
+	Get(ctx context.Context, threadID string, userID string) (Thread, error)
+	ListForUser(ctx context.Context, userID string) ([]Thread, error)
+
+	// CreateWithMessages inserts a thread and its messages atomically, keeping the timestamps
+	// that are already set on them
+	CreateWithMessages(ctx context.Context, thread *Thread, messages []Message) error
+
+	// SetLegalHold places or lifts a legal hold on a thread of the org
+	SetLegalHold(ctx context.Context, threadID string, orgID string, hold bool) error
+
+	// PurgeInactive deletes up to limit threads of the org without activity since before, together
+	// with their messages and shares. Threads on legal hold are kept.
+	PurgeInactive(ctx context.Context, orgID string, before time.Time, limit int) (int64, error)
+
+	// DeleteForUser deletes all threads of the user with their messages and shares. Threads on legal
+	// hold are kept and counted in retained.
+	DeleteForUser(ctx context.Context, userID string) (deleted int64, retained int64, err error)
+}
+
+type MessageRepository interface {
+	Save(ctx context.Context, message *Message) error
+
+	// ListForThread returns the messages of a thread ordered by creation time
+	ListForThread(ctx context.Context, threadID string) ([]Message, error)
+
+	// PurgeOlderThan deletes up to limit messages of the org created before before. Messages of
+	// threads on legal hold are kept.
+	PurgeOlderThan(ctx context.Context, orgID string, before time.Time, limit int) (int64, error)
+}
+
+type ShareRepository interface {
+	Save(ctx context.Context, share *ThreadShare) error
+	Get(ctx context.Context, shareID string, threadID string, userID string) (ThreadShare, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (ThreadShare, error)
+	ListForThread(ctx context.Context, threadID string, userID string) ([]ThreadShare, error)
+	ListForUser(ctx context.Context, userID string) ([]ThreadShare, error)
+
+	// PurgeCreatedBefore deletes up to limit shares of the org created before before. Shares of
+	// threads on legal hold are kept.
+	PurgeCreatedBefore(ctx context.Context, orgID string, before time.Time, limit int) (int64, error)
+}
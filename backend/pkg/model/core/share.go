@@ -0,0 +1,41 @@
+package core
+
+import (
+	"time"
+)
+
+// ThreadShare is a public, read-only snapshot of a thread. The raw share token is
+// only handed out once at creation time, we only keep its hash.
+type ThreadShare struct {
+	ID         string          `gorm:"primaryKey" json:"share_id"`
+	TokenHash  string          `gorm:"uniqueIndex" json:"-"`
+	ThreadID   string          `gorm:"index" json:"thread_id"`
+	UserID     string          `gorm:"index" json:"-"`
+	OrgID      string          `gorm:"index" json:"-"`
+	ThreadName string          `json:"thread_name"`
+	Messages   []SharedMessage `gorm:"serializer:json" json:"-"`
+	CreatedAt  time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	ExpiresAt  *time.Time      `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time      `json:"revoked_at,omitempty"`
+}
+
+// SharedMessage is the frozen copy of a message at the time the thread was shared
+type SharedMessage struct {
+	MessageID   string      `json:"message_id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Content     string      `json:"content"`
+	MessageType MessageType `json:"message_type"`
+}
+
+// IsActive returns true if the share has neither been revoked nor expired
+func (s *ThreadShare) IsActive(now time.Time) bool {
+	if s.RevokedAt != nil {
+		return false
+	}
+
+	if s.ExpiresAt != nil && !now.Before(*s.ExpiresAt) {
+		return false
+	}
+
+	return true
+}
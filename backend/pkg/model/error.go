@@ -1,5 +1,10 @@
 package model
 
+import "errors"
+
+// ErrNotFound is returned by repositories when the requested record does not exist
+var ErrNotFound = errors.New("record not found")
+
 type Error struct {
 	Name      string `json:"name"`
 	Id        string `json:"id"`
@@ -0,0 +1,39 @@
+package tenant
+
+import "time"
+
+// Audit event outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent records a security-relevant action. Events are only ever appended, never changed.
+type AuditEvent struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+	OrgID      string    `gorm:"index" json:"organization_id,omitempty"`
+	ActorID    string    `gorm:"index" json:"actor_id,omitempty"`
+	ActorEmail string    `json:"actor_email,omitempty"`
+	Action     string    `gorm:"index" json:"action"`
+	Outcome    string    `json:"outcome"`
+	TargetType string    `json:"target_type,omitempty"`
+	TargetID   string    `json:"target_id,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	// Details holds action specific data, never secrets or message content
+	Details map[string]any `gorm:"serializer:json" json:"details,omitempty"`
+}
+
+// AuditFilter narrows down an audit log query. Zero values match everything.
+type AuditFilter struct {
+	OrgID   string
+	ActorID string
+	Action  string
+	From    time.Time
+	To      time.Time
+	// BeforeID continues a listing after the last event of the previous page
+	BeforeID int64
+	Limit    int
+}
@@ -0,0 +1,118 @@
+package tenant
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"gorm.io/gorm"
+)
+
+func TestAuditEventsAreAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	handle := dbtest.Open(t)
+	repo := NewGormAuditRepository(handle, func() *gorm.DB { return handle })
+
+	event := AuditEvent{OrgID: "org-1", ActorID: "user-1", Action: "user.signin", Outcome: AuditOutcomeSuccess}
+	if err := repo.Append(ctx, &event); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func() error
+	}{
+		{
+			name: "update",
+			change: func() error {
+				return handle.Model(&AuditEvent{}).Where("id = ?", event.ID).Update("outcome", AuditOutcomeFailure).Error
+			},
+		},
+		{
+			name: "delete",
+			change: func() error {
+				return handle.Where("id = ?", event.ID).Delete(&AuditEvent{}).Error
+			},
+		},
+		{
+			name: "delete everything",
+			change: func() error {
+				return handle.Exec("DELETE FROM audit_events").Error
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err == nil || !strings.Contains(err.Error(), "append-only") {
+				t.Errorf("error = %v, want the append-only trigger to abort", err)
+			}
+		})
+	}
+
+	events, err := repo.List(ctx, AuditFilter{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Outcome != AuditOutcomeSuccess {
+		t.Errorf("List() = %+v, want the event unchanged", events)
+	}
+}
+
+func TestAuditList(t *testing.T) {
+	ctx := context.Background()
+	handle := dbtest.Open(t)
+	repo := NewGormAuditRepository(handle, func() *gorm.DB { return handle })
+
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, event := range []AuditEvent{
+		{OrgID: "org-1", ActorID: "user-1", Action: "user.signin"},
+		{OrgID: "org-1", ActorID: "user-2", Action: "user.signin"},
+		{OrgID: "org-1", ActorID: "user-1", Action: "share.create"},
+		{OrgID: "org-2", ActorID: "user-3", Action: "user.signin"},
+		{OrgID: "org-1", ActorID: "user-2", Action: "share.revoke"},
+	} {
+		// One event per day, IDs 1 to 5
+		event.Outcome = AuditOutcomeSuccess
+		event.CreatedAt = start.AddDate(0, 0, i)
+		if err := repo.Append(ctx, &event); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []int64
+	}{
+		{name: "everything", filter: AuditFilter{}, want: []int64{5, 4, 3, 2, 1}},
+		{name: "org", filter: AuditFilter{OrgID: "org-1"}, want: []int64{5, 3, 2, 1}},
+		{name: "actor", filter: AuditFilter{OrgID: "org-1", ActorID: "user-1"}, want: []int64{3, 1}},
+		{name: "action", filter: AuditFilter{OrgID: "org-1", Action: "user.signin"}, want: []int64{2, 1}},
+		{name: "from is inclusive", filter: AuditFilter{From: start.AddDate(0, 0, 3)}, want: []int64{5, 4}},
+		{name: "to is exclusive", filter: AuditFilter{To: start.AddDate(0, 0, 1)}, want: []int64{1}},
+		{name: "time range", filter: AuditFilter{From: start.AddDate(0, 0, 1), To: start.AddDate(0, 0, 3)}, want: []int64{3, 2}},
+		{name: "limit", filter: AuditFilter{Limit: 2}, want: []int64{5, 4}},
+		{name: "next page", filter: AuditFilter{BeforeID: 4, Limit: 2}, want: []int64{3, 2}},
+		{name: "last page", filter: AuditFilter{BeforeID: 2, Limit: 2}, want: []int64{1}},
+		{name: "nothing matches", filter: AuditFilter{OrgID: "org-3"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := repo.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			var ids []int64
+			for _, event := range events {
+				ids = append(ids, event.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("List() IDs = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package tenant
+
+import "time"
+
+// Kinds of tokens issued by the local authentication provider
+const (
+	AuthTokenRefresh       = "refresh"
+	AuthTokenVerifyEmail   = "verify_email"
+	AuthTokenResetPassword = "reset_password"
+)
+
+// LocalCredential is the password of a user managed by the local authentication provider. Users
+// synced from Omnistrate have none until they reset their password.
+type LocalCredential struct {
+	UserID string `gorm:"primaryKey"`
+	// PasswordHash is an argon2id hash in PHC string format
+	PasswordHash    string
+	EmailVerifiedAt *time.Time
+	// SessionVersion is carried by access tokens, tokens of an older version are rejected
+	SessionVersion int
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+}
+
+// IsEmailVerified returns true once the user proved that they own their email address
+func (c LocalCredential) IsEmailVerified() bool {
+	return c.EmailVerifiedAt != nil
+}
+
+// AuthToken is a single-use refresh, verification or reset token. Only its SHA-256 hash is stored.
+type AuthToken struct {
+	Hash      string `gorm:"primaryKey"`
+	Kind      string
+	UserID    string `gorm:"index"`
+	ExpiresAt time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
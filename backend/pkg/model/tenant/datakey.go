@@ -0,0 +1,20 @@
+package tenant
+
+import "time"
+
+// OrgDataKey is a per-org key encrypting the org's content. It is only stored wrapped by a master
+// key. Rotation adds a new version, older versions stay around to decrypt what they encrypted.
+type OrgDataKey struct {
+	OrgID       string `gorm:"primaryKey"`
+	Version     int    `gorm:"primaryKey;autoIncrement:false"`
+	MasterKeyID string
+	// Empty once the key has been shredded
+	WrappedKey string
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	ShreddedAt *time.Time
+}
+
+// IsShredded returns true if the key was destroyed, everything it encrypted is unreadable
+func (k *OrgDataKey) IsShredded() bool {
+	return k.ShreddedAt != nil
+}
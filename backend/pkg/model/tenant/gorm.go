@@ -0,0 +1,357 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.ErrNotFound
+	}
+	return err
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func NewGormUserRepository(db *gorm.DB) UserRepository {
+	return &gormUserRepository{db: db}
+}
+
+func (r *gormUserRepository) Save(ctx context.Context, user *User) error {
+	return r.db.WithContext(ctx).Save(user).Error
+}
+
+func (r *gormUserRepository) Get(ctx context.Context, userID string) (User, error) {
+	var user User
+	err := r.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error
+	return user, translateError(err)
+}
+
+func (r *gormUserRepository) GetByEmail(ctx context.Context, email string) (User, error) {
+	var user User
+	err := r.db.WithContext(ctx).Where("lower(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error
+	return user, translateError(err)
+}
+
+func (r *gormUserRepository) CountByOrg(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		OrgID string
+		Total int64
+	}
+
+	if err := r.db.WithContext(ctx).Model(&User{}).Select("org_id, COUNT(*) AS total").Group("org_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.OrgID] = row.Total
+	}
+	return counts, nil
+}
+
+func (r *gormUserRepository) CountAdmins(ctx context.Context, orgID string) (int64, error) {
+	var count int64
+	// Anonymized users are gone, their rows only stay for threads on legal hold
+	err := r.db.WithContext(ctx).Model(&User{}).
+		Where("org_id = ? AND role IN ? AND email IS NOT NULL", orgID, []string{RoleRoot, RoleAdmin}).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormUserRepository) Delete(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Where("id = ?", userID).Delete(&User{}).Error
+}
+
+func (r *gormUserRepository) Anonymize(ctx context.Context, userID string) error {
+	// The email is unique, NULL keeps several anonymized users apart
+	return r.db.WithContext(ctx).Model(&User{}).Where("id = ?", userID).
+		Updates(map[string]any{"email": nil, "name": ""}).Error
+}
+
+type gormOrgRepository struct {
+	db *gorm.DB
+}
+
+func NewGormOrgRepository(db *gorm.DB) OrgRepository {
+	return &gormOrgRepository{db: db}
+}
+
+func (r *gormOrgRepository) Save(ctx context.Context, org *Org) error {
+	return r.db.WithContext(ctx).Save(org).Error
+}
+
+func (r *gormOrgRepository) Get(ctx context.Context, orgID string) (Org, error) {
+	var org Org
+	err := r.db.WithContext(ctx).Where("id = ?", orgID).First(&org).Error
+	return org, translateError(err)
+}
+
+type gormPendingSignupRepository struct {
+	db *gorm.DB
+}
+
+func NewGormPendingSignupRepository(db *gorm.DB) PendingSignupRepository {
+	return &gormPendingSignupRepository{db: db}
+}
+
+func (r *gormPendingSignupRepository) Save(ctx context.Context, signup *PendingSignup) error {
+	return r.db.WithContext(ctx).Save(signup).Error
+}
+
+func (r *gormPendingSignupRepository) Take(ctx context.Context, email string) (PendingSignup, error) {
+	var signup PendingSignup
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ?", email).First(&signup).Error; err != nil {
+			return err
+		}
+		return tx.Where("email = ?", email).Delete(&PendingSignup{}).Error
+	})
+	return signup, translateError(err)
+}
+
+type gormCredentialRepository struct {
+	db *gorm.DB
+}
+
+// NewGormCredentialRepository returns a credential repository. Credentials and tokens are always
+// read from the primary, a replica could still hold a consumed token.
+func NewGormCredentialRepository(db *gorm.DB) CredentialRepository {
+	return &gormCredentialRepository{db: db}
+}
+
+func (r *gormCredentialRepository) CreateAccount(ctx context.Context, org *Org, user *User, credential *LocalCredential) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Org").Create(user).Error; err != nil {
+			return err
+		}
+		return tx.Create(credential).Error
+	})
+}
+
+func (r *gormCredentialRepository) Save(ctx context.Context, credential *LocalCredential) error {
+	return r.db.WithContext(ctx).Save(credential).Error
+}
+
+func (r *gormCredentialRepository) Get(ctx context.Context, userID string) (LocalCredential, error) {
+	var credential LocalCredential
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&credential).Error
+	return credential, translateError(err)
+}
+
+func (r *gormCredentialRepository) Delete(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&AuthToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&LocalCredential{}).Error
+	})
+}
+
+func (r *gormCredentialRepository) CreateToken(ctx context.Context, token *AuthToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Tokens that were never used would otherwise pile up
+		if err := tx.Where("user_id = ? AND expires_at <= ?", token.UserID, time.Now()).Delete(&AuthToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+func (r *gormCredentialRepository) ConsumeToken(ctx context.Context, kind string, hash string, now time.Time) (AuthToken, error) {
+	var token AuthToken
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("hash = ? AND kind = ?", hash, kind).First(&token).Error; err != nil {
+			return err
+		}
+
+		// Only one of several concurrent requests gets to delete the token
+		result := tx.Where("hash = ?", hash).Delete(&AuthToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err == nil && !token.ExpiresAt.After(now) {
+		return AuthToken{}, model.ErrNotFound
+	}
+	return token, translateError(err)
+}
+
+func (r *gormCredentialRepository) DeleteTokens(ctx context.Context, userID string, kind string) error {
+	return r.db.WithContext(ctx).Where("user_id = ? AND kind = ?", userID, kind).Delete(&AuthToken{}).Error
+}
+
+type gormOrgSettingsRepository struct {
+	db *gorm.DB
+}
+
+func NewGormOrgSettingsRepository(db *gorm.DB) OrgSettingsRepository {
+	return &gormOrgSettingsRepository{db: db}
+}
+
+func (r *gormOrgSettingsRepository) Save(ctx context.Context, settings *OrgSettings) error {
+	return r.db.WithContext(ctx).Save(settings).Error
+}
+
+func (r *gormOrgSettingsRepository) Get(ctx context.Context, orgID string) (OrgSettings, error) {
+	var settings OrgSettings
+	err := r.db.WithContext(ctx).Where("org_id = ?", orgID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultOrgSettings(orgID), nil
+	}
+	return settings, err
+}
+
+func (r *gormOrgSettingsRepository) ListWithRetention(ctx context.Context) ([]OrgSettings, error) {
+	var settings []OrgSettings
+	err := r.db.WithContext(ctx).Where("message_retention_days > 0 OR thread_retention_days > 0").Find(&settings).Error
+	return settings, err
+}
+
+type gormUsageRepository struct {
+	db     *gorm.DB
+	reader func() *gorm.DB
+}
+
+func NewGormUsageRepository(db *gorm.DB, reader func() *gorm.DB) UsageRepository {
+	return &gormUsageRepository{db: db, reader: reader}
+}
+
+func (r *gormUsageRepository) Add(ctx context.Context, record UsageRecord) error {
+	increment := func(column string) clause.Expr {
+		return gorm.Expr("usage_records." + column + " + excluded." + column)
+	}
+
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "org_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "requests"}, Value: increment("requests")},
+			{Column: clause.Column{Name: "request_tokens"}, Value: increment("request_tokens")},
+			{Column: clause.Column{Name: "response_tokens"}, Value: increment("response_tokens")},
+			{Column: clause.Column{Name: "threads_created"}, Value: increment("threads_created")},
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("excluded.updated_at")},
+		},
+	}).Create(&record).Error
+}
+
+func (r *gormUsageRepository) List(ctx context.Context, fromDay string, toDay string) ([]UsageRecord, error) {
+	var records []UsageRecord
+	err := r.reader().WithContext(ctx).
+		Where("day >= ?", fromDay).
+		Where("day <= ?", toDay).
+		Order("day asc, org_id asc, user_id asc").
+		Find(&records).Error
+	return records, err
+}
+
+func (r *gormUsageRepository) ListForUser(ctx context.Context, userID string) ([]UsageRecord, error) {
+	var records []UsageRecord
+	err := r.reader().WithContext(ctx).Where("user_id = ?", userID).Order("day asc, org_id asc").Find(&records).Error
+	return records, err
+}
+
+func (r *gormUsageRepository) Pseudonymize(ctx context.Context, userID string, pseudonym string) error {
+	return r.db.WithContext(ctx).Model(&UsageRecord{}).Where("user_id = ?", userID).Update("user_id", pseudonym).Error
+}
+
+type gormDataKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewGormDataKeyRepository returns a data key repository. Keys are always read from the primary,
+// a replica lagging behind a rotation or shredding must not be used.
+func NewGormDataKeyRepository(db *gorm.DB) DataKeyRepository {
+	return &gormDataKeyRepository{db: db}
+}
+
+func (r *gormDataKeyRepository) Create(ctx context.Context, key *OrgDataKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *gormDataKeyRepository) Save(ctx context.Context, key *OrgDataKey) error {
+	return r.db.WithContext(ctx).Save(key).Error
+}
+
+func (r *gormDataKeyRepository) ListForOrg(ctx context.Context, orgID string) ([]OrgDataKey, error) {
+	var keys []OrgDataKey
+	err := r.db.WithContext(ctx).Where("org_id = ?", orgID).Order("version asc").Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormDataKeyRepository) List(ctx context.Context) ([]OrgDataKey, error) {
+	var keys []OrgDataKey
+	err := r.db.WithContext(ctx).Order("org_id asc, version asc").Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormDataKeyRepository) Shred(ctx context.Context, orgID string, at time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&OrgDataKey{}).
+			Where("org_id = ?", orgID).
+			Updates(map[string]any{"wrapped_key": "", "shredded_at": at})
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+
+		// An org without keys gets a shredded version 0, so no key is created for it later
+		return tx.Create(&OrgDataKey{OrgID: orgID, Version: 0, ShreddedAt: &at}).Error
+	})
+}
+
+type gormAuditRepository struct {
+	db     *gorm.DB
+	reader func() *gorm.DB
+}
+
+func NewGormAuditRepository(db *gorm.DB, reader func() *gorm.DB) AuditRepository {
+	return &gormAuditRepository{db: db, reader: reader}
+}
+
+func (r *gormAuditRepository) Append(ctx context.Context, event *AuditEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+func (r *gormAuditRepository) List(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	query := r.reader().WithContext(ctx).Order("id desc")
+	if filter.OrgID != "" {
+		query = query.Where("org_id = ?", filter.OrgID)
+	}
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var events []AuditEvent
+	err := query.Find(&events).Error
+	return events, err
+}
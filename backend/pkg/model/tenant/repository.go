@@ -0,0 +1,105 @@
+package tenant
+
+import (
+	"context"
+	"time"
+)
+
+type UserRepository interface {
+	Save(ctx context.Context, user *User) error
+	Get(ctx context.Context, userID string) (User, error)
+	// GetByEmail matches the email without regard to case
+	GetByEmail(ctx context.Context, email string) (User, error)
+
+	// CountByOrg returns the number of users per org ID
+	CountByOrg(ctx context.Context) (map[string]int64, error)
+
+	// CountAdmins returns the number of root and admin users of the org
+	CountAdmins(ctx context.Context, orgID string) (int64, error)
+
+	Delete(ctx context.Context, userID string) error
+
+	// Anonymize clears the personal data of a user whose row has to stay, e.g. for threads on legal hold
+	Anonymize(ctx context.Context, userID string) error
+}
+
+type OrgRepository interface {
+	Save(ctx context.Context, org *Org) error
+	Get(ctx context.Context, orgID string) (Org, error)
+}
+
+type PendingSignupRepository interface {
+	Save(ctx context.Context, signup *PendingSignup) error
+
+	// Take returns the pending signup of the email and removes it, or model.ErrNotFound
+	Take(ctx context.Context, email string) (PendingSignup, error)
+}
+
+// CredentialRepository holds the passwords and tokens of the local authentication provider
+type CredentialRepository interface {
+	// CreateAccount stores a new org, its first user and their credential together
+	CreateAccount(ctx context.Context, org *Org, user *User, credential *LocalCredential) error
+
+	Save(ctx context.Context, credential *LocalCredential) error
+	Get(ctx context.Context, userID string) (LocalCredential, error)
+
+	// Delete removes the credential and every token of the user
+	Delete(ctx context.Context, userID string) error
+
+	CreateToken(ctx context.Context, token *AuthToken) error
+
+	// ConsumeToken deletes the token and returns it. Every token can only be consumed once, expired
+	// tokens are reported as not found.
+	ConsumeToken(ctx context.Context, kind string, hash string, now time.Time) (AuthToken, error)
+
+	// DeleteTokens removes the user's tokens of one kind, e.g. all refresh tokens after a password reset
+	DeleteTokens(ctx context.Context, userID string, kind string) error
+}
+
+type OrgSettingsRepository interface {
+	Save(ctx context.Context, settings *OrgSettings) error
+
+	// Get returns the stored settings of the org, or the defaults if there are none
+	Get(ctx context.Context, orgID string) (OrgSettings, error)
+
+	// ListWithRetention returns the settings of all orgs with a retention policy
+	ListWithRetention(ctx context.Context) ([]OrgSettings, error)
+}
+
+type UsageRepository interface {
+	// Add increments the counters of the record's day, org and user by the values in record
+	Add(ctx context.Context, record UsageRecord) error
+
+	// List returns all records between the two days, both inclusive, ordered by day
+	List(ctx context.Context, fromDay string, toDay string) ([]UsageRecord, error)
+
+	// ListForUser returns all records of the user ordered by day
+	ListForUser(ctx context.Context, userID string) ([]UsageRecord, error)
+
+	// Pseudonymize replaces the user ID of all records of the user, so totals stay correct for billing
+	Pseudonymize(ctx context.Context, userID string, pseudonym string) error
+}
+
+type DataKeyRepository interface {
+	// Create inserts a new key version and fails if the version already exists
+	Create(ctx context.Context, key *OrgDataKey) error
+	Save(ctx context.Context, key *OrgDataKey) error
+
+	// ListForOrg returns all key versions of the org ordered by version
+	ListForOrg(ctx context.Context, orgID string) ([]OrgDataKey, error)
+
+	// List returns the keys of all orgs
+	List(ctx context.Context) ([]OrgDataKey, error)
+
+	// Shred destroys all key versions of the org. An org without keys is marked as shredded, so
+	// none are created for it afterwards.
+	Shred(ctx context.Context, orgID string, at time.Time) error
+}
+
+// AuditRepository is append-only, there are deliberately no methods to change or delete events
+type AuditRepository interface {
+	Append(ctx context.Context, event *AuditEvent) error
+
+	// List returns the events matching the filter, newest first
+	List(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+}
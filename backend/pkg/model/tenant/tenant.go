@@ -1,43 +1,74 @@
 package tenant
 
 import (
-	"github.com/omnistrate-community/ai-chatbot/pkg/db"
+	"time"
 )
 
-func Initialize() error {
-	return db.Connect().AutoMigrate(
-		&User{},
-		&Org{},
-	)
-}
+const (
+	RoleRoot   = "root"
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleReader = "reader"
+)
 
 type User struct {
-	ID    string `gorm:"primaryKey"`
-	Email string `gorm:"unique"`
-	Name  string `gorm:"index"`
-	OrgID string `gorm:"index"`
+	ID    string `gorm:"primaryKey" json:"id"`
+	Email string `gorm:"unique" json:"email"`
+	Name  string `gorm:"index" json:"name"`
+	OrgID string `gorm:"index" json:"organization_id"`
 	Org   Org    `gorm:"foreignKey:OrgID" json:"-"`
+	Role  string `json:"role"`
 
 	// Add your custom per-tenant user schema here
 }
 
-func (u User) Save() error {
-	return db.Connect().Save(u).Error
+// IsOrgAdmin returns true if the user is allowed to manage org-wide settings
+func (u User) IsOrgAdmin() bool {
+	return u.Role == RoleRoot || u.Role == RoleAdmin
 }
 
 type Org struct {
-	ID               string `gorm:"primaryKey"`
-	Name             string `gorm:"index"`
-	LegalCompanyName string
-	Description      string
-	LogoURL          string
-	WebsiteURL       string
+	ID               string `gorm:"primaryKey" json:"id"`
+	Name             string `gorm:"index" json:"name"`
+	LegalCompanyName string `json:"legal_company_name"`
+	Description      string `json:"description"`
+	LogoURL          string `json:"logo_url"`
+	WebsiteURL       string `json:"website_url"`
 
 	// Add your custom per-tenant org schema here
 }
 
-func (o Org) Save() error {
-	return db.Connect().Save(o).Error
+// PendingSignup keeps what a customer entered at signup that Omnistrate does not store, until their
+// first sign-in creates the local user and org
+type PendingSignup struct {
+	Email            string `gorm:"primaryKey"`
+	LegalCompanyName string
+	CreatedAt        time.Time `gorm:"autoCreateTime"`
+}
+
+// OrgSettings holds the org-wide policies. Orgs without a stored row use the defaults.
+type OrgSettings struct {
+	OrgID                 string `gorm:"primaryKey" json:"-"`
+	PublicSharingDisabled bool   `json:"public_sharing_disabled"`
+	// PIIPolicy maps personal data categories to redact, block or allow, overriding the default action
+	PIIPolicy map[string]string `gorm:"column:pii_policy;serializer:json" json:"pii_policy"`
+	// ModerationPolicy maps moderation categories to refuse, annotate or allow, overriding the default action
+	ModerationPolicy map[string]string `gorm:"serializer:json" json:"moderation_policy"`
+	// MessageRetentionDays deletes message content older than this, keeping the threads. 0 keeps messages forever.
+	MessageRetentionDays int `json:"message_retention_days"`
+	// ThreadRetentionDays deletes threads without activity for this long. 0 keeps threads forever.
+	ThreadRetentionDays int       `json:"thread_retention_days"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// HasRetention reports whether the org deletes anything after a while
+func (s OrgSettings) HasRetention() bool {
+	return s.MessageRetentionDays > 0 || s.ThreadRetentionDays > 0
+}
+
+// DefaultOrgSettings returns the settings used for orgs that never changed them
+func DefaultOrgSettings(orgID string) OrgSettings {
+	return OrgSettings{OrgID: orgID}
 }
 
 // Add any other tenant-related models here
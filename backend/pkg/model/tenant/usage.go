@@ -0,0 +1,24 @@
+package tenant
+
+import "time"
+
+// UsageDayFormat is the layout of UsageRecord.Day
+const UsageDayFormat = "2006-01-02"
+
+// UsageRecord aggregates the usage of a user per UTC day. It is the billing-grade source of truth,
+// unlike the Prometheus counters it survives restarts and is not subject to label policies.
+type UsageRecord struct {
+	Day            string    `gorm:"primaryKey" json:"day"`
+	OrgID          string    `gorm:"primaryKey" json:"organization_id"`
+	UserID         string    `gorm:"primaryKey" json:"user_id"`
+	Requests       int64     `json:"requests"`
+	RequestTokens  int64     `json:"request_tokens"`
+	ResponseTokens int64     `json:"response_tokens"`
+	ThreadsCreated int64     `json:"threads_created"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// UsageDay returns the day key for the given time
+func UsageDay(t time.Time) string {
+	return t.UTC().Format(UsageDayFormat)
+}
@@ -0,0 +1,177 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestVerdict(t *testing.T) {
+	policy := NewPolicy(string(ActionAllow), map[string]string{
+		"violence":  string(ActionRefuse),
+		"sexual":    string(ActionAnnotate),
+		"self-harm": string(ActionAnnotate),
+	})
+
+	tests := []struct {
+		name       string
+		categories []string
+		want       string
+	}{
+		{name: "nothing flagged", want: VerdictPass},
+		{name: "default action", categories: []string{"hate"}, want: string(ActionAllow)},
+		{name: "annotate over allow", categories: []string{"hate", "sexual"}, want: string(ActionAnnotate)},
+		{name: "refuse over annotate", categories: []string{"sexual", "violence", "self-harm"}, want: string(ActionRefuse)},
+		{name: "refuse before annotate", categories: []string{"violence", "sexual", "hate"}, want: string(ActionRefuse)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := Verdict(tt.categories, policy)
+			if verdict.Action != tt.want {
+				t.Errorf("Verdict() action = %s, want %s", verdict.Action, tt.want)
+			}
+			if !slices.Equal(verdict.Categories, tt.categories) {
+				t.Errorf("Verdict() categories = %q, want %q", verdict.Categories, tt.categories)
+			}
+			if Refused(verdict) != (tt.want == string(ActionRefuse)) {
+				t.Errorf("Refused() = %v for action %s", Refused(verdict), verdict.Action)
+			}
+		})
+	}
+}
+
+// classifierFunc adapts a function to the Classifier interface
+type classifierFunc func(text string) ([]string, error)
+
+func (f classifierFunc) Classify(_ context.Context, text string) ([]string, error) {
+	return f(text)
+}
+
+func TestCheck(t *testing.T) {
+	policy := NewPolicy(string(ActionRefuse), nil)
+	failure := errors.New("moderation service unavailable")
+
+	tests := []struct {
+		name       string
+		classifier Classifier
+		wantAction string
+		wantErr    error
+	}{
+		{name: "moderation disabled"},
+		{
+			name:       "clean text",
+			classifier: classifierFunc(func(string) ([]string, error) { return nil, nil }),
+			wantAction: VerdictPass,
+		},
+		{
+			name:       "flagged text",
+			classifier: classifierFunc(func(string) ([]string, error) { return []string{"hate"}, nil }),
+			wantAction: string(ActionRefuse),
+		},
+		{
+			name:       "classifier failure",
+			classifier: classifierFunc(func(string) ([]string, error) { return nil, failure }),
+			wantErr:    failure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := Check(context.Background(), tt.classifier, "some text", policy)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantAction == "" {
+				if verdict != nil {
+					t.Errorf("Check() verdict = %+v, want nil", verdict)
+				}
+				return
+			}
+			if verdict == nil || verdict.Action != tt.wantAction {
+				t.Errorf("Check() verdict = %+v, want action %s", verdict, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestOpenAICategories(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []openai.Result
+		want    []string
+	}{
+		{name: "no results"},
+		{name: "nothing flagged", results: []openai.Result{{}}},
+		{
+			name:    "categories",
+			results: []openai.Result{{Categories: openai.ResultCategories{Violence: true, Hate: true}}},
+			want:    []string{"hate", "violence"},
+		},
+		{
+			name:    "subcategories count towards their category",
+			results: []openai.Result{{Categories: openai.ResultCategories{SelfHarmIntent: true, SexualMinors: true}}},
+			want:    []string{"self-harm", "sexual"},
+		},
+		{
+			name: "categories flagged in several results are reported once",
+			results: []openai.Result{
+				{Categories: openai.ResultCategories{Harassment: true, HarassmentThreatening: true}},
+				{Categories: openai.ResultCategories{Harassment: true, ViolenceGraphic: true}},
+			},
+			want: []string{"harassment", "violence"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openAICategories(openai.ModerationResponse{Results: tt.results})
+			if err != nil {
+				t.Fatalf("openAICategories() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("openAICategories() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLLMCategories(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		want    []string
+		wantErr string
+	}{
+		{name: "none", answer: `{"categories": []}`},
+		{name: "categories", answer: `{"categories": ["violence", "hate"]}`, want: []string{"hate", "violence"}},
+		{name: "code fence", answer: "```json\n{\"categories\": [\"sexual\"]}\n```", want: []string{"sexual"}},
+		{name: "prose", answer: `Sure! Here is the result: {"categories": ["self-harm"]} Let me know if you need more.`, want: []string{"self-harm"}},
+		{name: "case and spacing", answer: `{"categories": [" Hate ", "HATE"]}`, want: []string{"hate"}},
+		{name: "unknown categories are dropped", answer: `{"categories": ["spam", "violence"]}`, want: []string{"violence"}},
+		{name: "no JSON", answer: "I cannot help with that.", wantErr: "moderation model returned no JSON"},
+		{name: "braces in the wrong order", answer: "} nothing {", wantErr: "moderation model returned no JSON"},
+		{name: "invalid JSON", answer: `{"categories": ["hate"}`, wantErr: "moderation model returned invalid JSON"},
+		{name: "wrong type", answer: `{"categories": "hate"}`, wantErr: "moderation model returned invalid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := llmCategories(tt.answer)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("llmCategories() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("llmCategories() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("llmCategories() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
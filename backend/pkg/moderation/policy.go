@@ -0,0 +1,123 @@
+package moderation
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/pkg/errors"
+)
+
+// Action decides what happens to a message flagged in a category
+type Action string
+
+const (
+	// ActionRefuse withholds the message, queries are not sent to the model and responses are replaced
+	ActionRefuse Action = "refuse"
+	// ActionAnnotate delivers the message together with the verdict
+	ActionAnnotate Action = "annotate"
+	// ActionAllow delivers the message, the verdict is only stored
+	ActionAllow Action = "allow"
+)
+
+// VerdictPass is the action of verdicts without flagged categories
+const VerdictPass = "pass"
+
+// Stages of a query that are moderated
+const (
+	StageInput  = "input"
+	StageOutput = "output"
+)
+
+// WithheldResponse replaces responses refused by the moderation policy
+const WithheldResponse = "This response was withheld by your organization's content policy."
+
+// Policy maps categories to actions. Categories without an entry use the default action.
+type Policy struct {
+	Default   Action
+	Overrides map[string]Action
+}
+
+// NewPolicy combines the deployment-wide default with the overrides stored for an org
+func NewPolicy(defaultAction string, overrides map[string]string) Policy {
+	policy := Policy{Default: Action(defaultAction), Overrides: make(map[string]Action, len(overrides))}
+	for category, action := range overrides {
+		policy.Overrides[category] = Action(action)
+	}
+	return policy
+}
+
+// ActionFor returns the action configured for category
+func (p Policy) ActionFor(category string) Action {
+	if action, ok := p.Overrides[category]; ok {
+		return action
+	}
+	return p.Default
+}
+
+// ValidAction reports whether action is one of the known actions
+func ValidAction(action string) bool {
+	return slices.Contains([]Action{ActionRefuse, ActionAnnotate, ActionAllow}, Action(action))
+}
+
+// ValidatePolicy checks per-org overrides before they are stored. Categories are not restricted,
+// keyword lists may define their own.
+func ValidatePolicy(overrides map[string]string) error {
+	for category, action := range overrides {
+		if strings.TrimSpace(category) == "" {
+			return errors.New("moderation category must not be empty")
+		}
+		if !ValidAction(action) {
+			return errors.Errorf("unknown action %q for %s, expected refuse, annotate or allow", action, category)
+		}
+	}
+	return nil
+}
+
+// Verdict applies policy to the categories flagged by a classifier. The strictest action wins.
+func Verdict(categories []string, policy Policy) *core.ModerationVerdict {
+	verdict := &core.ModerationVerdict{Action: VerdictPass, Categories: categories}
+	for _, category := range categories {
+		switch policy.ActionFor(category) {
+		case ActionRefuse:
+			verdict.Action = string(ActionRefuse)
+		case ActionAnnotate:
+			if verdict.Action != string(ActionRefuse) {
+				verdict.Action = string(ActionAnnotate)
+			}
+		default:
+			if verdict.Action == VerdictPass {
+				verdict.Action = string(ActionAllow)
+			}
+		}
+	}
+	return verdict
+}
+
+// Refused reports whether the verdict withholds the message
+func Refused(verdict *core.ModerationVerdict) bool {
+	return verdict != nil && verdict.Action == string(ActionRefuse)
+}
+
+// RefusedError is returned when a query is refused by the moderation policy
+type RefusedError struct {
+	Categories []string
+}
+
+func (e *RefusedError) Error() string {
+	return "query was refused by the content policy: " + strings.Join(e.Categories, ", ")
+}
+
+// Check classifies text and applies policy. It returns a nil verdict if classifier is nil.
+func Check(ctx context.Context, classifier Classifier, text string, policy Policy) (*core.ModerationVerdict, error) {
+	if classifier == nil {
+		return nil, nil
+	}
+
+	categories, err := classifier.Classify(ctx, text)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to classify content")
+	}
+	return Verdict(categories, policy), nil
+}
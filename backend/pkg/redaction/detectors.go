@@ -0,0 +1,131 @@
+package redaction
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Categories of personal data found by the built-in detectors
+const (
+	CategoryEmail      = "email"
+	CategoryPhone      = "phone"
+	CategoryCreditCard = "credit_card"
+	CategoryNationalID = "national_id"
+)
+
+// Categories lists the categories a policy can configure
+var Categories = []string{CategoryEmail, CategoryPhone, CategoryCreditCard, CategoryNationalID}
+
+// Match is a piece of personal data found in a text, as byte offsets
+type Match struct {
+	Category string
+	Start    int
+	End      int
+}
+
+// Detector finds one kind of personal data. Implement it to plug custom detectors into a pipeline.
+type Detector interface {
+	Category() string
+	Detect(text string) []Match
+}
+
+// RegexDetector reports the matches of a pattern that pass an optional validation, e.g. a checksum
+type RegexDetector struct {
+	category string
+	pattern  *regexp.Regexp
+	valid    func(match string) bool
+}
+
+// NewRegexDetector returns a detector for pattern. valid may be nil to accept every match.
+func NewRegexDetector(category string, pattern *regexp.Regexp, valid func(match string) bool) *RegexDetector {
+	return &RegexDetector{category: category, pattern: pattern, valid: valid}
+}
+
+func (d *RegexDetector) Category() string {
+	return d.category
+}
+
+func (d *RegexDetector) Detect(text string) (matches []Match) {
+	for _, loc := range d.pattern.FindAllStringIndex(text, -1) {
+		if d.valid != nil && !d.valid(text[loc[0]:loc[1]]) {
+			continue
+		}
+		matches = append(matches, Match{Category: d.category, Start: loc[0], End: loc[1]})
+	}
+	return
+}
+
+var (
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	creditCardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	ssnPattern        = regexp.MustCompile(`\b\d{3}([- ])\d{2}([- ])\d{4}\b`)
+	// International numbers in E.164 form, + and country code, optionally grouped by spaces or
+	// hyphens, and North American numbers written as (ddd) ddd-dddd or ddd-ddd-dddd. Bare digit runs
+	// and dotted numbers are left alone, they are mostly IDs, IP addresses and versions.
+	phonePattern = regexp.MustCompile(`\+[1-9](?:[ -]?\d){7,14}\b|\(\d{3}\) ?\d{3}-\d{4}\b|\b\d{3}-\d{3}-\d{4}\b`)
+)
+
+// DefaultDetectors returns the built-in detectors. Checksum-validated detectors come first, they win
+// when matches overlap.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		NewRegexDetector(CategoryCreditCard, creditCardPattern, validCreditCard),
+		NewRegexDetector(CategoryNationalID, ssnPattern, validSSN),
+		NewRegexDetector(CategoryEmail, emailPattern, nil),
+		NewRegexDetector(CategoryPhone, phonePattern, validPhone),
+	}
+}
+
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// validCreditCard checks the length and the Luhn checksum of a card number
+func validCreditCard(match string) bool {
+	number := digits(match)
+	if len(number) < 13 || len(number) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validSSN rejects US social security numbers that are never issued
+func validSSN(match string) bool {
+	groups := ssnPattern.FindStringSubmatch(match)
+	if groups == nil || groups[1] != groups[2] {
+		return false
+	}
+
+	number := digits(match)
+	area, group, serial := number[:3], number[3:5], number[5:]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// validPhone checks the number of digits, E.164 allows at most 15. North American numbers have
+// valid area and exchange codes, they do not start with 0 or 1.
+func validPhone(match string) bool {
+	number := digits(match)
+	if strings.HasPrefix(match, "+") {
+		return len(number) >= 8 && len(number) <= 15
+	}
+	return len(number) == 10 && number[0] >= '2' && number[3] >= '2'
+}
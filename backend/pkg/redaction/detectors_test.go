@@ -0,0 +1,102 @@
+package redaction
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPhoneDetector(t *testing.T) {
+	detector := NewRegexDetector(CategoryPhone, phonePattern, validPhone)
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"E.164", "call +14155550100 today", []string{"+14155550100"}},
+		{"E.164 grouped", "call +44 20 7946 0958 today", []string{"+44 20 7946 0958"}},
+		{"E.164 hyphenated", "call +1-415-555-0100", []string{"+1-415-555-0100"}},
+		{"NANP with parentheses", "call (415) 555-0100", []string{"(415) 555-0100"}},
+		{"NANP hyphenated", "call 415-555-0100.", []string{"415-555-0100"}},
+		{"two numbers", "415-555-0100 or +4930901820", []string{"415-555-0100", "+4930901820"}},
+		{"IPv4 address", "ping 192.168.100.200", nil},
+		{"dotted number", "call 415.555.0100", nil},
+		{"date and hour", "at 2024-01-15 10 UTC", nil},
+		{"version", "upgrade to 10.2.14.1003", nil},
+		{"order number", "order 123456789012 shipped", nil},
+		{"bare digits", "account 4155550100", nil},
+		{"invalid area code", "call 015-555-0100", nil},
+		{"E.164 too short", "+1234567", nil},
+		{"E.164 too long", "+1234567890123456", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, match := range detector.Detect(tt.text) {
+				got = append(got, tt.text[match.Start:match.End])
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectors(t *testing.T) {
+	email := NewRegexDetector(CategoryEmail, emailPattern, nil)
+	creditCard := NewRegexDetector(CategoryCreditCard, creditCardPattern, validCreditCard)
+	ssn := NewRegexDetector(CategoryNationalID, ssnPattern, validSSN)
+
+	tests := []struct {
+		name     string
+		detector Detector
+		text     string
+		want     []string
+	}{
+		{"email", email, "write to jane@acme.example", []string{"jane@acme.example"}},
+		{"email tagged with subdomain", email, "cc jane.doe+chat@mail.acme.co.uk, thanks", []string{"jane.doe+chat@mail.acme.co.uk"}},
+		{"two emails", email, "jane@acme.example and sam@acme.example", []string{"jane@acme.example", "sam@acme.example"}},
+		{"email without domain", email, "user@localhost", nil},
+		{"email without local part", email, "mention @acme.example", nil},
+		{"email with one letter TLD", email, "a@b.c", nil},
+		{"visa", creditCard, "card 4111111111111111 expires", []string{"4111111111111111"}},
+		{"visa grouped", creditCard, "card 4242 4242 4242 4242", []string{"4242 4242 4242 4242"}},
+		{"mastercard hyphenated", creditCard, "card 5555-5555-5555-4444", []string{"5555-5555-5555-4444"}},
+		{"amex", creditCard, "card 378282246310005", []string{"378282246310005"}},
+		{"card with wrong checksum", creditCard, "card 4111111111111112", nil},
+		{"card too short", creditCard, "code 123456789012", nil},
+		{"card too long", creditCard, "id 41111111111111111111", nil},
+		{"SSN hyphenated", ssn, "SSN 123-45-6789", []string{"123-45-6789"}},
+		{"SSN spaced", ssn, "SSN 123 45 6789", []string{"123 45 6789"}},
+		{"SSN mixed separators", ssn, "SSN 123-45 6789", nil},
+		{"SSN area 000", ssn, "SSN 000-45-6789", nil},
+		{"SSN area 666", ssn, "SSN 666-45-6789", nil},
+		{"SSN area 9xx", ssn, "SSN 912-45-6789", nil},
+		{"SSN group 00", ssn, "SSN 123-00-6789", nil},
+		{"SSN serial 0000", ssn, "SSN 123-45-0000", nil},
+		{"SSN unseparated", ssn, "SSN 123456789", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, match := range tt.detector.Detect(tt.text) {
+				if match.Category != tt.detector.Category() {
+					t.Errorf("Detect(%q) reported category %q, want %q", tt.text, match.Category, tt.detector.Category())
+				}
+				got = append(got, tt.text[match.Start:match.End])
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
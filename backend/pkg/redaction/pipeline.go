@@ -0,0 +1,205 @@
+package redaction
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Action decides what happens to a category of personal data found in a prompt
+type Action string
+
+const (
+	// ActionRedact replaces the data with a placeholder before the prompt leaves the backend
+	ActionRedact Action = "redact"
+	// ActionBlock refuses to send the prompt at all
+	ActionBlock Action = "block"
+	// ActionAllow sends the data unchanged
+	ActionAllow Action = "allow"
+)
+
+// Policy maps categories to actions. Categories without an entry use the default action.
+type Policy struct {
+	Default   Action
+	Overrides map[string]Action
+}
+
+// NewPolicy combines the deployment-wide default with the overrides stored for an org
+func NewPolicy(defaultAction string, overrides map[string]string) Policy {
+	policy := Policy{Default: Action(defaultAction), Overrides: make(map[string]Action, len(overrides))}
+	for category, action := range overrides {
+		policy.Overrides[category] = Action(action)
+	}
+	return policy
+}
+
+// ActionFor returns the action configured for category
+func (p Policy) ActionFor(category string) Action {
+	if action, ok := p.Overrides[category]; ok {
+		return action
+	}
+	return p.Default
+}
+
+// ValidAction reports whether action is one of the known actions
+func ValidAction(action string) bool {
+	return slices.Contains([]Action{ActionRedact, ActionBlock, ActionAllow}, Action(action))
+}
+
+// ValidatePolicy checks per-org overrides before they are stored
+func ValidatePolicy(overrides map[string]string) error {
+	for category, action := range overrides {
+		if !slices.Contains(Categories, category) {
+			return errors.Errorf("unknown category %q, expected one of %s", category, strings.Join(Categories, ", "))
+		}
+		if !ValidAction(action) {
+			return errors.Errorf("unknown action %q for %s, expected redact, block or allow", action, category)
+		}
+	}
+	return nil
+}
+
+// BlockedError is returned when the policy blocks a category found in the prompt
+type BlockedError struct {
+	Categories []string
+}
+
+func (e *BlockedError) Error() string {
+	return "prompt contains personal data that may not be sent to the model: " + strings.Join(e.Categories, ", ")
+}
+
+// Result is a redacted text together with what is needed to restore it
+type Result struct {
+	Text string
+	// Redactions counts the replaced values per category
+	Redactions map[string]int
+
+	originals map[string]string
+}
+
+// Count returns the total number of redactions
+func (r Result) Count() (count int) {
+	for _, n := range r.Redactions {
+		count += n
+	}
+	return
+}
+
+// Restore replaces the placeholders in text, usually the model response, with the original values
+func (r Result) Restore(text string) string {
+	if len(r.originals) == 0 {
+		return text
+	}
+
+	pairs := make([]string, 0, 2*len(r.originals))
+	for placeholder, original := range r.originals {
+		pairs = append(pairs, placeholder, original)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Pipeline runs detectors over prompts and applies a policy to what they find
+type Pipeline struct {
+	detectors []Detector
+}
+
+// NewPipeline returns a pipeline running detectors in order. Earlier detectors win overlapping matches.
+func NewPipeline(detectors ...Detector) *Pipeline {
+	return &Pipeline{detectors: detectors}
+}
+
+// Apply redacts text according to policy. Equal values get the same placeholder, so the model can
+// still tell them apart and refer to them. Placeholders carry a nonce of the request, so a placeholder
+// the user typed is not mistaken for one of them. It returns a *BlockedError if a blocked category
+// is found.
+func (p *Pipeline) Apply(text string, policy Policy) (result Result, err error) {
+	result = Result{Text: text, Redactions: make(map[string]int), originals: make(map[string]string)}
+
+	var matches []Match
+	blocked := make(map[string]bool)
+	for _, detector := range p.detectors {
+		action := policy.ActionFor(detector.Category())
+		if action == ActionAllow {
+			continue
+		}
+
+		for _, match := range detector.Detect(text) {
+			if overlaps(matches, match) {
+				continue
+			}
+			if action == ActionBlock {
+				blocked[match.Category] = true
+				continue
+			}
+			matches = append(matches, match)
+		}
+	}
+
+	if len(blocked) > 0 {
+		blockedErr := &BlockedError{}
+		for category := range blocked {
+			blockedErr.Categories = append(blockedErr.Categories, category)
+		}
+		sort.Strings(blockedErr.Categories)
+		return result, blockedErr
+	}
+
+	if len(matches) == 0 {
+		return
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+
+	nonce := newNonce(text)
+	placeholders := make(map[string]string)
+	perCategory := make(map[string]int)
+
+	var redacted strings.Builder
+	last := 0
+	for _, match := range matches {
+		original := text[match.Start:match.End]
+
+		placeholder, ok := placeholders[original]
+		if !ok {
+			perCategory[match.Category]++
+			placeholder = fmt.Sprintf("[%s_%d_%s]", strings.ToUpper(match.Category), perCategory[match.Category], nonce)
+			placeholders[original] = placeholder
+			result.originals[placeholder] = original
+		}
+
+		redacted.WriteString(text[last:match.Start])
+		redacted.WriteString(placeholder)
+		last = match.End
+		result.Redactions[match.Category]++
+	}
+	redacted.WriteString(text[last:])
+
+	result.Text = redacted.String()
+	return
+}
+
+// newNonce returns a random hex string that does not occur in text
+func newNonce(text string) string {
+	b := make([]byte, 4)
+	for {
+		// crypto/rand.Read never fails
+		_, _ = rand.Read(b)
+		if nonce := hex.EncodeToString(b); !strings.Contains(text, nonce) {
+			return nonce
+		}
+	}
+}
+
+func overlaps(matches []Match, match Match) bool {
+	for _, m := range matches {
+		if match.Start < m.End && m.Start < match.End {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package redaction
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var placeholderPattern = regexp.MustCompile(`\[[A-Z_]+_\d+_[0-9a-f]{8}\]`)
+
+func TestApplyAndRestore(t *testing.T) {
+	pipeline := NewPipeline(DefaultDetectors()...)
+	policy := NewPolicy(string(ActionRedact), nil)
+
+	tests := []struct {
+		name             string
+		text             string
+		wantRedactions   map[string]int
+		wantPlaceholders int
+	}{
+		{
+			name:             "nothing to redact",
+			text:             "What is the refund policy?",
+			wantRedactions:   map[string]int{},
+			wantPlaceholders: 0,
+		},
+		{
+			name:             "two categories",
+			text:             "Mail jane@acme.example or call 415-555-0100",
+			wantRedactions:   map[string]int{CategoryEmail: 1, CategoryPhone: 1},
+			wantPlaceholders: 2,
+		},
+		{
+			name:             "equal values share a placeholder",
+			text:             "jane@acme.example wrote to sam@acme.example, then jane@acme.example again",
+			wantRedactions:   map[string]int{CategoryEmail: 3},
+			wantPlaceholders: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := pipeline.Apply(tt.text, policy)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			for category, count := range tt.wantRedactions {
+				if result.Redactions[category] != count {
+					t.Errorf("Redactions[%s] = %d, want %d", category, result.Redactions[category], count)
+				}
+			}
+			placeholders := placeholderPattern.FindAllString(result.Text, -1)
+			slices.Sort(placeholders)
+			if got := len(slices.Compact(placeholders)); got != tt.wantPlaceholders {
+				t.Errorf("Apply() text %q has %d distinct placeholders, want %d", result.Text, got, tt.wantPlaceholders)
+			}
+			for _, value := range []string{"jane@acme.example", "415-555-0100"} {
+				if strings.Contains(result.Text, value) {
+					t.Errorf("Apply() text %q still contains %q", result.Text, value)
+				}
+			}
+
+			if restored := result.Restore(result.Text); restored != tt.text {
+				t.Errorf("Restore() = %q, want %q", restored, tt.text)
+			}
+		})
+	}
+}
+
+func TestRestoreIgnoresTypedPlaceholders(t *testing.T) {
+	pipeline := NewPipeline(DefaultDetectors()...)
+	text := "My address is jane@acme.example, what does [EMAIL_1] mean?"
+
+	result, err := pipeline.Apply(text, NewPolicy(string(ActionRedact), nil))
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !strings.Contains(result.Text, "[EMAIL_1]") {
+		t.Fatalf("Apply() text %q lost the typed placeholder", result.Text)
+	}
+
+	// The model echoes the typed placeholder as well as the real one
+	response := "[EMAIL_1] is a placeholder. " + placeholderPattern.FindString(result.Text) + " is your address."
+	want := "[EMAIL_1] is a placeholder. jane@acme.example is your address."
+	if restored := result.Restore(response); restored != want {
+		t.Errorf("Restore() = %q, want %q", restored, want)
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	pipeline := NewPipeline(DefaultDetectors()...)
+	text := "Mail jane@acme.example, card 4111 1111 1111 1111"
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		wantBlocked []string
+		wantText    func(text string) bool
+	}{
+		{
+			name:        "blocked category",
+			policy:      NewPolicy(string(ActionRedact), map[string]string{CategoryCreditCard: string(ActionBlock)}),
+			wantBlocked: []string{CategoryCreditCard},
+		},
+		{
+			name:        "every category blocked",
+			policy:      NewPolicy(string(ActionBlock), nil),
+			wantBlocked: []string{CategoryCreditCard, CategoryEmail},
+		},
+		{
+			name:   "allow-listed category",
+			policy: NewPolicy(string(ActionRedact), map[string]string{CategoryEmail: string(ActionAllow)}),
+			wantText: func(redacted string) bool {
+				return strings.Contains(redacted, "jane@acme.example") && !strings.Contains(redacted, "4111 1111 1111 1111")
+			},
+		},
+		{
+			name:   "allowed by default",
+			policy: NewPolicy(string(ActionAllow), nil),
+			wantText: func(redacted string) bool {
+				return redacted == text
+			},
+		},
+		{
+			name:   "allow-listed category is not blocked",
+			policy: NewPolicy(string(ActionBlock), map[string]string{CategoryEmail: string(ActionAllow), CategoryCreditCard: string(ActionRedact)}),
+			wantText: func(redacted string) bool {
+				return strings.Contains(redacted, "jane@acme.example") && !strings.Contains(redacted, "4111")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := pipeline.Apply(text, tt.policy)
+
+			var blockedErr *BlockedError
+			if tt.wantBlocked != nil {
+				if !errors.As(err, &blockedErr) {
+					t.Fatalf("Apply() error = %v, want a *BlockedError", err)
+				}
+				if !slices.Equal(blockedErr.Categories, tt.wantBlocked) {
+					t.Errorf("blocked categories = %q, want %q", blockedErr.Categories, tt.wantBlocked)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !tt.wantText(result.Text) {
+				t.Errorf("Apply() text = %q", result.Text)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of purged rows, used as metric label
+const (
+	KindMessages = "messages"
+	KindThreads  = "threads"
+	KindShares   = "shares"
+)
+
+// Purger enforces the retention policies of all orgs
+type Purger struct {
+	store     *store.Store
+	metrics   *metrics.Metrics
+	batchSize int
+}
+
+func NewPurger(dataStore *store.Store, metricsService *metrics.Metrics, batchSize int) *Purger {
+	return &Purger{store: dataStore, metrics: metricsService, batchSize: batchSize}
+}
+
+// Run purges everything that is past its org's retention period. It deletes in batches, so it can be
+// stopped at any time and picks up where it left off on the next run.
+func (p *Purger) Run(ctx context.Context) error {
+	orgs, err := p.store.OrgSettings.ListWithRetention(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list retention policies")
+	}
+
+	var failed error
+	for _, settings := range orgs {
+		if err = p.purgeOrg(ctx, settings); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// One org failing must not keep the others from being purged
+			log.Ctx(ctx).Error().Err(err).Str("org_id", settings.OrgID).Msg("failed to enforce retention policy")
+			failed = errors.Wrapf(err, "failed to enforce the retention policy of org %s", settings.OrgID)
+		}
+	}
+	return failed
+}
+
+func (p *Purger) purgeOrg(ctx context.Context, settings tenant.OrgSettings) error {
+	now := time.Now()
+	purged := make(map[string]int64)
+
+	if settings.ThreadRetentionDays > 0 {
+		before := now.AddDate(0, 0, -settings.ThreadRetentionDays)
+		if err := p.purge(ctx, settings.OrgID, KindThreads, purged, func() (int64, error) {
+			return p.store.Threads.PurgeInactive(ctx, settings.OrgID, before, p.batchSize)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if settings.MessageRetentionDays > 0 {
+		before := now.AddDate(0, 0, -settings.MessageRetentionDays)
+		if err := p.purge(ctx, settings.OrgID, KindMessages, purged, func() (int64, error) {
+			return p.store.Messages.PurgeOlderThan(ctx, settings.OrgID, before, p.batchSize)
+		}); err != nil {
+			return err
+		}
+
+		// Shares are snapshots of the messages, they go once they are as old as the messages
+		if err := p.purge(ctx, settings.OrgID, KindShares, purged, func() (int64, error) {
+			return p.store.Shares.PurgeCreatedBefore(ctx, settings.OrgID, before, p.batchSize)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(purged) > 0 {
+		log.Ctx(ctx).Info().
+			Str("org_id", settings.OrgID).
+			Int64("threads", purged[KindThreads]).
+			Int64("messages", purged[KindMessages]).
+			Int64("shares", purged[KindShares]).
+			Msg("purged data past its retention period")
+	}
+	return nil
+}
+
+// purge runs batches until one deletes less than a full batch
+func (p *Purger) purge(ctx context.Context, orgID string, kind string, purged map[string]int64, batch func() (int64, error)) error {
+	for ctx.Err() == nil {
+		deleted, err := batch()
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge %s", kind)
+		}
+
+		if deleted > 0 {
+			purged[kind] += deleted
+			p.metrics.AddRetentionPurged(orgID, kind, deleted)
+		}
+
+		if deleted < int64(p.batchSize) {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
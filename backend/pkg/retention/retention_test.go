@@ -0,0 +1,123 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"github.com/omnistrate-community/ai-chatbot/pkg/metrics"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/omnistrate-community/ai-chatbot/pkg/store/storetest"
+)
+
+func TestPurgerRespectsLegalHold(t *testing.T) {
+	ctx := context.Background()
+	handle := dbtest.Open(t)
+	dataStore := storetest.New(handle)
+	now := time.Now()
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	for _, user := range []tenant.User{
+		{ID: "user-1", Email: "jane@acme.example", OrgID: "org-1"},
+		{ID: "user-2", Email: "sam@other.example", OrgID: "org-2"},
+	} {
+		if err := dataStore.Orgs.Save(ctx, &tenant.Org{ID: user.OrgID}); err != nil {
+			t.Fatalf("failed to store org: %v", err)
+		}
+		if err := dataStore.Users.Save(ctx, &user); err != nil {
+			t.Fatalf("failed to store user: %v", err)
+		}
+	}
+	// Only org-1 has a retention policy
+	if err := dataStore.OrgSettings.Save(ctx, &tenant.OrgSettings{OrgID: "org-1", ThreadRetentionDays: 30, MessageRetentionDays: 7}); err != nil {
+		t.Fatalf("failed to save org settings: %v", err)
+	}
+
+	threads := []struct {
+		thread   core.Thread
+		orgID    string
+		messages map[string]int // message ID to age in days
+		share    int            // age in days of a share of the thread, 0 for none
+	}{
+		{core.Thread{ID: "inactive", UserID: "user-1"}, "org-1", map[string]int{"inactive-1": 60, "inactive-2": 59}, 59},
+		{core.Thread{ID: "held", UserID: "user-1", LegalHold: true}, "org-1", map[string]int{"held-1": 60, "held-2": 59}, 59},
+		{core.Thread{ID: "active", UserID: "user-1"}, "org-1", map[string]int{"active-1": 40, "active-2": 10, "active-3": 1}, 10},
+		{core.Thread{ID: "other-org", UserID: "user-2"}, "org-2", map[string]int{"other-org-1": 60}, 59},
+	}
+	for _, tt := range threads {
+		thread := tt.thread
+		thread.CreatedAt, thread.UpdatedAt = daysAgo(60), daysAgo(40)
+
+		var messages []core.Message
+		for id, age := range tt.messages {
+			messages = append(messages, core.Message{MessageID: id, ThreadID: thread.ID, CreatedAt: daysAgo(age), MessageType: core.MessageTypeQuery, Content: id})
+		}
+		if err := dataStore.Threads.CreateWithMessages(ctx, &thread, messages); err != nil {
+			t.Fatalf("failed to create thread: %v", err)
+		}
+		// Keep the last activity in the past, saving the thread counts as activity
+		if err := handle.Model(&core.Thread{}).Where("id = ?", thread.ID).UpdateColumn("updated_at", daysAgo(40)).Error; err != nil {
+			t.Fatalf("failed to backdate thread: %v", err)
+		}
+
+		if tt.share > 0 {
+			share := core.ThreadShare{ID: thread.ID, TokenHash: thread.ID, ThreadID: thread.ID, UserID: thread.UserID, OrgID: tt.orgID, CreatedAt: daysAgo(tt.share)}
+			if err := handle.Create(&share).Error; err != nil {
+				t.Fatalf("failed to create share: %v", err)
+			}
+		}
+	}
+
+	// Small batches, so purging takes more than one
+	if err := NewPurger(dataStore, metrics.NewMetrics(), 1).Run(ctx); err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+
+	tests := []struct {
+		thread       string
+		userID       string
+		wantThread   bool
+		wantMessages []string
+		wantShare    bool
+	}{
+		{thread: "inactive", userID: "user-1", wantThread: false},
+		{thread: "held", userID: "user-1", wantThread: true, wantMessages: []string{"held-1", "held-2"}, wantShare: true},
+		{thread: "active", userID: "user-1", wantThread: true, wantMessages: []string{"active-3"}, wantShare: false},
+		{thread: "other-org", userID: "user-2", wantThread: true, wantMessages: []string{"other-org-1"}, wantShare: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.thread, func(t *testing.T) {
+			_, err := dataStore.Threads.Get(ctx, tt.thread, tt.userID)
+			if tt.wantThread && err != nil {
+				t.Errorf("thread was purged: %v", err)
+			} else if !tt.wantThread && !errors.Is(err, model.ErrNotFound) {
+				t.Errorf("thread was kept: %v", err)
+			}
+
+			messages, err := dataStore.Messages.ListForThread(ctx, tt.thread)
+			if err != nil {
+				t.Fatalf("failed to list messages: %v", err)
+			}
+			var ids []string
+			for _, message := range messages {
+				ids = append(ids, message.MessageID)
+			}
+			if !slices.Equal(ids, tt.wantMessages) {
+				t.Errorf("messages = %q, want %q", ids, tt.wantMessages)
+			}
+
+			var shares int64
+			if err = handle.Model(&core.ThreadShare{}).Where("thread_id = ?", tt.thread).Count(&shares).Error; err != nil {
+				t.Fatalf("failed to count shares: %v", err)
+			}
+			if (shares > 0) != tt.wantShare {
+				t.Errorf("share kept = %t, want %t", shares > 0, tt.wantShare)
+			}
+		})
+	}
+}
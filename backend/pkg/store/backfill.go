@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/encryption"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const backfillBatchSize = 500
+
+// BackfillResult counts the rows encrypted by EncryptExisting
+type BackfillResult struct {
+	Threads  int `json:"threads"`
+	Messages int `json:"messages"`
+	Shares   int `json:"shares"`
+}
+
+type plaintextRow struct {
+	ID    string
+	Value string
+	OrgID string
+}
+
+// EncryptExisting encrypts thread names, message content and shares that were stored before
+// encryption was enabled. Encrypted rows are skipped, so it can be interrupted and run again.
+func EncryptExisting(ctx context.Context, db *gorm.DB, keyring *encryption.Keyring) (result BackfillResult, err error) {
+	if !keyring.Enabled() {
+		return result, errors.New("encryption is not configured")
+	}
+
+	db = db.WithContext(ctx)
+
+	if result.Threads, err = encryptColumn(ctx, keyring,
+		func(rows *[]plaintextRow) error {
+			return db.Table("threads").
+				Select("threads.id AS id, threads.name AS value, users.org_id AS org_id").
+				Joins("JOIN users ON users.id = threads.user_id").
+				Where("threads.name <> '' AND threads.name NOT LIKE ?", "enc:v1:%").
+				Order("threads.id").Limit(backfillBatchSize).Scan(rows).Error
+		},
+		func(id string, value string) error {
+			return db.Table("threads").Where("id = ?", id).Update("name", value).Error
+		},
+	); err != nil {
+		return result, errors.Wrap(err, "failed to encrypt thread names")
+	}
+
+	if result.Messages, err = encryptColumn(ctx, keyring,
+		func(rows *[]plaintextRow) error {
+			return db.Table("messages").
+				Select("messages.message_id AS id, messages.content AS value, users.org_id AS org_id").
+				Joins("JOIN threads ON threads.id = messages.thread_id").
+				Joins("JOIN users ON users.id = threads.user_id").
+				Where("messages.content <> '' AND messages.content NOT LIKE ?", "enc:v1:%").
+				Order("messages.message_id").Limit(backfillBatchSize).Scan(rows).Error
+		},
+		func(id string, value string) error {
+			return db.Table("messages").Where("message_id = ?", id).Update("content", value).Error
+		},
+	); err != nil {
+		return result, errors.Wrap(err, "failed to encrypt messages")
+	}
+
+	if result.Shares, err = encryptShares(ctx, db, keyring); err != nil {
+		return result, errors.Wrap(err, "failed to encrypt shares")
+	}
+
+	return
+}
+
+// encryptColumn encrypts batches of plaintext rows until none are left. Encrypted rows no longer
+// match the query, so every batch makes progress.
+func encryptColumn(
+	ctx context.Context,
+	keyring *encryption.Keyring,
+	next func(rows *[]plaintextRow) error,
+	update func(id string, value string) error,
+) (encrypted int, err error) {
+	for {
+		var rows []plaintextRow
+		if err = next(&rows); err != nil || len(rows) == 0 {
+			return
+		}
+
+		for _, row := range rows {
+			var value string
+			if value, err = keyring.Encrypt(ctx, row.OrgID, row.Value); err != nil {
+				return encrypted, errors.Wrapf(err, "failed to encrypt %s", row.ID)
+			}
+
+			if err = update(row.ID, value); err != nil {
+				return
+			}
+			encrypted++
+		}
+	}
+}
+
+// encryptShares walks all shares, the snapshot is a JSON document and cannot be filtered in SQL
+func encryptShares(ctx context.Context, db *gorm.DB, keyring *encryption.Keyring) (encrypted int, err error) {
+	lastID := ""
+	for {
+		var shares []core.ThreadShare
+		if err = db.Where("id > ?", lastID).Order("id").Limit(backfillBatchSize).Find(&shares).Error; err != nil || len(shares) == 0 {
+			return
+		}
+
+		for _, share := range shares {
+			lastID = share.ID
+
+			changed := false
+			if share.ThreadName != "" && !encryption.IsEncrypted(share.ThreadName) {
+				if share.ThreadName, err = keyring.Encrypt(ctx, share.OrgID, share.ThreadName); err != nil {
+					return
+				}
+				changed = true
+			}
+
+			for i, message := range share.Messages {
+				if message.Content != "" && !encryption.IsEncrypted(message.Content) {
+					if share.Messages[i].Content, err = keyring.Encrypt(ctx, share.OrgID, message.Content); err != nil {
+						return
+					}
+					changed = true
+				}
+			}
+
+			if !changed {
+				continue
+			}
+
+			if err = db.Model(&share).Select("thread_name", "messages").Updates(&share).Error; err != nil {
+				return
+			}
+			encrypted++
+		}
+	}
+}
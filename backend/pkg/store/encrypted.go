@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/encryption"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/pkg/errors"
+)
+
+// WithEncryption wraps the thread, message and share repositories so message content and thread
+// names are encrypted before they are written and decrypted after they are read. Callers only ever
+// see plaintext.
+func (s *Store) WithEncryption(keyring *encryption.Keyring) *Store {
+	encrypted := *s
+	encrypted.Threads = &encryptedThreadRepository{ThreadRepository: s.Threads, keyring: keyring}
+	encrypted.Messages = &encryptedMessageRepository{MessageRepository: s.Messages, keyring: keyring}
+	encrypted.Shares = &encryptedShareRepository{ShareRepository: s.Shares, keyring: keyring}
+	return &encrypted
+}
+
+type encryptedThreadRepository struct {
+	core.ThreadRepository
+	keyring *encryption.Keyring
+}
+
+func (r *encryptedThreadRepository) Save(ctx context.Context, thread *core.Thread) (err error) {
+	stored := *thread
+	if stored.Name, err = r.keyring.Encrypt(ctx, thread.User.OrgID, thread.Name); err != nil {
+		return errors.Wrap(err, "failed to encrypt thread name")
+	}
+
+	if err = r.ThreadRepository.Save(ctx, &stored); err != nil {
+		return
+	}
+
+	// Pick up the timestamps set while saving
+	stored.Name = thread.Name
+	*thread = stored
+	return
+}
+
+func (r *encryptedThreadRepository) Get(ctx context.Context, threadID string, userID string) (thread core.Thread, err error) {
+	if thread, err = r.ThreadRepository.Get(ctx, threadID, userID); err != nil {
+		return
+	}
+
+	err = r.decryptThread(ctx, &thread)
+	return
+}
+
+func (r *encryptedThreadRepository) ListForUser(ctx context.Context, userID string) (threads []core.Thread, err error) {
+	if threads, err = r.ThreadRepository.ListForUser(ctx, userID); err != nil {
+		return
+	}
+
+	for i := range threads {
+		if err = r.decryptThread(ctx, &threads[i]); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func (r *encryptedThreadRepository) CreateWithMessages(ctx context.Context, thread *core.Thread, messages []core.Message) (err error) {
+	orgID := thread.User.OrgID
+
+	stored := *thread
+	if stored.Name, err = r.keyring.Encrypt(ctx, orgID, thread.Name); err != nil {
+		return errors.Wrap(err, "failed to encrypt thread name")
+	}
+
+	storedMessages := make([]core.Message, len(messages))
+	for i, message := range messages {
+		storedMessages[i] = message
+		if storedMessages[i].Content, err = r.keyring.Encrypt(ctx, orgID, message.Content); err != nil {
+			return errors.Wrap(err, "failed to encrypt message")
+		}
+	}
+
+	if err = r.ThreadRepository.CreateWithMessages(ctx, &stored, storedMessages); err != nil {
+		return
+	}
+
+	stored.Name = thread.Name
+	*thread = stored
+	return
+}
+
+func (r *encryptedThreadRepository) decryptThread(ctx context.Context, thread *core.Thread) (err error) {
+	if thread.Name, err = r.keyring.Decrypt(ctx, thread.Name); err != nil {
+		err = errors.Wrapf(err, "failed to decrypt name of thread %s", thread.ID)
+	}
+	return
+}
+
+type encryptedMessageRepository struct {
+	core.MessageRepository
+	keyring *encryption.Keyring
+}
+
+func (r *encryptedMessageRepository) Save(ctx context.Context, message *core.Message) (err error) {
+	stored := *message
+	if stored.Content, err = r.keyring.Encrypt(ctx, message.Thread.User.OrgID, message.Content); err != nil {
+		return errors.Wrap(err, "failed to encrypt message")
+	}
+
+	if err = r.MessageRepository.Save(ctx, &stored); err != nil {
+		return
+	}
+
+	stored.Content = message.Content
+	*message = stored
+	return
+}
+
+func (r *encryptedMessageRepository) ListForThread(ctx context.Context, threadID string) (messages []core.Message, err error) {
+	if messages, err = r.MessageRepository.ListForThread(ctx, threadID); err != nil {
+		return
+	}
+
+	for i := range messages {
+		if messages[i].Content, err = r.keyring.Decrypt(ctx, messages[i].Content); err != nil {
+			return nil, errors.Wrapf(err, "failed to decrypt message %s", messages[i].MessageID)
+		}
+	}
+	return
+}
+
+type encryptedShareRepository struct {
+	core.ShareRepository
+	keyring *encryption.Keyring
+}
+
+func (r *encryptedShareRepository) Save(ctx context.Context, share *core.ThreadShare) (err error) {
+	stored := *share
+	if stored.ThreadName, err = r.keyring.Encrypt(ctx, share.OrgID, share.ThreadName); err != nil {
+		return errors.Wrap(err, "failed to encrypt shared thread name")
+	}
+
+	stored.Messages = make([]core.SharedMessage, len(share.Messages))
+	for i, message := range share.Messages {
+		stored.Messages[i] = message
+		if stored.Messages[i].Content, err = r.keyring.Encrypt(ctx, share.OrgID, message.Content); err != nil {
+			return errors.Wrap(err, "failed to encrypt shared message")
+		}
+	}
+
+	if err = r.ShareRepository.Save(ctx, &stored); err != nil {
+		return
+	}
+
+	stored.ThreadName = share.ThreadName
+	stored.Messages = share.Messages
+	*share = stored
+	return
+}
+
+func (r *encryptedShareRepository) Get(ctx context.Context, shareID string, threadID string, userID string) (share core.ThreadShare, err error) {
+	if share, err = r.ShareRepository.Get(ctx, shareID, threadID, userID); err != nil {
+		return
+	}
+
+	err = r.decryptShare(ctx, &share)
+	return
+}
+
+func (r *encryptedShareRepository) GetByTokenHash(ctx context.Context, tokenHash string) (share core.ThreadShare, err error) {
+	if share, err = r.ShareRepository.GetByTokenHash(ctx, tokenHash); err != nil {
+		return
+	}
+
+	err = r.decryptShare(ctx, &share)
+	return
+}
+
+func (r *encryptedShareRepository) ListForThread(ctx context.Context, threadID string, userID string) (shares []core.ThreadShare, err error) {
+	if shares, err = r.ShareRepository.ListForThread(ctx, threadID, userID); err != nil {
+		return
+	}
+
+	for i := range shares {
+		if err = r.decryptShare(ctx, &shares[i]); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func (r *encryptedShareRepository) ListForUser(ctx context.Context, userID string) (shares []core.ThreadShare, err error) {
+	if shares, err = r.ShareRepository.ListForUser(ctx, userID); err != nil {
+		return
+	}
+
+	for i := range shares {
+		if err = r.decryptShare(ctx, &shares[i]); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func (r *encryptedShareRepository) decryptShare(ctx context.Context, share *core.ThreadShare) (err error) {
+	if share.ThreadName, err = r.keyring.Decrypt(ctx, share.ThreadName); err != nil {
+		return errors.Wrapf(err, "failed to decrypt share %s", share.ID)
+	}
+
+	for i := range share.Messages {
+		if share.Messages[i].Content, err = r.keyring.Decrypt(ctx, share.Messages[i].Content); err != nil {
+			return errors.Wrapf(err, "failed to decrypt share %s", share.ID)
+		}
+	}
+	return
+}
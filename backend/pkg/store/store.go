@@ -0,0 +1,40 @@
+package store
+
+import (
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/core"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"gorm.io/gorm"
+)
+
+// Store bundles the repositories handed to the API handlers
+type Store struct {
+	Threads     core.ThreadRepository
+	Messages    core.MessageRepository
+	Shares      core.ShareRepository
+	Users       tenant.UserRepository
+	Orgs        tenant.OrgRepository
+	Signups     tenant.PendingSignupRepository
+	OrgSettings tenant.OrgSettingsRepository
+	Usage       tenant.UsageRepository
+	DataKeys    tenant.DataKeyRepository
+	Audit       tenant.AuditRepository
+	Credentials tenant.CredentialRepository
+}
+
+// NewGormStore returns a store backed by GORM. The same implementation serves every dialect
+// supported by pkg/db. List queries go through reader, which may return a read replica.
+func NewGormStore(db *gorm.DB, reader func() *gorm.DB) *Store {
+	return &Store{
+		Threads:     core.NewGormThreadRepository(db, reader),
+		Messages:    core.NewGormMessageRepository(db),
+		Shares:      core.NewGormShareRepository(db, reader),
+		Users:       tenant.NewGormUserRepository(db),
+		Orgs:        tenant.NewGormOrgRepository(db),
+		Signups:     tenant.NewGormPendingSignupRepository(db),
+		OrgSettings: tenant.NewGormOrgSettingsRepository(db),
+		Usage:       tenant.NewGormUsageRepository(db, reader),
+		DataKeys:    tenant.NewGormDataKeyRepository(db),
+		Audit:       tenant.NewGormAuditRepository(db, reader),
+		Credentials: tenant.NewGormCredentialRepository(db),
+	}
+}
@@ -0,0 +1,13 @@
+// Package storetest provides stores for tests. It is separate from dbtest because the store
+// depends on packages whose tests use dbtest.
+package storetest
+
+import (
+	"github.com/omnistrate-community/ai-chatbot/pkg/store"
+	"gorm.io/gorm"
+)
+
+// New returns a store backed by handle, which also serves the reads that would go to a replica
+func New(handle *gorm.DB) *store.Store {
+	return store.NewGormStore(handle, func() *gorm.DB { return handle })
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"strings"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"github.com/pkg/errors"
+)
+
+// SyncUser upserts the local copy of a user and their org as described by Omnistrate. Fields
+// Omnistrate does not return, like the legal company name, keep their stored values or are taken
+// from the pending signup of the user.
+func (s *Store) SyncUser(ctx context.Context, user tenant.User) error {
+	org := user.Org
+	org.ID = user.OrgID
+	if org.LegalCompanyName == "" {
+		stored, err := s.Orgs.Get(ctx, org.ID)
+		if err != nil && !errors.Is(err, model.ErrNotFound) {
+			return errors.Wrap(err, "failed to get org")
+		}
+		org.LegalCompanyName = stored.LegalCompanyName
+	}
+
+	// Users who had to verify their email first sign in without the org stored yet
+	if org.LegalCompanyName == "" && user.Email != "" {
+		signup, err := s.Signups.Take(ctx, strings.ToLower(user.Email))
+		if err != nil && !errors.Is(err, model.ErrNotFound) {
+			return errors.Wrap(err, "failed to get pending signup")
+		}
+		org.LegalCompanyName = signup.LegalCompanyName
+	}
+
+	if err := s.Orgs.Save(ctx, &org); err != nil {
+		return errors.Wrap(err, "failed to save org")
+	}
+
+	user.Org = org
+	if err := s.Users.Save(ctx, &user); err != nil {
+		return errors.Wrap(err, "failed to save user")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/db/dbtest"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model"
+	"github.com/omnistrate-community/ai-chatbot/pkg/model/tenant"
+	"gorm.io/gorm"
+)
+
+func TestSyncUser(t *testing.T) {
+	ctx := context.Background()
+	handle := dbtest.Open(t)
+	dataStore := NewGormStore(handle, func() *gorm.DB { return handle })
+
+	// The signup stored the legal company name, which Omnistrate does not return
+	if err := dataStore.Orgs.Save(ctx, &tenant.Org{ID: "org-1", Name: "Acme", LegalCompanyName: "Acme Corporation"}); err != nil {
+		t.Fatalf("failed to store org: %v", err)
+	}
+
+	// Users who verify their email first are stored on their first sign-in
+	if err := dataStore.Signups.Save(ctx, &tenant.PendingSignup{Email: "kim@signup.example", LegalCompanyName: "Signup Ltd."}); err != nil {
+		t.Fatalf("failed to store pending signup: %v", err)
+	}
+
+	steps := []struct {
+		name          string
+		user          tenant.User
+		wantOrgName   string
+		wantLegalName string
+	}{
+		{
+			name: "new user",
+			user: tenant.User{
+				ID: "user-1", Email: "jane@acme.example", Name: "Jane", OrgID: "org-1", Role: tenant.RoleAdmin,
+				Org: tenant.Org{Name: "Acme", WebsiteURL: "https://acme.example"},
+			},
+			wantOrgName:   "Acme",
+			wantLegalName: "Acme Corporation",
+		},
+		{
+			name: "changed in Omnistrate",
+			user: tenant.User{
+				ID: "user-1", Email: "jane@acme.example", Name: "Jane Doe", OrgID: "org-1", Role: tenant.RoleEditor,
+				Org: tenant.Org{Name: "Acme Labs"},
+			},
+			wantOrgName:   "Acme Labs",
+			wantLegalName: "Acme Corporation",
+		},
+		{
+			name: "legal name returned",
+			user: tenant.User{
+				ID: "user-1", Email: "jane@acme.example", Name: "Jane Doe", OrgID: "org-1", Role: tenant.RoleEditor,
+				Org: tenant.Org{Name: "Acme Labs", LegalCompanyName: "Acme Labs Inc."},
+			},
+			wantOrgName:   "Acme Labs",
+			wantLegalName: "Acme Labs Inc.",
+		},
+		{
+			name: "new org",
+			user: tenant.User{
+				ID: "user-2", Email: "sam@other.example", OrgID: "org-2", Role: tenant.RoleRoot,
+				Org: tenant.Org{Name: "Other"},
+			},
+			wantOrgName: "Other",
+		},
+		{
+			name: "verified signup",
+			user: tenant.User{
+				ID: "user-3", Email: "Kim@Signup.example", OrgID: "org-3", Role: tenant.RoleRoot,
+				Org: tenant.Org{Name: "Signup"},
+			},
+			wantOrgName:   "Signup",
+			wantLegalName: "Signup Ltd.",
+		},
+	}
+	for _, step := range steps {
+		if err := dataStore.SyncUser(ctx, step.user); err != nil {
+			t.Fatalf("%s: SyncUser() error = %v", step.name, err)
+		}
+
+		user, err := dataStore.Users.Get(ctx, step.user.ID)
+		if err != nil {
+			t.Fatalf("%s: failed to get user: %v", step.name, err)
+		}
+		if user.Email != step.user.Email || user.Name != step.user.Name || user.OrgID != step.user.OrgID || user.Role != step.user.Role {
+			t.Errorf("%s: stored user = %+v, want %+v", step.name, user, step.user)
+		}
+
+		org, err := dataStore.Orgs.Get(ctx, step.user.OrgID)
+		if err != nil {
+			t.Fatalf("%s: failed to get org: %v", step.name, err)
+		}
+		if org.Name != step.wantOrgName || org.LegalCompanyName != step.wantLegalName || org.WebsiteURL != step.user.Org.WebsiteURL {
+			t.Errorf("%s: stored org = %+v, want name %q, legal name %q and website %q", step.name, org, step.wantOrgName, step.wantLegalName, step.user.Org.WebsiteURL)
+		}
+	}
+
+	if _, err := dataStore.Signups.Take(ctx, "kim@signup.example"); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("Take() of a consumed signup error = %v, want %v", err, model.ErrNotFound)
+	}
+}
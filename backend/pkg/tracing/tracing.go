@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/omnistrate-community/ai-chatbot"
+
+// ServiceName is reported on every span, OTEL_SERVICE_NAME overrides it
+var ServiceName = "ai-chatbot-backend"
+
+// Enabled reports whether an OTLP endpoint is configured. Without one tracing is a no-op.
+func Enabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Init installs the global tracer provider and the W3C trace context propagator. The exporter is
+// configured through the standard OTEL_EXPORTER_OTLP_* environment variables. The returned function
+// flushes and stops the exporter.
+func Init(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	shutdown = func(context.Context) error { return nil }
+
+	// Always propagate, so trace context from the frontend reaches upstream calls even if we do not export
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !Enabled() {
+		return
+	}
+
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		ServiceName = name
+	}
+
+	var exporter *otlptrace.Exporter
+	if exporter, err = otlptracehttp.New(ctx); err != nil {
+		return
+	}
+
+	var res *resource.Resource
+	if res, err = resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+	)); err != nil {
+		return
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	shutdown = provider.Shutdown
+	return
+}
+
+// Start starts a span with the application tracer
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
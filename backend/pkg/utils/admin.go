@@ -2,13 +2,27 @@ package utils
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/omnistrate-community/ai-chatbot/pkg/tracing"
 	openapiclientfleetv1 "github.com/omnistrate-oss/omnistrate-sdk-go/fleet"
 	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
 	"github.com/rs/zerolog/log"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	// Tokens are replaced this long before they expire, so no call is made with an expiring token
+	adminTokenRefreshMargin = 5 * time.Minute
+	// Assumed lifetime of tokens without an expiry claim
+	adminTokenDefaultLifetime = time.Hour
+	// A token rejected this soon after signing in is not the problem, it is not replaced again
+	adminTokenMinAge = time.Minute
 )
 
 // OmnistrateUsername is the username for the service account used for managing your service on https://omnistrate.cloud
@@ -16,27 +30,69 @@ var initSync sync.Once
 var adminContext *OmnistrateServiceAdmin
 
 type OmnistrateServiceAdmin struct {
-	jwtToken string // service owner token
 	username string
 	password string
+
+	// mu guards the service owner token, holding it while signing in lets one request refresh the
+	// token while the others wait for it
+	mu        sync.Mutex
+	jwtToken  string
+	expiresAt time.Time
+	issuedAt  time.Time
 }
 
 func OmnistrateServiceAdminInstance() *OmnistrateServiceAdmin {
 	initSync.Do(func() {
 		adminContext = &OmnistrateServiceAdmin{
-			username: config.OmnistrateUsername,
-			password: config.OmnistratePassword,
+			username: config.Current.Omnistrate.Username,
+			password: config.Current.Omnistrate.Password,
 		}
 	})
 	return adminContext
 }
 
+// Authenticate makes sure the service account holds a token that stays valid for a while
 func (o *OmnistrateServiceAdmin) Authenticate(ctx context.Context) (err error) {
-	// Validate existing token
-	if o.jwtToken != "" {
-		return
+	_, err = o.token(ctx)
+	return
+}
+
+// token returns the current token, signing in again if there is none or it is about to expire
+func (o *OmnistrateServiceAdmin) token(ctx context.Context) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.jwtToken != "" && time.Until(o.expiresAt) > adminTokenRefreshMargin {
+		return o.jwtToken, nil
+	}
+	return o.signin(ctx)
+}
+
+// refresh replaces a token Omnistrate rejected and reports whether the call is worth retrying with
+// the returned token
+func (o *OmnistrateServiceAdmin) refresh(ctx context.Context, rejected string) (string, bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Another request already replaced it
+	if o.jwtToken != "" && o.jwtToken != rejected {
+		return o.jwtToken, true, nil
 	}
 
+	// A fresh token was rejected for another reason, signing in again would not help
+	if time.Since(o.issuedAt) < adminTokenMinAge {
+		return rejected, false, nil
+	}
+
+	token, err := o.signin(ctx)
+	return token, err == nil, err
+}
+
+// signin signs the service account in, the caller holds mu
+func (o *OmnistrateServiceAdmin) signin(ctx context.Context) (token string, err error) {
+	ctx, span := tracing.Start(ctx, "omnistrate.AdminSignin")
+	defer func() { tracing.End(span, err) }()
+
 	request := openapiclientv1.NewSigninRequest(o.username)
 	request.Password = ToPtr(o.password)
 
@@ -55,58 +111,126 @@ func (o *OmnistrateServiceAdmin) Authenticate(ctx context.Context) (err error) {
 	}()
 
 	o.jwtToken = result.JwtToken
-	return
+	o.issuedAt = time.Now()
+	o.expiresAt = tokenExpiry(result.JwtToken, o.issuedAt)
+	return o.jwtToken, nil
 }
 
-func (o *OmnistrateServiceAdmin) TenantSignInAPIHandle(ctx context.Context) (client openapiclientv1.ApiUsersApiCustomerSigninRequest, err error) {
-	// Authenticate the service account
-	if err = o.Authenticate(ctx); err != nil {
-		return
+// tokenExpiry reads the expiry claim of a JWT. The token came straight from Omnistrate, its signature
+// does not need to be checked to schedule a refresh.
+func tokenExpiry(token string, issuedAt time.Time) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		var claims struct {
+			ExpiresAt int64 `json:"exp"`
+		}
+		if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil && json.Unmarshal(payload, &claims) == nil && claims.ExpiresAt > 0 {
+			return time.Unix(claims.ExpiresAt, 0)
+		}
 	}
-
-	// Create a new client with the JWT token
-	ctx = context.WithValue(ctx, openapiclientv1.ContextAccessToken, o.jwtToken)
-	client = GetOmnistrateAPIClient().UsersApiAPI.UsersApiCustomerSignin(ctx)
-	return
+	return issuedAt.Add(adminTokenDefaultLifetime)
 }
 
-func (o *OmnistrateServiceAdmin) TenantSignUpAPIHandle(ctx context.Context) (client openapiclientv1.ApiUsersApiCustomerSignupRequest, err error) {
-	// Authenticate the service account
-	if err = o.Authenticate(ctx); err != nil {
-		return
+// withToken makes a call as the service account. A call rejected with 401 is retried once with a
+// new token, in case the token was revoked or expired early. Calls that pass customer credentials
+// must not use it, their 401 means the credentials are wrong.
+func (o *OmnistrateServiceAdmin) withToken(ctx context.Context, call func(token string) (*http.Response, error)) (*http.Response, error) {
+	token, err := o.token(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create a new client with the JWT token
-	ctx = context.WithValue(ctx, openapiclientv1.ContextAccessToken, o.jwtToken)
-	client = GetOmnistrateAPIClient().UsersApiAPI.UsersApiCustomerSignup(ctx)
-	return
+	httpResult, err := call(token)
+	if httpResult == nil || httpResult.StatusCode != http.StatusUnauthorized {
+		return httpResult, err
+	}
+
+	fresh, retry, refreshErr := o.refresh(ctx, token)
+	if refreshErr != nil {
+		log.Ctx(ctx).Warn().Err(refreshErr).Msg("failed to refresh omnistrate service account token")
+	}
+	if !retry {
+		return httpResult, err
+	}
+	return call(fresh)
 }
 
-func (o *OmnistrateServiceAdmin) TenantUserProfileAPIHandle(ctx context.Context) (client openapiclientv1.ApiUsersApiDescribeUserRequest, err error) {
-	// Authenticate the service account
-	if err = o.Authenticate(ctx); err != nil {
-		return
+// TenantSignIn signs a customer in through the service account. It is not retried on 401, that is
+// the answer to a wrong password.
+func (o *OmnistrateServiceAdmin) TenantSignIn(ctx context.Context, request openapiclientv1.CustomerSigninRequest2) (*openapiclientv1.CustomerSigninResult, *http.Response, error) {
+	token, err := o.token(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Create a new client with the JWT token
-	client = GetOmnistrateAPIClient().UsersApiAPI.UsersApiDescribeUser(ctx)
-	return
+	tokenCtx := context.WithValue(ctx, openapiclientv1.ContextAccessToken, token)
+	return GetOmnistrateAPIClient().UsersApiAPI.UsersApiCustomerSignin(tokenCtx).CustomerSigninRequest2(request).Execute()
 }
 
-func (o *OmnistrateServiceAdmin) ValidateTenant(ctx context.Context, tenantEmail string) (err error) {
-	// Authenticate the service account
-	if err = o.Authenticate(ctx); err != nil {
-		return
-	}
+// TenantSignUp creates a customer account through the service account
+func (o *OmnistrateServiceAdmin) TenantSignUp(ctx context.Context, request openapiclientv1.CustomerSignupRequest2) (*http.Response, error) {
+	return o.withToken(ctx, func(token string) (*http.Response, error) {
+		tokenCtx := context.WithValue(ctx, openapiclientv1.ContextAccessToken, token)
+		return GetOmnistrateAPIClient().UsersApiAPI.UsersApiCustomerSignup(tokenCtx).CustomerSignupRequest2(request).Execute()
+	})
+}
+
+// Types of the customer events carrying a token
+const (
+	TenantSignUpEvent        = "CustomerSignUp"
+	TenantResetPasswordEvent = "CustomerResetPassword"
+)
+
+const (
+	// Events show up shortly after the request that caused them, the events are listed this often
+	// before giving up
+	tenantTokenPollAttempts = 5
+	tenantTokenPollInterval = time.Second
+)
 
-	// List all events for tenants to retrieve the validation token
-	fleetCtx := context.WithValue(ctx, openapiclientfleetv1.ContextAccessToken, o.jwtToken)
-	eventsClient := GetOmnistrateFleetAPIClient().EventsApiAPI.EventsApiListEvents(fleetCtx)
+// LatestTenantToken returns the token of the most recent event of eventType for the customer that
+// happened at or after since, i.e. the verification token of a signup or the reset token of a
+// password reset request. Events can lag behind the request, they are polled a few times.
+func (o *OmnistrateServiceAdmin) LatestTenantToken(ctx context.Context, tenantEmail string, eventType string, since time.Time) (token string, err error) {
+	ctx, span := tracing.Start(ctx, "omnistrate.LatestTenantToken")
+	defer func() { tracing.End(span, err) }()
 
+	for attempt := 1; ; attempt++ {
+		var events []openapiclientfleetv1.EndCustomerEvent
+		if events, err = o.listTenantEvents(ctx); err != nil {
+			return
+		}
+
+		if token = findTenantToken(events, tenantEmail, eventType, since); token != "" {
+			return
+		}
+
+		if attempt == tenantTokenPollAttempts {
+			err = errors.New("no token found for tenant")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-time.After(tenantTokenPollInterval):
+		}
+	}
+}
+
+// listTenantEvents lists the events of all customers
+func (o *OmnistrateServiceAdmin) listTenantEvents(ctx context.Context) ([]openapiclientfleetv1.EndCustomerEvent, error) {
 	var result *openapiclientfleetv1.ListEndCustomerEventsResult
-	var httpResult *http.Response
-	if result, httpResult, err = eventsClient.Execute(); err != nil {
-		return
+	httpResult, err := o.withToken(ctx, func(adminToken string) (*http.Response, error) {
+		var httpResult *http.Response
+		var err error
+		fleetCtx := context.WithValue(ctx, openapiclientfleetv1.ContextAccessToken, adminToken)
+		result, httpResult, err = GetOmnistrateFleetAPIClient().EventsApiAPI.EventsApiListEvents(fleetCtx).Execute()
+		return httpResult, err
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	defer func() {
@@ -118,26 +242,102 @@ func (o *OmnistrateServiceAdmin) ValidateTenant(ctx context.Context, tenantEmail
 		}
 	}()
 
-	for _, event := range result.Events {
-		if event.UserEmail != nil && *event.UserEmail == tenantEmail {
-			if event.EventPayload == nil {
-				err = errors.New("event payload is nil")
-				return
-			}
-
-			// Create a new client with the JWT token
-			tenantCtx := context.WithValue(ctx, openapiclientv1.ContextAccessToken, o.jwtToken)
-			if httpResult, err = GetOmnistrateAPIClient().SignupApiAPI.SignupApiValidateToken(tenantCtx).ValidateTokenRequest(openapiclientv1.ValidateTokenRequest{
-				Email: tenantEmail,
-				Token: event.EventPayload["token"].(string),
-			}).Execute(); err != nil {
-				return
-			}
+	return result.Events, nil
+}
 
-			return
+// findTenantToken returns the token of the newest matching event, or an empty string. With a zero
+// since any matching event counts, otherwise events without a readable time are skipped.
+func findTenantToken(events []openapiclientfleetv1.EndCustomerEvent, tenantEmail string, eventType string, since time.Time) (token string) {
+	// Event times have a precision of seconds
+	since = since.Truncate(time.Second)
+
+	var latest time.Time
+	for _, event := range events {
+		if event.EventType != eventType || event.UserEmail == nil || !strings.EqualFold(*event.UserEmail, tenantEmail) {
+			continue
+		}
+
+		eventToken, ok := event.EventPayload["token"].(string)
+		if !ok || eventToken == "" {
+			continue
+		}
+
+		eventTime, timeErr := time.Parse(time.RFC3339, event.Time)
+		if !since.IsZero() && (timeErr != nil || eventTime.Before(since)) {
+			continue
+		}
+
+		// Events without a readable time only count if nothing better was found
+		if token == "" || eventTime.After(latest) {
+			token = eventToken
+			latest = eventTime
 		}
 	}
+	return
+}
+
+// ValidateTenantToken verifies the customer's email with a token they received. Like sign-in, it is
+// not retried on 401, the customer's token may be the one that was rejected.
+func (o *OmnistrateServiceAdmin) ValidateTenantToken(ctx context.Context, tenantEmail string, token string) (httpResult *http.Response, err error) {
+	ctx, span := tracing.Start(ctx, "omnistrate.ValidateTenantToken")
+	defer func() { tracing.End(span, err) }()
+
+	adminToken, err := o.token(ctx)
+	if err != nil {
+		return
+	}
+
+	tokenCtx := context.WithValue(ctx, openapiclientv1.ContextAccessToken, adminToken)
+	return GetOmnistrateAPIClient().SignupApiAPI.SignupApiValidateToken(tokenCtx).ValidateTokenRequest(openapiclientv1.ValidateTokenRequest{
+		Email: tenantEmail,
+		Token: token,
+	}).Execute()
+}
+
+// ResetTenantPassword asks Omnistrate for a password reset of the customer and returns the reset token
+func (o *OmnistrateServiceAdmin) ResetTenantPassword(ctx context.Context, tenantEmail string) (token string, err error) {
+	ctx, span := tracing.Start(ctx, "omnistrate.ResetTenantPassword")
+	defer func() { tracing.End(span, err) }()
+
+	// Only the event of this request carries the token that is valid now
+	requestedAt := time.Now()
+
+	if _, err = o.withToken(ctx, func(adminToken string) (*http.Response, error) {
+		tokenCtx := context.WithValue(ctx, openapiclientv1.ContextAccessToken, adminToken)
+		return GetOmnistrateAPIClient().UsersApiAPI.UsersApiCustomerResetPassword(tokenCtx).CustomerResetPasswordRequest2(openapiclientv1.CustomerResetPasswordRequest2{
+			Email: tenantEmail,
+		}).Execute()
+	}); err != nil {
+		return
+	}
+
+	return o.LatestTenantToken(ctx, tenantEmail, TenantResetPasswordEvent, requestedAt)
+}
+
+// ChangeTenantPassword sets a new password for the customer with a reset token they received
+func (o *OmnistrateServiceAdmin) ChangeTenantPassword(ctx context.Context, tenantEmail string, token string, password string) (httpResult *http.Response, err error) {
+	ctx, span := tracing.Start(ctx, "omnistrate.ChangeTenantPassword")
+	defer func() { tracing.End(span, err) }()
 
-	err = errors.New("tenant not found")
+	return GetOmnistrateAPIClient().SignupApiAPI.SignupApiChangePassword(ctx).ChangePasswordRequest(openapiclientv1.ChangePasswordRequest{
+		Email:    tenantEmail,
+		Password: password,
+		Token:    token,
+	}).Execute()
+}
+
+// DeleteTenantUser removes a customer user from Omnistrate. Users that are already gone are not an error.
+func (o *OmnistrateServiceAdmin) DeleteTenantUser(ctx context.Context, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "omnistrate.DeleteTenantUser")
+	defer func() { tracing.End(span, err) }()
+
+	var httpResult *http.Response
+	httpResult, err = o.withToken(ctx, func(adminToken string) (*http.Response, error) {
+		fleetCtx := context.WithValue(ctx, openapiclientfleetv1.ContextAccessToken, adminToken)
+		return GetOmnistrateFleetAPIClient().InventoryApiAPI.InventoryApiDeleteUser(fleetCtx, userID).Execute()
+	})
+	if httpResult != nil && httpResult.StatusCode == http.StatusNotFound {
+		return nil
+	}
 	return
 }
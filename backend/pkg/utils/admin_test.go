@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openapiclientfleetv1 "github.com/omnistrate-oss/omnistrate-sdk-go/fleet"
+)
+
+var (
+	omnistrateOnce sync.Once
+	// adminSignins counts the service account sign-ins the fake Omnistrate answered
+	adminSignins atomic.Int64
+)
+
+// useFakeOmnistrate routes the Omnistrate calls of the test binary to a fake that answers service
+// account sign-ins with a new token each time
+func useFakeOmnistrate(t *testing.T) {
+	t.Helper()
+
+	omnistrateOnce.Do(func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/2022-09-01-00/signin" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{"jwtToken": fmt.Sprintf("token-%d", adminSignins.Add(1))})
+		}))
+		// The SDK has the Omnistrate URL built in, so every connection goes to the fake instead
+		http.DefaultTransport = &http.Transport{
+			DialContext: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	})
+	adminSignins.Store(0)
+}
+
+// rejecting answers calls made with the rejected token with 401 and counts all calls
+func rejecting(rejected string, calls *atomic.Int64) func(token string) (*http.Response, error) {
+	return func(token string) (*http.Response, error) {
+		calls.Add(1)
+		if token == rejected {
+			return &http.Response{StatusCode: http.StatusUnauthorized}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+}
+
+func TestWithToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		issuedAgo   time.Duration
+		rejectAll   bool
+		wantCalls   int64
+		wantSignins int64
+		wantStatus  int
+	}{
+		{name: "revoked token", issuedAgo: 10 * time.Minute, wantCalls: 2, wantSignins: 1, wantStatus: http.StatusOK},
+		{name: "new token rejected as well", issuedAgo: 10 * time.Minute, rejectAll: true, wantCalls: 2, wantSignins: 1, wantStatus: http.StatusUnauthorized},
+		{name: "fresh token", issuedAgo: adminTokenMinAge / 2, wantCalls: 1, wantSignins: 0, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeOmnistrate(t)
+			now := time.Now()
+			admin := &OmnistrateServiceAdmin{jwtToken: "stale", issuedAt: now.Add(-tt.issuedAgo), expiresAt: now.Add(time.Hour)}
+
+			var calls atomic.Int64
+			call := rejecting("stale", &calls)
+			if tt.rejectAll {
+				call = func(string) (*http.Response, error) {
+					calls.Add(1)
+					return &http.Response{StatusCode: http.StatusUnauthorized}, nil
+				}
+			}
+
+			resp, err := admin.withToken(context.Background(), call)
+			if err != nil {
+				t.Fatalf("withToken() error = %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if calls.Load() != tt.wantCalls || adminSignins.Load() != tt.wantSignins {
+				t.Errorf("%d calls and %d sign-ins, want %d and %d", calls.Load(), adminSignins.Load(), tt.wantCalls, tt.wantSignins)
+			}
+		})
+	}
+}
+
+func TestWithTokenConcurrently(t *testing.T) {
+	useFakeOmnistrate(t)
+	now := time.Now()
+	admin := &OmnistrateServiceAdmin{jwtToken: "stale", issuedAt: now.Add(-10 * time.Minute), expiresAt: now.Add(time.Hour)}
+
+	var calls atomic.Int64
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := admin.withToken(context.Background(), rejecting("stale", &calls))
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("withToken() = %v, %v, want 200", resp, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if signins := adminSignins.Load(); signins != 1 {
+		t.Errorf("sign-ins = %d, want one for all rejected calls", signins)
+	}
+}
+
+func TestToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		token       string
+		expiresIn   time.Duration
+		wantSignins int64
+	}{
+		{name: "no token", wantSignins: 1},
+		{name: "valid token", token: "valid", expiresIn: time.Hour, wantSignins: 0},
+		{name: "token about to expire", token: "expiring", expiresIn: adminTokenRefreshMargin / 2, wantSignins: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeOmnistrate(t)
+			admin := &OmnistrateServiceAdmin{jwtToken: tt.token, issuedAt: time.Now(), expiresAt: time.Now().Add(tt.expiresIn)}
+
+			token, err := admin.token(context.Background())
+			if err != nil {
+				t.Fatalf("token() error = %v", err)
+			}
+			if adminSignins.Load() != tt.wantSignins {
+				t.Errorf("sign-ins = %d, want %d", adminSignins.Load(), tt.wantSignins)
+			}
+			if tt.wantSignins == 0 && token != tt.token {
+				t.Errorf("token() = %q, want the current token %q", token, tt.token)
+			}
+		})
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	issuedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	jwt := func(claims string) string {
+		return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  time.Time
+	}{
+		{name: "expiry claim", token: jwt(`{"sub":"service","exp":1790000000}`), want: time.Unix(1790000000, 0)},
+		{name: "no expiry claim", token: jwt(`{"sub":"service"}`), want: issuedAt.Add(adminTokenDefaultLifetime)},
+		{name: "invalid claims", token: jwt(`not json`), want: issuedAt.Add(adminTokenDefaultLifetime)},
+		{name: "not a JWT", token: "opaque-token", want: issuedAt.Add(adminTokenDefaultLifetime)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenExpiry(tt.token, issuedAt); !got.Equal(tt.want) {
+				t.Errorf("tokenExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindTenantToken(t *testing.T) {
+	requestedAt := time.Date(2024, 6, 1, 12, 0, 0, 500_000_000, time.UTC)
+
+	event := func(eventType string, email string, at string, token string) openapiclientfleetv1.EndCustomerEvent {
+		return openapiclientfleetv1.EndCustomerEvent{
+			EventType:    eventType,
+			UserEmail:    ToPtr(email),
+			Time:         at,
+			EventPayload: map[string]interface{}{"token": token},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		events    []openapiclientfleetv1.EndCustomerEvent
+		eventType string
+		since     time.Time
+		want      string
+	}{
+		{
+			name: "newest event of the type",
+			events: []openapiclientfleetv1.EndCustomerEvent{
+				event(TenantSignUpEvent, "user@example.com", "2024-06-01T11:00:00Z", "old"),
+				event(TenantSignUpEvent, "User@Example.com", "2024-06-01T11:30:00Z", "new"),
+			},
+			eventType: TenantSignUpEvent,
+			want:      "new",
+		},
+		{
+			name: "other event types are ignored",
+			events: []openapiclientfleetv1.EndCustomerEvent{
+				event(TenantSignUpEvent, "user@example.com", "2024-06-01T12:00:05Z", "signup"),
+			},
+			eventType: TenantResetPasswordEvent,
+			since:     requestedAt,
+			want:      "",
+		},
+		{
+			name: "events before the request are ignored",
+			events: []openapiclientfleetv1.EndCustomerEvent{
+				event(TenantResetPasswordEvent, "user@example.com", "2024-06-01T11:59:59Z", "previous"),
+			},
+			eventType: TenantResetPasswordEvent,
+			since:     requestedAt,
+			want:      "",
+		},
+		{
+			name: "event in the second of the request",
+			events: []openapiclientfleetv1.EndCustomerEvent{
+				event(TenantResetPasswordEvent, "user@example.com", "2024-06-01T11:59:59Z", "previous"),
+				event(TenantResetPasswordEvent, "user@example.com", "2024-06-01T12:00:00Z", "current"),
+			},
+			eventType: TenantResetPasswordEvent,
+			since:     requestedAt,
+			want:      "current",
+		},
+		{
+			name: "events of other users are ignored",
+			events: []openapiclientfleetv1.EndCustomerEvent{
+				event(TenantResetPasswordEvent, "other@example.com", "2024-06-01T12:00:05Z", "other"),
+			},
+			eventType: TenantResetPasswordEvent,
+			since:     requestedAt,
+			want:      "",
+		},
+		{
+			name: "events without a time only count without since",
+			events: []openapiclientfleetv1.EndCustomerEvent{
+				event(TenantResetPasswordEvent, "user@example.com", "", "untimed"),
+			},
+			eventType: TenantResetPasswordEvent,
+			since:     requestedAt,
+			want:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findTenantToken(tt.events, "user@example.com", tt.eventType, tt.since); got != tt.want {
+				t.Errorf("findTenantToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package utils
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/omnistrate-community/ai-chatbot/pkg/config"
-	cors "github.com/rs/cors/wrapper/gin"
 	"github.com/rs/zerolog/log"
 	"net/http"
 )
@@ -14,57 +13,55 @@ type GinAPI gin.HandlerFunc
 type NativeAPI http.HandlerFunc
 
 func init() {
-	r = gin.Default()
+	gin.SetMode(gin.ReleaseMode)
+	// Access logs are written by the logger middleware as structured JSON
+	r = gin.New()
 	r.RedirectTrailingSlash = true
 	r.RedirectFixedPath = true
-	corsMW := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"*"},
+}
+
+// Recovery answers requests whose handler panicked with 500. Install it after the logging and
+// metrics middleware, so they see the 500 instead of being unwound by the panic.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(ctx *gin.Context, recovered any) {
+		log.Ctx(ctx.Request.Context()).Error().Interface("panic", recovered).Msg("recovered from panic")
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 	})
-	r.Use(corsMW)
+}
 
+// Use installs middleware for all routes. It must be called before any API is mounted.
+func Use(middleware ...gin.HandlerFunc) {
+	r.Use(middleware...)
 }
 
-func (a GinAPI) Mount(path string, verb string) {
-	switch verb {
-	case http.MethodGet:
-		r.GET(config.APIPrefix+"/"+path, gin.HandlerFunc(a))
-	case http.MethodHead:
-		r.HEAD(config.APIPrefix+"/"+path, gin.HandlerFunc(a))
-	case http.MethodPost:
-		r.POST(config.APIPrefix+"/"+path, gin.HandlerFunc(a))
-	case http.MethodPut:
-		r.PUT(config.APIPrefix+"/"+path, gin.HandlerFunc(a))
-	case http.MethodPatch:
-		r.PATCH(config.APIPrefix+"/"+path, gin.HandlerFunc(a))
-	case http.MethodDelete:
-		r.DELETE(config.APIPrefix+"/"+path, gin.HandlerFunc(a))
-	}
+func (a GinAPI) Mount(path string, verb string, options ...MountOption) {
+	mount(path, verb, gin.HandlerFunc(a), options)
+}
+
+func (a NativeAPI) Mount(path string, verb string, options ...MountOption) {
+	mount(path, verb, gin.WrapH(http.HandlerFunc(a)), options)
 }
 
-func (a NativeAPI) Mount(path string, verb string) {
+func mount(path string, verb string, handler gin.HandlerFunc, options []MountOption) {
+	o := mountOptions{maxBodyBytes: config.Current.Server.MaxBodyBytes}
+	for _, option := range options {
+		option(&o)
+	}
+
+	handlers := []gin.HandlerFunc{limitBody(o.maxBodyBytes), handler}
+
 	switch verb {
 	case http.MethodGet:
-		r.GET(config.APIPrefix+"/"+path, gin.WrapH(http.HandlerFunc(a)))
+		r.GET(config.Current.APIPrefix+"/"+path, handlers...)
 	case http.MethodHead:
-		r.HEAD(config.APIPrefix+"/"+path, gin.WrapH(http.HandlerFunc(a)))
+		r.HEAD(config.Current.APIPrefix+"/"+path, handlers...)
 	case http.MethodPost:
-		r.POST(config.APIPrefix+"/"+path, gin.WrapH(http.HandlerFunc(a)))
+		r.POST(config.Current.APIPrefix+"/"+path, handlers...)
 	case http.MethodPut:
-		r.PUT(config.APIPrefix+"/"+path, gin.WrapH(http.HandlerFunc(a)))
+		r.PUT(config.Current.APIPrefix+"/"+path, handlers...)
 	case http.MethodPatch:
-		r.PATCH(config.APIPrefix+"/"+path, gin.WrapH(http.HandlerFunc(a)))
+		r.PATCH(config.Current.APIPrefix+"/"+path, handlers...)
 	case http.MethodDelete:
-		r.DELETE(config.APIPrefix+"/"+path, gin.WrapH(http.HandlerFunc(a)))
-	}
-}
-
-func StartServer() {
-	gin.SetMode(gin.ReleaseMode)
-
-	err := r.Run(":8080")
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to run server")
+		r.DELETE(config.Current.APIPrefix+"/"+path, handlers...)
 	}
 }
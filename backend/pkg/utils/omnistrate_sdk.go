@@ -1,30 +1,159 @@
 package utils
 
 import (
-	openapiclientfleetv1 "github.com/omnistrate-oss/omnistrate-sdk-go/fleet"
-	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	openapiclientfleetv1 "github.com/omnistrate-oss/omnistrate-sdk-go/fleet"
+	openapiclientv1 "github.com/omnistrate-oss/omnistrate-sdk-go/v1"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	omnistrateRetryBaseDelay = 200 * time.Millisecond
+	omnistrateRetryMaxDelay  = 5 * time.Second
+)
+
+var (
+	omnistrateClientsOnce    sync.Once
+	omnistrateAPIClient      *openapiclientv1.APIClient
+	omnistrateFleetAPIClient *openapiclientfleetv1.APIClient
 )
 
+// initOmnistrateClients builds the SDK clients once. Both share an HTTP client, so connections to
+// Omnistrate are pooled across all requests.
+func initOmnistrateClients() {
+	omnistrateClientsOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = 32
+
+		httpClient := &http.Client{
+			// Covers all attempts of a call
+			Timeout: config.Current.Omnistrate.Timeout,
+			Transport: &retryTransport{
+				next:       otelhttp.NewTransport(transport),
+				maxRetries: config.Current.Omnistrate.MaxRetries,
+			},
+		}
+
+		configuration := openapiclientv1.NewConfiguration()
+		configuration.HTTPClient = httpClient
+		omnistrateAPIClient = openapiclientv1.NewAPIClient(configuration)
+
+		fleetConfiguration := openapiclientfleetv1.NewConfiguration()
+		fleetConfiguration.HTTPClient = httpClient
+		omnistrateFleetAPIClient = openapiclientfleetv1.NewAPIClient(fleetConfiguration)
+	})
+}
+
 func GetOmnistrateAPIClient() *openapiclientv1.APIClient {
-	configuration := openapiclientv1.NewConfiguration()
+	initOmnistrateClients()
+	return omnistrateAPIClient
+}
 
-	configuration.HTTPClient = &http.Client{
-		Timeout: 30 * time.Second,
+func GetOmnistrateFleetAPIClient() *openapiclientfleetv1.APIClient {
+	initOmnistrateClients()
+	return omnistrateFleetAPIClient
+}
+
+// retryTransport retries calls that failed for transient reasons with exponential backoff. Requests
+// that may have reached Omnistrate are only retried for idempotent methods, a retried signup could
+// otherwise be processed twice.
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("request body cannot be replayed")
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(attemptReq)
+		if attempt >= t.maxRetries || !retryable(req, resp, err) {
+			return resp, err
+		}
+
+		delay := retryDelay(attempt, resp)
+		if resp != nil {
+			// Drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		log.Ctx(req.Context()).Debug().Err(err).Str("url", req.URL.Redacted()).Int("attempt", attempt+1).Dur("retry_in", delay).Msg("retrying omnistrate request")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// retryable decides whether a failed attempt is worth repeating
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+
+		// A connection that could not be established never carried the request
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return true
+		}
+		return idempotent(req)
 	}
 
-	apiClient := openapiclientv1.NewAPIClient(configuration)
-	return apiClient
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		// Rejected before being processed
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(req)
+	}
+	return false
 }
 
-func GetOmnistrateFleetAPIClient() *openapiclientfleetv1.APIClient {
-	configuration := openapiclientfleetv1.NewConfiguration()
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
 
-	configuration.HTTPClient = &http.Client{
-		Timeout: 30 * time.Second,
+// retryDelay honours Retry-After and otherwise backs off exponentially with full jitter
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, omnistrateRetryMaxDelay)
+		}
 	}
 
-	apiClient := openapiclientfleetv1.NewAPIClient(configuration)
-	return apiClient
+	ceiling := min(omnistrateRetryBaseDelay<<attempt, omnistrateRetryMaxDelay)
+	return time.Duration(rand.Int64N(int64(ceiling)) + 1)
 }
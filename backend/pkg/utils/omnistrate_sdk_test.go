@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// answer is the outcome of one attempt, a status code or an error
+type answer struct {
+	status int
+	err    error
+}
+
+func TestRetryTransport(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	tests := []struct {
+		name         string
+		method       string
+		answers      []answer
+		wantAttempts int
+		wantStatus   int
+		wantErr      bool
+	}{
+		{name: "success", method: http.MethodPost, answers: []answer{{status: 200}}, wantAttempts: 1, wantStatus: 200},
+		{name: "POST bad gateway", method: http.MethodPost, answers: []answer{{status: 502}, {status: 200}}, wantAttempts: 1, wantStatus: 502},
+		{name: "POST gateway timeout", method: http.MethodPost, answers: []answer{{status: 504}, {status: 200}}, wantAttempts: 1, wantStatus: 504},
+		{name: "POST unavailable", method: http.MethodPost, answers: []answer{{status: 503}, {status: 200}}, wantAttempts: 1, wantStatus: 503},
+		{name: "POST rate limited", method: http.MethodPost, answers: []answer{{status: 429}, {status: 200}}, wantAttempts: 2, wantStatus: 200},
+		{name: "POST dial error", method: http.MethodPost, answers: []answer{{err: dialErr}, {status: 200}}, wantAttempts: 2, wantStatus: 200},
+		{name: "POST read error", method: http.MethodPost, answers: []answer{{err: readErr}, {status: 200}}, wantAttempts: 1, wantErr: true},
+		{name: "GET bad gateway", method: http.MethodGet, answers: []answer{{status: 502}, {status: 200}}, wantAttempts: 2, wantStatus: 200},
+		{name: "GET read error", method: http.MethodGet, answers: []answer{{err: readErr}, {status: 200}}, wantAttempts: 2, wantStatus: 200},
+		{name: "client error", method: http.MethodGet, answers: []answer{{status: 400}, {status: 200}}, wantAttempts: 1, wantStatus: 400},
+		{name: "retries exhausted", method: http.MethodGet, answers: []answer{{status: 503}, {status: 503}, {status: 503}, {status: 200}}, wantAttempts: 3, wantStatus: 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			transport := &retryTransport{
+				maxRetries: 2,
+				next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					body, _ := io.ReadAll(req.Body)
+					bodies = append(bodies, string(body))
+
+					answer := tt.answers[len(bodies)-1]
+					if answer.err != nil {
+						return nil, answer.err
+					}
+					// Retry right away
+					header := http.Header{"Retry-After": []string{"0"}}
+					return &http.Response{StatusCode: answer.status, Header: header, Body: io.NopCloser(strings.NewReader(""))}, nil
+				}),
+			}
+
+			req, err := http.NewRequest(tt.method, "https://api.omnistrate.example/2022-09-01-00/signup", strings.NewReader(`{"email":"jane@acme.example"}`))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			resp, err := transport.RoundTrip(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RoundTrip() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if len(bodies) != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", len(bodies), tt.wantAttempts)
+			}
+			// Every attempt sends the whole body again
+			for i, body := range bodies {
+				if body != `{"email":"jane@acme.example"}` {
+					t.Errorf("body of attempt %d = %q, want the request body", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportWithoutGetBody(t *testing.T) {
+	attempts := 0
+	transport := &retryTransport{
+		maxRetries: 2,
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": []string{"0"}}, Body: io.NopCloser(strings.NewReader(""))}, nil
+		}),
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.omnistrate.example/2022-09-01-00/signup", io.NopCloser(strings.NewReader("{}")))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if _, err = transport.RoundTrip(req); err == nil {
+		t.Error("RoundTrip() error = nil, want the body that cannot be replayed reported")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter string
+		wantMin    time.Duration
+		wantMax    time.Duration
+	}{
+		{name: "Retry-After", retryAfter: "2", wantMin: 2 * time.Second, wantMax: 2 * time.Second},
+		{name: "Retry-After zero", retryAfter: "0", wantMin: 0, wantMax: 0},
+		{name: "Retry-After capped", retryAfter: "3600", wantMin: omnistrateRetryMaxDelay, wantMax: omnistrateRetryMaxDelay},
+		{name: "Retry-After date falls back to backoff", retryAfter: "Wed, 21 Oct 2026 07:28:00 GMT", wantMin: 1, wantMax: omnistrateRetryBaseDelay},
+		{name: "first retry", wantMin: 1, wantMax: omnistrateRetryBaseDelay},
+		{name: "third retry", attempt: 2, wantMin: 1, wantMax: 4 * omnistrateRetryBaseDelay},
+		{name: "backoff capped", attempt: 10, wantMin: 1, wantMax: omnistrateRetryMaxDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+
+			for range 100 {
+				if got := retryDelay(tt.attempt, resp); got < tt.wantMin || got > tt.wantMax {
+					t.Fatalf("retryDelay() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	cors "github.com/rs/cors/wrapper/gin"
+)
+
+// CORS answers preflight requests and sets the CORS headers for the configured origins. It must be
+// installed first, so preflights are answered before any other middleware runs. Without configured
+// origins no CORS headers are sent and browsers refuse cross-origin calls.
+func CORS() gin.HandlerFunc {
+	settings := config.Current.CORS
+
+	// The cors package allows every origin when none are given
+	if len(settings.AllowedOrigins) == 0 {
+		return func(ctx *gin.Context) {
+			ctx.Next()
+		}
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins:   settings.AllowedOrigins,
+		AllowedMethods:   settings.AllowedMethods,
+		AllowedHeaders:   settings.AllowedHeaders,
+		ExposedHeaders:   settings.ExposedHeaders,
+		AllowCredentials: settings.AllowCredentials,
+		MaxAge:           int(settings.MaxAge.Seconds()),
+	})
+}
+
+// SecurityHeaders sets the security headers for every response. Handlers rendering HTML replace the
+// Content-Security-Policy with one fitting the page.
+func SecurityHeaders() gin.HandlerFunc {
+	settings := config.Current.Security
+
+	hsts := ""
+	if settings.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int64(settings.HSTSMaxAge.Seconds()))
+		if settings.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(ctx *gin.Context) {
+		header := ctx.Writer.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "no-referrer")
+		if settings.FrameOptions != "" {
+			header.Set("X-Frame-Options", settings.FrameOptions)
+		}
+		if settings.ContentSecurityPolicy != "" {
+			header.Set("Content-Security-Policy", settings.ContentSecurityPolicy)
+		}
+
+		// Browsers ignore HSTS over plain HTTP, only send it when TLS is used, directly or at the proxy
+		if hsts != "" && (ctx.Request.TLS != nil || ctx.GetHeader("X-Forwarded-Proto") == "https") {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+
+		ctx.Next()
+	}
+}
+
+// MountOption customizes a single route
+type MountOption func(*mountOptions)
+
+type mountOptions struct {
+	maxBodyBytes int64
+}
+
+// WithMaxBodyBytes overrides the default request body limit of a route
+func WithMaxBodyBytes(limit int64) MountOption {
+	return func(o *mountOptions) {
+		o.maxBodyBytes = limit
+	}
+}
+
+// limitBody rejects requests announcing a larger body up front and cuts off bodies that turn out larger
+func limitBody(limit int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.ContentLength > limit {
+			ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body exceeds %d bytes", limit)})
+			return
+		}
+
+		if ctx.Request.Body != nil {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+)
+
+// withConfig makes cfg current for the duration of the test
+func withConfig(t *testing.T, cfg *config.Config) {
+	t.Helper()
+
+	previous := config.Current
+	config.Current = cfg
+	t.Cleanup(func() { config.Current = previous })
+}
+
+// serve sends the request through middleware to a handler answering 204
+func serve(middleware gin.HandlerFunc, request *http.Request) *httptest.ResponseRecorder {
+	engine := gin.New()
+	engine.Use(middleware)
+	engine.Any("/api/test", func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		method      string
+		origin      string
+		wantAllowed string
+	}{
+		{name: "no origins configured", method: http.MethodGet, origin: "https://chat.acme.example"},
+		{name: "no origins configured preflight", method: http.MethodOptions, origin: "https://chat.acme.example"},
+		{name: "listed origin", origins: []string{"https://chat.acme.example"}, method: http.MethodGet, origin: "https://chat.acme.example", wantAllowed: "https://chat.acme.example"},
+		{name: "listed origin preflight", origins: []string{"https://chat.acme.example"}, method: http.MethodOptions, origin: "https://chat.acme.example", wantAllowed: "https://chat.acme.example"},
+		{name: "other origin", origins: []string{"https://chat.acme.example"}, method: http.MethodGet, origin: "https://evil.example"},
+		{name: "every origin", origins: []string{"*"}, method: http.MethodGet, origin: "https://evil.example", wantAllowed: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Defaults()
+			cfg.CORS.AllowedOrigins = tt.origins
+			withConfig(t, cfg)
+
+			request := httptest.NewRequest(tt.method, "/api/test", nil)
+			request.Header.Set("Origin", tt.origin)
+			if tt.method == http.MethodOptions {
+				request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+
+			recorder := serve(CORS(), request)
+			if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowed {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(cfg *config.Config)
+		tls      bool
+		proto    string
+		wantHSTS string
+	}{
+		{name: "plain HTTP"},
+		{name: "TLS", tls: true, wantHSTS: "max-age=31536000"},
+		{name: "TLS at the proxy", proto: "https", wantHSTS: "max-age=31536000"},
+		{name: "plain HTTP at the proxy", proto: "http"},
+		{
+			name:     "subdomains",
+			change:   func(cfg *config.Config) { cfg.Security.HSTSIncludeSubdomains = true },
+			tls:      true,
+			wantHSTS: "max-age=31536000; includeSubDomains",
+		},
+		{
+			name:   "HSTS disabled",
+			change: func(cfg *config.Config) { cfg.Security.HSTSMaxAge = 0 },
+			tls:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Defaults()
+			if tt.change != nil {
+				tt.change(cfg)
+			}
+			withConfig(t, cfg)
+
+			request := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			if tt.tls {
+				request.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				request.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+
+			header := serve(SecurityHeaders(), request).Header()
+			if got := header.Get("Strict-Transport-Security"); got != tt.wantHSTS {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, tt.wantHSTS)
+			}
+
+			want := map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"Referrer-Policy":         "no-referrer",
+				"X-Frame-Options":         cfg.Security.FrameOptions,
+				"Content-Security-Policy": cfg.Security.ContentSecurityPolicy,
+			}
+			for name, value := range want {
+				if got := header.Get(name); got != value {
+					t.Errorf("%s = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantStatus    int
+	}{
+		{name: "within the limit", body: "12345", contentLength: 5, wantStatus: http.StatusOK},
+		{name: "announced too large", body: "123456", contentLength: 6, wantStatus: http.StatusRequestEntityTooLarge},
+		// Chunked bodies announce no length, they are cut off while reading
+		{name: "turns out too large", body: "123456", contentLength: -1, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.POST("/api/test", limitBody(5), func(ctx *gin.Context) {
+				if _, err := io.ReadAll(ctx.Request.Body); err != nil {
+					ctx.Status(http.StatusRequestEntityTooLarge)
+					return
+				}
+				ctx.Status(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader(tt.body))
+			request.ContentLength = tt.contentLength
+
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
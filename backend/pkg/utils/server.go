@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/omnistrate-community/ai-chatbot/pkg/config"
+	"github.com/rs/zerolog/log"
+)
+
+// InflightQueries tracks LLM queries that are being generated and persisted, so shutdown can wait for them
+var InflightQueries = &Inflight{}
+
+// InflightEmails tracks emails that are sent in the background after the response went out
+var InflightEmails = &Inflight{}
+
+// Inflight counts running units of work and refuses new ones once draining started
+type Inflight struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	running  int
+	draining bool
+}
+
+// Begin registers a new unit of work. It returns false once the server is shutting down, callers
+// must not start the work then. Every successful Begin must be paired with Done.
+func (i *Inflight) Begin() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.draining {
+		return false
+	}
+	i.running++
+	i.wg.Add(1)
+	return true
+}
+
+// Done marks a unit of work started with Begin as finished
+func (i *Inflight) Done() {
+	i.mu.Lock()
+	i.running--
+	i.mu.Unlock()
+	i.wg.Done()
+}
+
+// Running returns the number of units of work that have not finished yet
+func (i *Inflight) Running() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.running
+}
+
+// Drain refuses new work and waits until all running work finished or ctx expires
+func (i *Inflight) Drain(ctx context.Context) error {
+	i.mu.Lock()
+	i.draining = true
+	i.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		i.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartServer serves the mounted APIs until SIGINT or SIGTERM. On a signal it calls onShutdown,
+// e.g. to fail readiness, then stops accepting new queries and waits up to SHUTDOWN_TIMEOUT for
+// in-flight requests, queries and emails to finish before returning. Work still running then is abandoned,
+// they keep running until the process exits. It returns an error if the server could not be started.
+func StartServer(onShutdown ...func()) error {
+	server := &http.Server{
+		Addr:              config.Current.Server.ListenAddr,
+		Handler:           r,
+		ReadTimeout:       config.Current.Server.ReadTimeout,
+		ReadHeaderTimeout: config.Current.Server.ReadHeaderTimeout,
+		WriteTimeout:      config.Current.Server.WriteTimeout,
+		IdleTimeout:       config.Current.Server.IdleTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Info().Str("addr", server.Addr).Bool("tls", config.Current.Server.TLSCertFile != "").Msg("starting server")
+		if config.Current.Server.TLSCertFile != "" {
+			serveErr <- server.ListenAndServeTLS(config.Current.Server.TLSCertFile, config.Current.Server.TLSKeyFile)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case sig := <-signals:
+		log.Info().Str("signal", sig.String()).Dur("timeout", config.Current.Server.ShutdownTimeout).Msg("shutting down server")
+	}
+
+	for _, fn := range onShutdown {
+		fn()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Current.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Refuse new queries first, so requests arriving while we wait are rejected instead of cut off later
+	if err := InflightQueries.Drain(ctx); err != nil {
+		log.Warn().Err(err).Int("abandoned", InflightQueries.Running()).Msg("gave up waiting for in-flight queries, their responses are lost")
+	}
+	if err := InflightEmails.Drain(ctx); err != nil {
+		log.Warn().Err(err).Int("abandoned", InflightEmails.Running()).Msg("gave up waiting for emails being sent")
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to shut down server gracefully")
+	}
+
+	log.Info().Msg("server stopped")
+	return nil
+}
@@ -1,5 +1,10 @@
 package utils
 
+import (
+	"net/http"
+	"net/url"
+)
+
 func ToPtr[T any](v T) *T {
 	return &v
 }
@@ -10,3 +15,19 @@ func FromPtr[T any](v *T) T {
 	}
 	return *v
 }
+
+// IsUpstreamFailure returns true if a failed SDK call was caused by the upstream service rather than
+// by the request, i.e. there was no response at all, a 5xx or a rate limit
+func IsUpstreamFailure(httpResult *http.Response, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return httpResult == nil || httpResult.StatusCode >= http.StatusInternalServerError || httpResult.StatusCode == http.StatusTooManyRequests
+}
+
+// IsHTTPURL reports whether value is an absolute http or https URL
+func IsHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
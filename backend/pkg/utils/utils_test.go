@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestIsHTTPURL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"https://acme.example", true},
+		{"http://acme.example/logo.png?size=large", true},
+		{"HTTPS://acme.example", true},
+		{"acme.example", false},
+		{"//acme.example/logo.png", false},
+		{"https://", false},
+		{"ftp://acme.example/logo.png", false},
+		{"javascript:alert(1)", false},
+		{"data:image/png;base64,AAAA", false},
+		{"https://acme example", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := IsHTTPURL(tt.value); got != tt.want {
+				t.Errorf("IsHTTPURL(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
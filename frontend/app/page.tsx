@@ -8,12 +8,16 @@ import { Label } from "@/components/ui/label"
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
 import { Tabs, TabsContent, TabsList, TabsTrigger } from "@/components/ui/tabs"
 import { Alert, AlertDescription, AlertTitle } from "@/components/ui/alert"
-import { AlertCircle } from "lucide-react"
+import { AlertCircle, MailCheck } from "lucide-react"
 import { API_ENDPOINTS } from '@/endpoints/endpoint'
 
 export default function Home() {
   const [isLoading, setIsLoading] = useState(false)
   const [error, setError] = useState<string | null>(null)
+  const [notice, setNotice] = useState<string | null>(null)
+  // Email of a signup that still has to be verified, its link can be sent again
+  const [unverifiedEmail, setUnverifiedEmail] = useState<string | null>(null)
+  const [showForgotPassword, setShowForgotPassword] = useState(false)
   const [activeTab, setActiveTab] = useState('signin')
   const router = useRouter()
   const formContainerRef = useRef<HTMLDivElement>(null)
@@ -33,12 +37,13 @@ export default function Home() {
         formContainerRef.current.style.height = `${activeForm.offsetHeight}px`
       }
     }
-  }, [activeTab])
+  }, [activeTab, showForgotPassword])
 
   const handleSubmit = async (event: React.FormEvent<HTMLFormElement>) => {
     event.preventDefault()
     setIsLoading(true)
     setError(null)
+    setNotice(null)
 
     const formData = new FormData(event.currentTarget)
     const isSignup = formData.get('action') === 'signup'
@@ -65,7 +70,12 @@ export default function Home() {
         body: JSON.stringify(body),
       })
 
-      if (response.ok) {
+      if (response.status === 202) {
+        // The account has to be verified through the emailed link before signing in
+        setUnverifiedEmail(formData.get('email') as string)
+        setNotice('Check your inbox and follow the link we sent you to verify your email, then sign in.')
+        setActiveTab('signin')
+      } else if (response.ok) {
         const data = await response.json()
         localStorage.setItem('token', data.token)
         router.push('/chat')
@@ -80,6 +90,48 @@ export default function Home() {
     }
   }
 
+  // requestEmail posts an email address to an endpoint that answers 202 whether or not the account exists
+  const requestEmail = async (endpoint: string, email: string) => {
+    setIsLoading(true)
+    setError(null)
+    setNotice(null)
+
+    try {
+      const response = await fetch(endpoint, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ email }),
+      })
+
+      const data = await response.json()
+      if (response.ok) {
+        setNotice(data.message)
+        return true
+      }
+      setError(data.error || 'The email could not be sent')
+    } catch (error) {
+      setError("An unexpected error occurred. Please try again later.")
+    } finally {
+      setIsLoading(false)
+    }
+    return false
+  }
+
+  const handleResendVerification = () => {
+    if (unverifiedEmail) {
+      requestEmail(API_ENDPOINTS.RESEND_VERIFICATION, unverifiedEmail)
+    }
+  }
+
+  const handleForgotPassword = async (event: React.FormEvent<HTMLFormElement>) => {
+    event.preventDefault()
+    const formData = new FormData(event.currentTarget)
+    setUnverifiedEmail(null)
+    if (await requestEmail(API_ENDPOINTS.FORGOT_PASSWORD, formData.get('email') as string)) {
+      setShowForgotPassword(false)
+    }
+  }
+
   return (
     <div className="flex items-center justify-center min-h-screen bg-background p-4">
       <Card className="w-full max-w-[400px] shadow-apple-lg">
@@ -103,7 +155,27 @@ export default function Home() {
               <AlertDescription>{error}</AlertDescription>
             </Alert>
           )}
-          <Tabs defaultValue="signin" className="w-full" onValueChange={setActiveTab}>
+          {notice && (
+            <Alert className="mb-4">
+              <MailCheck className="h-4 w-4" />
+              <AlertTitle>Check your email</AlertTitle>
+              <AlertDescription>
+                {notice}
+                {unverifiedEmail && (
+                  <Button
+                    variant="link"
+                    size="sm"
+                    className="px-0 h-auto"
+                    disabled={isLoading}
+                    onClick={handleResendVerification}
+                  >
+                    Resend verification email
+                  </Button>
+                )}
+              </AlertDescription>
+            </Alert>
+          )}
+          <Tabs value={activeTab} className="w-full" onValueChange={setActiveTab}>
             <TabsList className="grid w-full grid-cols-2 mb-4 relative">
               <TabsTrigger value="signin">Sign In</TabsTrigger>
               <TabsTrigger value="signup">Sign Up</TabsTrigger>
@@ -111,20 +183,38 @@ export default function Home() {
             </TabsList>
             <div ref={formContainerRef} className="relative overflow-hidden transition-all duration-300 ease-in-out">
               <TabsContent value="signin" className="absolute top-0 left-0 w-full">
-                <form onSubmit={handleSubmit} className="space-y-4">
-                  <input type="hidden" name="action" value="signin" />
-                  <div className="space-y-2">
-                    <Label htmlFor="signin-email">Email</Label>
-                    <Input id="signin-email" name="email" type="email" required />
-                  </div>
-                  <div className="space-y-2">
-                    <Label htmlFor="signin-password">Password</Label>
-                    <Input id="signin-password" name="password" type="password" required />
-                  </div>
-                  <Button className="w-full" type="submit" disabled={isLoading}>
-                    {isLoading ? 'Signing In...' : 'Sign In'}
-                  </Button>
-                </form>
+                {showForgotPassword ? (
+                  <form onSubmit={handleForgotPassword} className="space-y-4">
+                    <div className="space-y-2">
+                      <Label htmlFor="forgot-email">Email</Label>
+                      <Input id="forgot-email" name="email" type="email" required />
+                    </div>
+                    <Button className="w-full" type="submit" disabled={isLoading}>
+                      {isLoading ? 'Sending...' : 'Send Reset Link'}
+                    </Button>
+                    <Button variant="link" className="w-full" type="button" onClick={() => setShowForgotPassword(false)}>
+                      Back to Sign In
+                    </Button>
+                  </form>
+                ) : (
+                  <form onSubmit={handleSubmit} className="space-y-4">
+                    <input type="hidden" name="action" value="signin" />
+                    <div className="space-y-2">
+                      <Label htmlFor="signin-email">Email</Label>
+                      <Input id="signin-email" name="email" type="email" required />
+                    </div>
+                    <div className="space-y-2">
+                      <Label htmlFor="signin-password">Password</Label>
+                      <Input id="signin-password" name="password" type="password" required />
+                    </div>
+                    <Button className="w-full" type="submit" disabled={isLoading}>
+                      {isLoading ? 'Signing In...' : 'Sign In'}
+                    </Button>
+                    <Button variant="link" className="w-full" type="button" onClick={() => setShowForgotPassword(true)}>
+                      Forgot password?
+                    </Button>
+                  </form>
+                )}
               </TabsContent>
               <TabsContent value="signup" className="absolute top-0 left-0 w-full">
                 <form onSubmit={handleSubmit} className="space-y-4">
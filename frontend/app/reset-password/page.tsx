@@ -0,0 +1,112 @@
+'use client'
+
+import { Suspense, useState } from 'react'
+import { useRouter, useSearchParams } from 'next/navigation'
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Alert, AlertDescription, AlertTitle } from "@/components/ui/alert"
+import { AlertCircle } from "lucide-react"
+import { API_ENDPOINTS } from '@/endpoints/endpoint'
+
+// ResetPassword sets a new password with the email and token of the reset link
+function ResetPassword() {
+  const [isLoading, setIsLoading] = useState(false)
+  const [isDone, setIsDone] = useState(false)
+  const [error, setError] = useState<string | null>(null)
+  const router = useRouter()
+  const searchParams = useSearchParams()
+  const email = searchParams.get('email')
+  const token = searchParams.get('token')
+
+  const handleSubmit = async (event: React.FormEvent<HTMLFormElement>) => {
+    event.preventDefault()
+    setError(null)
+
+    const formData = new FormData(event.currentTarget)
+    const password = formData.get('password')
+    if (password !== formData.get('confirm_password')) {
+      setError('The passwords do not match')
+      return
+    }
+
+    setIsLoading(true)
+    try {
+      const response = await fetch(API_ENDPOINTS.RESET_PASSWORD, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ email, token, password }),
+      })
+
+      if (response.ok) {
+        setIsDone(true)
+      } else {
+        const errorData = await response.json()
+        setError(errorData.error || 'Password reset failed')
+      }
+    } catch (error) {
+      setError("An unexpected error occurred. Please try again later.")
+    } finally {
+      setIsLoading(false)
+    }
+  }
+
+  return (
+    <Card className="w-full max-w-[400px] shadow-apple-lg">
+      <CardHeader>
+        <CardTitle className="text-2xl font-semibold">Choose a new password</CardTitle>
+        <CardDescription>{email}</CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-4">
+        {!email || !token ? (
+          <Alert variant="destructive">
+            <AlertCircle className="h-4 w-4" />
+            <AlertTitle>Error</AlertTitle>
+            <AlertDescription>This reset link is incomplete. Please use the link from the email.</AlertDescription>
+          </Alert>
+        ) : isDone ? (
+          <>
+            <p className="text-sm text-muted-foreground">Your password has been changed. You can sign in with it now.</p>
+            <Button className="w-full" onClick={() => router.push('/')}>
+              Go to Sign In
+            </Button>
+          </>
+        ) : (
+          <>
+            {error && (
+              <Alert variant="destructive">
+                <AlertCircle className="h-4 w-4" />
+                <AlertTitle>Error</AlertTitle>
+                <AlertDescription>{error}</AlertDescription>
+              </Alert>
+            )}
+            <form onSubmit={handleSubmit} className="space-y-4">
+              <div className="space-y-2">
+                <Label htmlFor="password">New Password</Label>
+                <Input id="password" name="password" type="password" autoComplete="new-password" required />
+              </div>
+              <div className="space-y-2">
+                <Label htmlFor="confirm_password">Confirm Password</Label>
+                <Input id="confirm_password" name="confirm_password" type="password" autoComplete="new-password" required />
+              </div>
+              <Button className="w-full" type="submit" disabled={isLoading}>
+                {isLoading ? 'Saving...' : 'Set Password'}
+              </Button>
+            </form>
+          </>
+        )}
+      </CardContent>
+    </Card>
+  )
+}
+
+export default function ResetPasswordPage() {
+  return (
+    <div className="flex items-center justify-center min-h-screen bg-background p-4">
+      <Suspense>
+        <ResetPassword />
+      </Suspense>
+    </div>
+  )
+}
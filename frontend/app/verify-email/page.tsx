@@ -0,0 +1,83 @@
+'use client'
+
+import { Suspense, useEffect, useState } from 'react'
+import { useRouter, useSearchParams } from 'next/navigation'
+import { Button } from "@/components/ui/button"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Alert, AlertDescription, AlertTitle } from "@/components/ui/alert"
+import { AlertCircle } from "lucide-react"
+import { API_ENDPOINTS } from '@/endpoints/endpoint'
+
+// VerifyEmail submits the email and token of the verification link sent after signing up
+function VerifyEmail() {
+  const [isLoading, setIsLoading] = useState(true)
+  const [error, setError] = useState<string | null>(null)
+  const router = useRouter()
+  const searchParams = useSearchParams()
+  const email = searchParams.get('email')
+  const token = searchParams.get('token')
+
+  useEffect(() => {
+    if (!email || !token) {
+      setError('This verification link is incomplete. Please use the link from the email.')
+      setIsLoading(false)
+      return
+    }
+
+    const verify = async () => {
+      try {
+        const response = await fetch(API_ENDPOINTS.VERIFY_EMAIL, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ email, token }),
+        })
+
+        if (!response.ok) {
+          const errorData = await response.json()
+          setError(errorData.error || 'Verification failed')
+        }
+      } catch (error) {
+        setError("An unexpected error occurred. Please try again later.")
+      } finally {
+        setIsLoading(false)
+      }
+    }
+
+    verify()
+  }, [email, token])
+
+  return (
+    <Card className="w-full max-w-[400px] shadow-apple-lg">
+      <CardHeader>
+        <CardTitle className="text-2xl font-semibold">Verify your email</CardTitle>
+        <CardDescription>{email}</CardDescription>
+      </CardHeader>
+      <CardContent className="space-y-4">
+        {error && (
+          <Alert variant="destructive">
+            <AlertCircle className="h-4 w-4" />
+            <AlertTitle>Error</AlertTitle>
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+        {isLoading && <p className="text-sm text-muted-foreground">Verifying your email address...</p>}
+        {!isLoading && !error && (
+          <p className="text-sm text-muted-foreground">Your email address is verified. You can sign in now.</p>
+        )}
+        <Button className="w-full" disabled={isLoading} onClick={() => router.push('/')}>
+          Go to Sign In
+        </Button>
+      </CardContent>
+    </Card>
+  )
+}
+
+export default function VerifyEmailPage() {
+  return (
+    <div className="flex items-center justify-center min-h-screen bg-background p-4">
+      <Suspense>
+        <VerifyEmail />
+      </Suspense>
+    </div>
+  )
+}
@@ -11,6 +11,10 @@ export var API_ENDPOINTS = {
     SIGNIN: getSaaSDomainURL() + `/user/signin`,
     SIGNUP: getSaaSDomainURL() + `/user`,
     PROFILE: getSaaSDomainURL() + `/user/profile`,
+    VERIFY_EMAIL: getSaaSDomainURL() + `/user/verify`,
+    RESEND_VERIFICATION: getSaaSDomainURL() + `/user/verify/resend`,
+    FORGOT_PASSWORD: getSaaSDomainURL() + `/user/password/forgot`,
+    RESET_PASSWORD: getSaaSDomainURL() + `/user/password/reset`,
     CHAT: getSaaSDomainURL() + `/chat`,
     BILLING_USAGE: getSaaSDomainURL() + `/billing/usage`,
 }
\ No newline at end of file